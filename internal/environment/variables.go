@@ -6,20 +6,38 @@ const (
 	HTTPAddress                = "HTTP_ADDRESS"
 	HTTPSRedirectPort          = "HTTPS_REDIRECT_PORT"
 	HTTPEnableRedirect         = "ENABLE_HTTP_REDIRECT"
+	HTTPListeners              = "LISTENERS"
+	HTTPReadTimeout            = "HTTP_READ_TIMEOUT"
+	HTTPReadHeaderTimeout      = "HTTP_READ_HEADER_TIMEOUT"
+	HTTPWriteTimeout           = "HTTP_WRITE_TIMEOUT"
+	HTTPIdleTimeout            = "HTTP_IDLE_TIMEOUT"
+	TrustedProxies             = "TRUSTED_PROXIES"
 	NetworkTestOnStart         = "NETWORK_TEST_ON_START"
 	IncludePublicIPInNAT1To1IP = "INCLUDE_PUBLIC_IP_IN_NAT_1_TO_1_IP"
+	PublicIPSTUNServers        = "PUBLIC_IP_STUN_SERVERS"
+	PublicIPMinimumAgreements  = "PUBLIC_IP_MINIMUM_AGREEMENTS"
+	PublicIPHTTPFallback       = "PUBLIC_IP_HTTP_FALLBACK"
+	PublicIPRefreshInterval    = "PUBLIC_IP_REFRESH_INTERVAL"
 	DisableStatus              = "DISABLE_STATUS"
 	EnableProfiling            = "ENABLE_PROFILING"
 
 	// SSL
-	SSLKey  = "SSL_KEY"
-	SSLCert = "SSL_CERT"
+	SSLKey             = "SSL_KEY"
+	SSLCert            = "SSL_CERT"
+	SSLReloadInterval  = "SSL_RELOAD_INTERVAL"
+	ACMEDomains        = "ACME_DOMAINS"
+	ACMEEmail          = "ACME_EMAIL"
+	ACMEDirectoryURL   = "ACME_DIRECTORY_URL"
+	ACMECacheDirectory = "ACME_CACHE_DIRECTORY"
 
 	// AUTHORIZATION
 	StreamProfilePath   = "STREAM_PROFILE_PATH"
 	StreamProfilePolicy = "STREAM_PROFILE_POLICY"
 	WebhookURL          = "WEBHOOK_URL"
 
+	// VIRTUAL CHANNELS
+	VirtualChannelWebhookToken = "VIRTUAL_CHANNEL_WEBHOOK_TOKEN"
+
 	// FRONTEND
 	FrontendDisabled   = "DISABLE_FRONTEND"
 	frontendPath       = "FRONTEND_PATH"
@@ -36,17 +54,53 @@ const (
 	TCPMuxForce              = "TCP_MUX_FORCE"
 	TCPMuxAddress            = "TCP_MUX_ADDRESS"
 	InterfaceFilter          = "INTERFACE_FILTER"
+	InterfaceExclude         = "INTERFACE_EXCLUDE"
+	ICEIPInclude             = "ICE_IP_INCLUDE"
+	ICEIPExclude             = "ICE_IP_EXCLUDE"
+	ICELite                  = "ICE_LITE"
+	UDPPortRange             = "UDP_PORT_RANGE"
 	UDPMuxPort               = "UDP_MUX_PORT"
 	UDPMuxPortWHIP           = "UDP_MUX_PORT_WHIP"
 	UDPMuxPortWHEP           = "UDP_MUX_PORT_WHEP"
+	UDPMuxShards             = "UDP_MUX_SHARDS"
 	NAT1To1IP                = "NAT_1_TO_1_IP"
+	NAT1To1IPv4              = "NAT_1_TO_1_IPV4"
+	NAT1To1IPv6              = "NAT_1_TO_1_IPV6"
 	NATICECandidateType      = "NAT_ICE_CANDIDATE_TYPE"
 
+	// WHIP
+	WHIPReconnectGracePeriod = "WHIP_RECONNECT_GRACE_PERIOD"
+	WHIPLayerIdleTimeout     = "WHIP_LAYER_IDLE_TIMEOUT"
+
+	// WHEP
+	WHEPSendQueueSize      = "WHEP_SEND_QUEUE_SIZE"
+	WHEPSlowConsumerPolicy = "WHEP_SLOW_CONSUMER_POLICY"
+
+	// WEBSOCKET
+	WebSocketFragmentDuration = "WEBSOCKET_FRAGMENT_DURATION"
+
+	// WEBTRANSPORT
+	WebTransportAddress = "WEBTRANSPORT_ADDRESS"
+
 	// STUN
 	STUNServers = "STUN_SERVERS"
 
+	// TURN
+	TURNServers           = "TURN_SERVERS"
+	TURNServersUsername   = "TURN_SERVERS_USERNAME"
+	TURNServersCredential = "TURN_SERVERS_CREDENTIAL"
+	TURNServersSecret     = "TURN_SERVERS_SECRET"
+	TURNUDPAddress        = "TURN_UDP_ADDRESS"
+	TURNTCPAddress        = "TURN_TCP_ADDRESS"
+	TURNTLSAddress        = "TURN_TLS_ADDRESS"
+	TURNPublicIP          = "TURN_PUBLIC_IP"
+	TURNHost              = "TURN_HOST"
+	TURNSecret            = "TURN_SECRET"
+	TURNCredentialTTL     = "TURN_CREDENTIAL_TTL"
+
 	// PEERCONNECTION
-	AppendCandidate = "APPEND_CANDIDATE"
+	AppendCandidate  = "APPEND_CANDIDATE"
+	ServerTrickleICE = "SERVER_TRICKLE_ICE"
 
 	// DEBUGGING
 	DebugIncomingAPIRequest = "DEBUG_INCOMING_API_REQUEST"
@@ -2,31 +2,120 @@ package ip
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+const (
+	defaultSTUNServers       = "stun.l.google.com:19302|stun.cloudflare.com:3478"
+	defaultRefreshInterval   = 5 * time.Minute
+	httpFallbackURL          = "http://ip-api.com/json/"
+	httpFallbackTimeout      = 5 * time.Second
+	defaultMinimumAgreements = 2
+)
+
+var (
+	errNoAgreement = errors.New("STUN servers did not agree on a public IP")
+	errEmptyQuery  = errors.New("query entry was not populated")
+
+	publicIPLock sync.RWMutex
+	publicIP     string
+
+	refreshOnce sync.Once
 )
 
+// Get the last discovered public IP, empty if it could not be discovered yet
 func GetPublicIP() string {
-	req, err := http.Get("http://ip-api.com/json/")
+	publicIPLock.RLock()
+	defer publicIPLock.RUnlock()
+
+	return publicIP
+}
+
+// Discover the public IP and keep refreshing it in the background.
+// onChange is called whenever a refresh discovers a different public IP than the current one.
+// Failing to discover the public IP is logged, the last known public IP is kept.
+func StartRefresh(onChange func(publicIP string)) {
+	refresh()
+
+	interval := getRefreshInterval()
+	if interval <= 0 {
+		return
+	}
+
+	refreshOnce.Do(func() {
+		go func() {
+			for range time.Tick(interval) {
+				if refresh() {
+					onChange(GetPublicIP())
+				}
+			}
+		}()
+	})
+}
+
+// Discover the public IP and return true if it changed
+func refresh() bool {
+	discoveredIP, err := DiscoverPublicIP()
+	if err != nil {
+		slog.Error("Failed to get Public IP", "err", err, "lastKnownIP", GetPublicIP())
+		return false
+	}
+
+	publicIPLock.Lock()
+	defer publicIPLock.Unlock()
+
+	if discoveredIP == publicIP {
+		return false
+	}
+
+	slog.Info("Public IP discovered", "ip", discoveredIP, "previousIP", publicIP)
+	publicIP = discoveredIP
+	return true
+}
+
+// Discover the public IP through the configured STUN servers, the HTTP API is used if enabled and STUN failed
+func DiscoverPublicIP() (string, error) {
+	stunServers := getSTUNServers()
+	discoveredIP, err := discoverWithSTUN(stunServers, getMinimumAgreements(len(stunServers)))
+	if err == nil {
+		return discoveredIP, nil
+	}
+
+	if os.Getenv(environment.PublicIPHTTPFallback) == "" {
+		return "", err
+	}
+
+	slog.Warn("Public IP STUN discovery failed, using HTTP fallback", "err", err)
+	return discoverWithHTTP(httpFallbackURL)
+}
+
+func discoverWithHTTP(url string) (string, error) {
+	client := http.Client{Timeout: httpFallbackTimeout}
 
+	response, err := client.Get(url)
 	if err != nil {
-		slog.Error("Failed to get Public IP", "err", err)
-		os.Exit(1)
+		return "", err
 	}
 
 	defer func() {
-		if closeErr := req.Body.Close(); closeErr != nil {
-			slog.Error("Failed to get Public IP", "err", err)
-			os.Exit(1)
+		if closeErr := response.Body.Close(); closeErr != nil {
+			slog.Error("Failed to get Public IP", "err", closeErr)
 		}
 	}()
 
-	body, err := io.ReadAll(req.Body)
+	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		slog.Error("Failed to get Public IP", "err", err)
-		os.Exit(1)
+		return "", err
 	}
 
 	ip := struct {
@@ -34,14 +123,61 @@ func GetPublicIP() string {
 	}{}
 
 	if err = json.Unmarshal(body, &ip); err != nil {
-		slog.Error("Failed to get Public IP", "err", err)
-		os.Exit(1)
+		return "", err
 	}
 
 	if ip.Query == "" {
-		slog.Error("Failed to get Public IP", "err", "Query entry was not populated")
-		os.Exit(1)
+		return "", errEmptyQuery
+	}
+
+	return ip.Query, nil
+}
+
+func getSTUNServers() []string {
+	stunServers := os.Getenv(environment.PublicIPSTUNServers)
+	if stunServers == "" {
+		stunServers = defaultSTUNServers
+	}
+
+	servers := []string{}
+	for stunServer := range strings.SplitSeq(stunServers, "|") {
+		if strings.TrimSpace(stunServer) != "" {
+			servers = append(servers, stunServer)
+		}
+	}
+
+	return servers
+}
+
+// Get the number of STUN servers that must agree, by default two unless a single server is configured
+func getMinimumAgreements(stunServerCount int) int {
+	defaultAgreements := max(min(defaultMinimumAgreements, stunServerCount), 1)
+
+	value := os.Getenv(environment.PublicIPMinimumAgreements)
+	if value == "" {
+		return defaultAgreements
+	}
+
+	minimumAgreements, err := strconv.Atoi(value)
+	if err != nil || minimumAgreements < 1 {
+		slog.Error("Invalid minimum public IP agreements", "value", value, "err", err)
+		return defaultAgreements
+	}
+
+	return minimumAgreements
+}
+
+func getRefreshInterval() time.Duration {
+	value := os.Getenv(environment.PublicIPRefreshInterval)
+	if value == "" {
+		return defaultRefreshInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Error("Invalid public IP refresh interval", "value", value, "err", err)
+		return defaultRefreshInterval
 	}
 
-	return ip.Query
+	return interval
 }
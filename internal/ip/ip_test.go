@@ -0,0 +1,95 @@
+package ip
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Start a STUN server that reports the provided address for every binding request
+func startSTUNServer(t *testing.T, mappedIP string) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 1500)
+		for {
+			length, address, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+
+			request := &stun.Message{Raw: append([]byte{}, buffer[:length]...)}
+			if err := request.Decode(); err != nil {
+				continue
+			}
+
+			response := stun.MustBuild(
+				stun.NewTransactionIDSetter(request.TransactionID),
+				stun.BindingSuccess,
+				&stun.XORMappedAddress{IP: net.ParseIP(mappedIP), Port: 1234},
+			)
+			_, _ = conn.WriteTo(response.Raw, address)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestDiscoverWithSTUNUsesAgreedAddress(t *testing.T) {
+	first := startSTUNServer(t, "203.0.113.10")
+	second := startSTUNServer(t, "203.0.113.10")
+	third := startSTUNServer(t, "198.51.100.20")
+
+	publicIP, err := discoverWithSTUN([]string{first, "stun:" + second, third}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.10", publicIP)
+
+	_, err = discoverWithSTUN([]string{first, third}, 2)
+	assert.ErrorIs(t, err, errNoAgreement)
+}
+
+func TestDiscoverWithSTUNIgnoresFailingServers(t *testing.T) {
+	unreachable, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachableAddress := unreachable.LocalAddr().String()
+	require.NoError(t, unreachable.Close())
+
+	publicIP, err := discoverWithSTUN([]string{unreachableAddress, startSTUNServer(t, "203.0.113.10")}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.10", publicIP)
+
+	_, err = discoverWithSTUN([]string{unreachableAddress}, 1)
+	assert.ErrorIs(t, err, errNoAgreement)
+}
+
+func TestDiscoverWithHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, _ *http.Request) {
+		_, _ = responseWriter.Write([]byte(`{"query":"203.0.113.30"}`))
+	}))
+	defer server.Close()
+
+	publicIP, err := discoverWithHTTP(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.30", publicIP)
+}
+
+func TestMinimumAgreements(t *testing.T) {
+	t.Setenv(environment.PublicIPSTUNServers, "")
+	t.Setenv(environment.PublicIPMinimumAgreements, "")
+	assert.Equal(t, 2, getMinimumAgreements(len(getSTUNServers())))
+	assert.Equal(t, 1, getMinimumAgreements(1))
+
+	t.Setenv(environment.PublicIPSTUNServers, "stun.example.com:3478|")
+	assert.Equal(t, []string{"stun.example.com:3478"}, getSTUNServers())
+
+	t.Setenv(environment.PublicIPMinimumAgreements, "3")
+	assert.Equal(t, 3, getMinimumAgreements(2))
+}
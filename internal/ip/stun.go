@@ -0,0 +1,117 @@
+package ip
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/stun/v3"
+)
+
+const stunRequestTimeout = 3 * time.Second
+
+var errNoMappedAddress = errors.New("STUN response did not contain a mapped address")
+
+// Ask every STUN server for our address, the address most servers agree on is used.
+// At least minimumAgreements servers have to report the same address.
+func discoverWithSTUN(stunServers []string, minimumAgreements int) (string, error) {
+	var (
+		resultsLock sync.Mutex
+		results     = map[string][]string{}
+		errs        []error
+		waitGroup   sync.WaitGroup
+	)
+
+	for _, stunServer := range stunServers {
+		stunServer = strings.TrimPrefix(strings.TrimSpace(stunServer), "stun:")
+		if stunServer == "" {
+			continue
+		}
+
+		waitGroup.Go(func() {
+			address, err := requestMappedAddress(stunServer)
+
+			resultsLock.Lock()
+			defer resultsLock.Unlock()
+
+			if err != nil {
+				errs = append(errs, errors.Join(errors.New(stunServer), err))
+				return
+			}
+
+			results[address] = append(results[address], stunServer)
+		})
+	}
+	waitGroup.Wait()
+
+	var (
+		agreedAddress string
+		agreements    int
+	)
+	for address, servers := range results {
+		if len(servers) > agreements || (len(servers) == agreements && address < agreedAddress) {
+			agreedAddress, agreements = address, len(servers)
+		}
+	}
+
+	if len(results) > 1 {
+		slog.Warn("STUN servers reported different public IPs", "results", results, "using", agreedAddress)
+	}
+
+	if agreements == 0 || agreements < minimumAgreements {
+		return "", errors.Join(append([]error{errNoAgreement}, errs...)...)
+	}
+
+	return agreedAddress, nil
+}
+
+// Send a binding request to the STUN server and return the IPv4 address it saw
+func requestMappedAddress(stunServer string) (string, error) {
+	conn, err := net.Dial("udp4", stunServer)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			slog.Error("STUN connection close failed", "err", closeErr)
+		}
+	}()
+
+	if err = conn.SetDeadline(time.Now().Add(stunRequestTimeout)); err != nil {
+		return "", err
+	}
+
+	request := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	if _, err = conn.Write(request.Raw); err != nil {
+		return "", err
+	}
+
+	buffer := make([]byte, 1500)
+	for {
+		length, err := conn.Read(buffer)
+		if err != nil {
+			return "", err
+		}
+
+		response := &stun.Message{Raw: append([]byte{}, buffer[:length]...)}
+		if err = response.Decode(); err != nil || response.TransactionID != request.TransactionID {
+			continue
+		}
+
+		var xorAddress stun.XORMappedAddress
+		if err = xorAddress.GetFrom(response); err == nil {
+			return xorAddress.IP.String(), nil
+		}
+
+		var mappedAddress stun.MappedAddress
+		if err = mappedAddress.GetFrom(response); err == nil {
+			return mappedAddress.IP.String(), nil
+		}
+
+		return "", errNoMappedAddress
+	}
+}
@@ -0,0 +1,318 @@
+package networktest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/ip"
+	whipHandlers "github.com/glimesh/broadcast-box/internal/server/handlers/whip"
+	bbwebrtc "github.com/glimesh/broadcast-box/internal/webrtc"
+)
+
+const (
+	diagnosticsTimeout = 10 * time.Second
+	tcpDialTimeout     = 2 * time.Second
+
+	checkStatusPassed  = "passed"
+	checkStatusFailed  = "failed"
+	checkStatusSkipped = "skipped"
+
+	// Private candidates are not offered to the loopback client, they are not probed
+	candidateStateSkipped = "skipped"
+)
+
+var (
+	ErrDiagnosticsRunning = errors.New("network diagnostics are already running")
+
+	// The loopback test publishes with a fixed stream key, only one run at a time
+	diagnosticsLock sync.Mutex
+)
+
+type Report struct {
+	Passed                     bool              `json:"passed"`
+	StartedAt                  time.Time         `json:"startedAt"`
+	DurationMs                 int64             `json:"durationMs"`
+	Checks                     []CheckReport     `json:"checks"`
+	Candidates                 []CandidateReport `json:"candidates"`
+	SuspectedMisconfigurations []string          `json:"suspectedMisconfigurations"`
+}
+
+type CheckReport struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"durationMs"`
+	Message    string `json:"message,omitempty"`
+}
+
+type CandidateReport struct {
+	Type            string  `json:"type"`
+	Protocol        string  `json:"protocol"`
+	Address         string  `json:"address"`
+	Port            int     `json:"port"`
+	State           string  `json:"state"`
+	Reachable       bool    `json:"reachable"`
+	RoundTripTimeMs float64 `json:"roundTripTimeMs,omitempty"`
+}
+
+// Run the loopback WHIP connection test, the UDP and TCP mux checks and report the reachability of every candidate
+func RunDiagnostics() (*Report, error) {
+	if !diagnosticsLock.TryLock() {
+		return nil, ErrDiagnosticsRunning
+	}
+	defer diagnosticsLock.Unlock()
+
+	report := &Report{
+		StartedAt:                  time.Now(),
+		Checks:                     []CheckReport{},
+		Candidates:                 []CandidateReport{},
+		SuspectedMisconfigurations: []string{},
+	}
+
+	loopbackCheck := runCheck("whipLoopback", func() (string, string) {
+		candidates, err := run(whipHandlers.WHIPHandler, diagnosticsTimeout)
+		if candidates != nil {
+			report.Candidates = candidates
+		}
+
+		if err != nil {
+			return checkStatusFailed, err.Error()
+		}
+
+		return checkStatusPassed, ""
+	})
+
+	report.Checks = append(report.Checks,
+		loopbackCheck,
+		runCheck("udpMuxWHIP", func() (string, string) { return checkUDPMux(true) }),
+		runCheck("udpMuxWHEP", func() (string, string) { return checkUDPMux(false) }),
+		runCheck("tcpMux", checkTCPMux),
+	)
+
+	report.Passed = true
+	for _, check := range report.Checks {
+		if check.Status == checkStatusFailed {
+			report.Passed = false
+		}
+	}
+
+	report.SuspectedMisconfigurations = getSuspectedMisconfigurations(report)
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report, nil
+}
+
+func runCheck(name string, check func() (status string, message string)) CheckReport {
+	startedAt := time.Now()
+	status, message := check()
+
+	return CheckReport{
+		Name:       name,
+		Status:     status,
+		DurationMs: time.Since(startedAt).Milliseconds(),
+		Message:    message,
+	}
+}
+
+// Verify the host UDP candidates of new PeerConnections use the configured mux port, or one of the shard ports
+func checkUDPMux(isWHIP bool) (string, string) {
+	muxPort := bbwebrtc.GetUDPMuxPort(isWHIP)
+	if muxPort == 0 {
+		return checkStatusSkipped, "UDP mux is not configured"
+	}
+
+	ports := strconv.Itoa(muxPort)
+	lastPort := muxPort + bbwebrtc.GetUDPMuxShardCount() - 1
+	if lastPort != muxPort {
+		ports = fmt.Sprintf("%d-%d", muxPort, lastPort)
+	}
+
+	gathered, err := bbwebrtc.GatherCandidates(isWHIP)
+	if err != nil {
+		return checkStatusFailed, err.Error()
+	}
+
+	muxCandidates := 0
+	for _, candidate := range gathered.Candidates {
+		if candidate.Type != webrtc.ICECandidateTypeHost.String() || candidate.Protocol != webrtc.ICEProtocolUDP.String() {
+			continue
+		}
+
+		if int(candidate.Port) < muxPort || int(candidate.Port) > lastPort {
+			return checkStatusFailed, fmt.Sprintf("host candidate %s:%d does not use UDP mux port %s", candidate.Address, candidate.Port, ports)
+		}
+		muxCandidates++
+	}
+
+	if muxCandidates == 0 {
+		return checkStatusFailed, fmt.Sprintf("no host candidates were gathered on UDP mux port %s", ports)
+	}
+
+	return checkStatusPassed, fmt.Sprintf("%d host candidates on UDP mux port %s", muxCandidates, ports)
+}
+
+// Verify the TCP mux accepts connections
+func checkTCPMux() (string, string) {
+	address := os.Getenv(environment.TCPMuxAddress)
+	if address == "" {
+		return checkStatusSkipped, "TCP mux is not configured"
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return checkStatusFailed, err.Error()
+	}
+
+	if host == "" || net.ParseIP(host).IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), tcpDialTimeout)
+	if err != nil {
+		return checkStatusFailed, err.Error()
+	}
+	_ = conn.Close()
+
+	return checkStatusPassed, "TCP mux accepts connections on " + net.JoinHostPort(host, port)
+}
+
+func newCandidateReport(candidate ice.Candidate, isProbed bool) CandidateReport {
+	state := string(webrtc.StatsICECandidatePairStateFrozen)
+	if !isProbed {
+		state = candidateStateSkipped
+	}
+
+	return CandidateReport{
+		Type:     candidate.Type().String(),
+		Protocol: candidate.NetworkType().NetworkShort(),
+		Address:  candidate.Address(),
+		Port:     candidate.Port(),
+		State:    state,
+	}
+}
+
+// Candidates can be repeated across media sections, they are only reported once
+func appendCandidateReport(candidates []CandidateReport, candidate CandidateReport) []CandidateReport {
+	key := candidateKey(candidate.Protocol, candidate.Address, candidate.Port)
+	for _, existing := range candidates {
+		if candidateKey(existing.Protocol, existing.Address, existing.Port) == key {
+			return candidates
+		}
+	}
+
+	return append(candidates, candidate)
+}
+
+// Update the candidates with the best connectivity check state the client reached with them
+func updateCandidateStates(candidates []CandidateReport, stats webrtc.StatsReport) []CandidateReport {
+	remoteCandidates := map[string]string{}
+	for _, stat := range stats {
+		if candidateStats, ok := stat.(webrtc.ICECandidateStats); ok && candidateStats.Type == webrtc.StatsTypeRemoteCandidate {
+			remoteCandidates[candidateStats.ID] = candidateKey(candidateStats.Protocol, candidateStats.IP, int(candidateStats.Port))
+		}
+	}
+
+	for _, stat := range stats {
+		pairStats, ok := stat.(webrtc.ICECandidatePairStats)
+		if !ok {
+			continue
+		}
+
+		key := remoteCandidates[pairStats.RemoteCandidateID]
+		for i := range candidates {
+			candidate := &candidates[i]
+			if candidate.State == candidateStateSkipped || candidateKey(candidate.Protocol, candidate.Address, candidate.Port) != key {
+				continue
+			}
+
+			if pairStats.State == webrtc.StatsICECandidatePairStateSucceeded {
+				candidate.Reachable = true
+				candidate.RoundTripTimeMs = pairStats.CurrentRoundTripTime * 1000
+			}
+
+			if candidatePairStateRank(pairStats.State) > candidatePairStateRank(webrtc.StatsICECandidatePairState(candidate.State)) {
+				candidate.State = string(pairStats.State)
+			}
+		}
+	}
+
+	return candidates
+}
+
+func candidateKey(protocol string, address string, port int) string {
+	return protocol + " " + net.JoinHostPort(address, strconv.Itoa(port))
+}
+
+func candidatePairStateRank(state webrtc.StatsICECandidatePairState) int {
+	switch state {
+	case webrtc.StatsICECandidatePairStateSucceeded:
+		return 4
+	case webrtc.StatsICECandidatePairStateFailed:
+		return 3
+	case webrtc.StatsICECandidatePairStateInProgress:
+		return 2
+	case webrtc.StatsICECandidatePairStateWaiting:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func getSuspectedMisconfigurations(report *Report) (suspected []string) {
+	suspected = []string{}
+
+	isNATConfigured := os.Getenv(environment.NAT1To1IP) != "" ||
+		os.Getenv(environment.NAT1To1IPv4) != "" ||
+		os.Getenv(environment.NAT1To1IPv6) != "" ||
+		os.Getenv(environment.IncludePublicIPInNAT1To1IP) != ""
+
+	if os.Getenv(environment.IncludePublicIPInNAT1To1IP) != "" && ip.GetPublicIP() == "" {
+		suspected = append(suspected, "INCLUDE_PUBLIC_IP_IN_NAT_1_TO_1_IP is set but the public IP could not be discovered, check PUBLIC_IP_STUN_SERVERS")
+	}
+
+	if len(report.Candidates) == 0 {
+		suspected = append(suspected, "No candidates were announced, check INTERFACE_FILTER, INTERFACE_EXCLUDE, ICE_IP_INCLUDE, ICE_IP_EXCLUDE and NETWORK_TYPES")
+		return suspected
+	}
+
+	probed, reachable := 0, 0
+	for _, candidate := range report.Candidates {
+		if candidate.State != candidateStateSkipped {
+			probed++
+		}
+
+		if candidate.Reachable {
+			reachable++
+		}
+	}
+
+	if probed == 0 && !isNATConfigured {
+		suspected = append(suspected, "Only private addresses are announced, set NAT_1_TO_1_IP or INCLUDE_PUBLIC_IP_IN_NAT_1_TO_1_IP when running behind NAT")
+	}
+
+	if probed != 0 && reachable == 0 {
+		suspected = append(suspected, "No announced candidate was reachable, check that the UDP_MUX_PORT, UDP_PORT_RANGE or TCP_MUX_ADDRESS ports are open in the firewall")
+	}
+
+	for _, check := range report.Checks {
+		if check.Status != checkStatusFailed {
+			continue
+		}
+
+		switch check.Name {
+		case "udpMuxWHIP", "udpMuxWHEP":
+			suspected = append(suspected, "UDP mux is configured but candidates do not use it, check UDP_MUX_PORT and INTERFACE_FILTER: "+check.Message)
+		case "tcpMux":
+			suspected = append(suspected, "TCP_MUX_ADDRESS does not accept connections: "+check.Message)
+		}
+	}
+
+	return suspected
+}
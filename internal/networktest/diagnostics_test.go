@@ -0,0 +1,74 @@
+package networktest
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Answer WHIP offers with a PeerConnection that only announces a loopback candidate
+func newLoopbackWHIPHandler(t *testing.T) func(http.ResponseWriter, *http.Request) {
+	settingEngine := webrtc.SettingEngine{}
+	settingEngine.SetIncludeLoopbackCandidate(true)
+	settingEngine.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	settingEngine.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+
+	mediaEngine := &webrtc.MediaEngine{}
+	require.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine), webrtc.WithSettingEngine(settingEngine))
+
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		offer, err := io.ReadAll(request.Body)
+		require.NoError(t, err)
+
+		peerConnection, err := api.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = peerConnection.Close() })
+
+		require.NoError(t, peerConnection.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(offer)}))
+		answer, err := peerConnection.CreateAnswer(nil)
+		require.NoError(t, err)
+
+		gatheringComplete := webrtc.GatheringCompletePromise(peerConnection)
+		require.NoError(t, peerConnection.SetLocalDescription(answer))
+		<-gatheringComplete
+
+		responseWriter.Header().Set("Content-Type", "application/sdp")
+		responseWriter.WriteHeader(http.StatusCreated)
+		_, _ = responseWriter.Write([]byte(peerConnection.LocalDescription().SDP))
+	}
+}
+
+func TestRunReportsReachableCandidates(t *testing.T) {
+	candidates, err := run(newLoopbackWHIPHandler(t), 10*time.Second)
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+
+	assert.Equal(t, "127.0.0.1", candidates[0].Address)
+	assert.Equal(t, "host", candidates[0].Type)
+	assert.Equal(t, "udp", candidates[0].Protocol)
+	assert.Equal(t, string(webrtc.StatsICECandidatePairStateSucceeded), candidates[0].State)
+	assert.True(t, candidates[0].Reachable)
+}
+
+func TestSuspectedMisconfigurations(t *testing.T) {
+	assert.Contains(t, getSuspectedMisconfigurations(&Report{})[0], "No candidates were announced")
+
+	privateOnly := &Report{Candidates: []CandidateReport{{Address: "10.0.0.2", State: candidateStateSkipped}}}
+	assert.Contains(t, getSuspectedMisconfigurations(privateOnly)[0], "Only private addresses are announced")
+
+	unreachable := &Report{
+		Candidates: []CandidateReport{{Address: "203.0.113.1", State: string(webrtc.StatsICECandidatePairStateFailed)}},
+		Checks:     []CheckReport{{Name: "tcpMux", Status: checkStatusFailed, Message: "connection refused"}},
+	}
+	assert.Equal(t, []string{
+		"No announced candidate was reachable, check that the UDP_MUX_PORT, UDP_PORT_RANGE or TCP_MUX_ADDRESS ports are open in the firewall",
+		"TCP_MUX_ADDRESS does not accept connections: connection refused",
+	}, getSuspectedMisconfigurations(unreachable))
+}
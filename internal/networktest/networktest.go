@@ -26,14 +26,15 @@ const (
 	networkTestIntroMessage   = "\033[0;33mNETWORK_TEST_ON_START is enabled. If the test fails Broadcast Box will exit.\nSee the README for how to debug or disable NETWORK_TEST_ON_START\033[0m"
 	networkTestSuccessMessage = "\033[0;32mNetwork Test passed.\nHave fun using Broadcast Box.\033[0m"
 	networkTestFailedMessage  = "\033[0;31mNetwork Test failed.\n%s\nPlease see the README and join Discord for help\033[0m"
+
+	startupTimeout = 30 * time.Second
 )
 
 func RunNetworkTest() {
 
 	fmt.Println(networkTestIntroMessage)
 
-	err := run(whipHandlers.WHIPHandler)
-	if err != nil {
+	if _, err := run(whipHandlers.WHIPHandler, startupTimeout); err != nil {
 		fmt.Printf(networkTestFailedMessage, err)
 		os.Exit(1)
 	}
@@ -41,7 +42,9 @@ func RunNetworkTest() {
 	fmt.Println(networkTestSuccessMessage)
 }
 
-func run(whipHandler func(res http.ResponseWriter, req *http.Request)) error {
+// Publish to the WHIP handler and connect to the public candidates of the answer.
+// Returns the candidates of the answer and whether they could be reached.
+func run(whipHandler func(res http.ResponseWriter, req *http.Request), timeout time.Duration) ([]CandidateReport, error) {
 	m := &webrtc.MediaEngine{}
 
 	codecs.RegisterCodecs(m)
@@ -56,24 +59,27 @@ func run(whipHandler func(res http.ResponseWriter, req *http.Request)) error {
 
 	peerConnection, err := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithSettingEngine(s)).NewPeerConnection(webrtc.Configuration{})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer func() {
+		_ = peerConnection.Close()
+	}()
 
 	if _, err = peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err != nil {
-		return err
+		return nil, err
 	}
 
 	if _, err = peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo); err != nil {
-		return err
+		return nil, err
 	}
 
 	offer, err := peerConnection.CreateOffer(nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if err = peerConnection.SetLocalDescription(offer); err != nil {
-		return err
+		return nil, err
 	}
 
 	iceConnected, iceConnectedCancel := context.WithCancel(context.TODO())
@@ -96,21 +102,22 @@ func run(whipHandler func(res http.ResponseWriter, req *http.Request)) error {
 	res := recorder.Result()
 
 	if res.StatusCode != 201 {
-		return fmt.Errorf("unexpected HTTP StatusCode %d", res.StatusCode)
+		return nil, fmt.Errorf("unexpected HTTP StatusCode %d", res.StatusCode)
 	}
 
 	if contentType := res.Header.Get("Content-Type"); contentType != "application/sdp" {
-		return fmt.Errorf("unexpected HTTP Content-Type %s", contentType)
+		return nil, fmt.Errorf("unexpected HTTP Content-Type %s", contentType)
 	}
 
 	respBody, _ := io.ReadAll(res.Body)
 
 	answerParsed := sdp.SessionDescription{}
 	if err = answerParsed.Unmarshal(respBody); err != nil {
-		return err
+		return nil, err
 	}
 
 	httpAddress := os.Getenv(environment.HTTPAddress)
+	candidates := []CandidateReport{}
 
 	firstMediaSection := answerParsed.MediaDescriptions[0]
 	filteredAttributes := []sdp.Attribute{}
@@ -120,14 +127,16 @@ func run(whipHandler func(res http.ResponseWriter, req *http.Request)) error {
 		if a.Key == "candidate" {
 			c, err := ice.UnmarshalCandidate(a.Value)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			ip := net.ParseIP(c.Address())
 			if ip == nil {
-				return fmt.Errorf("candidate with invalid IP %s", c.Address())
+				return nil, fmt.Errorf("candidate with invalid IP %s", c.Address())
 			}
 
+			candidates = appendCandidateReport(candidates, newCandidateReport(c, !ip.IsPrivate()))
+
 			if httpAddress != "" && httpAddress == ip.String() {
 				slog.Info("Found match for HTTP_ADDRESS", "ip", ip)
 				filteredAttributes = append(filteredAttributes, a)
@@ -157,27 +166,22 @@ func run(whipHandler func(res http.ResponseWriter, req *http.Request)) error {
 
 	answer, err := answerParsed.Marshal()
 	if err != nil {
-		return err
+		return candidates, err
 	}
 
 	if err = peerConnection.SetRemoteDescription(webrtc.SessionDescription{
 		Type: webrtc.SDPTypeAnswer,
 		SDP:  string(answer),
 	}); err != nil {
-		return err
+		return candidates, err
 	}
 
 	select {
 	case <-iceConnected.Done():
-		_ = peerConnection.Close()
-		return nil
+		return updateCandidateStates(candidates, peerConnection.GetStats()), nil
 	case <-iceFailed.Done():
-		_ = peerConnection.Close()
-
-		return errors.New("network Test client failed to connect to Broadcast Box")
-	case <-time.After(time.Second * 30):
-		_ = peerConnection.Close()
-
-		return errors.New("network Test client reported nothing in 30 seconds")
+		return updateCandidateStates(candidates, peerConnection.GetStats()), errors.New("network Test client failed to connect to Broadcast Box")
+	case <-time.After(timeout):
+		return updateCandidateStates(candidates, peerConnection.GetStats()), fmt.Errorf("network Test client reported nothing in %d seconds", int(timeout.Seconds()))
 	}
 }
@@ -17,6 +17,21 @@ const (
 	StreamPolicyReservedOnly = "RESERVED"
 )
 
+const (
+	PublisherPolicyReject   = "reject"
+	PublisherPolicyTakeover = "takeover"
+	PublisherPolicyStandby  = "standby"
+)
+
+func isValidPublisherPolicy(publisherPolicy string) bool {
+	switch publisherPolicy {
+	case "", PublisherPolicyReject, PublisherPolicyTakeover, PublisherPolicyStandby:
+		return true
+	default:
+		return false
+	}
+}
+
 func isValidStreamKey(streamKey string) bool {
 	regExp := regexp.MustCompile(`[\p{L}\p{N}_-]+`)
 	return regExp.MatchString(streamKey)
@@ -101,6 +116,75 @@ func UpdateProfile(token string, motd string, isPublic bool) error {
 	return nil
 }
 
+// Update the fallback source of a profile, used while the publisher is offline
+func UpdateProfileFallback(streamKey string, fallbackStreamKey string, fallbackMediaPath string) error {
+	fileName, _ := getProfileFileNameByStreamKey(streamKey)
+	if fileName == "" {
+		return fmt.Errorf("profile could not be found")
+	}
+
+	profilePath := os.Getenv(environment.StreamProfilePath)
+	data, err := os.ReadFile(filepath.Join(profilePath, fileName))
+	if err != nil {
+		return err
+	}
+
+	var profile profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		slog.Error("Authorization: could not read. File may be corrupt", "err", err, "streamKey", streamKey)
+		return err
+	}
+
+	profile.FileName = fileName
+	profile.FallbackStreamKey = fallbackStreamKey
+	profile.FallbackMediaPath = fallbackMediaPath
+
+	jsonData, err := json.MarshalIndent(profile, "", " ")
+	if err != nil {
+		slog.Error("Authorization: Error ocurred while trying to update profile", "err", err)
+		return err
+	}
+
+	slog.Info("Authorization: Updated Profile Fallback", "streamKey", streamKey)
+	return os.WriteFile(filepath.Join(profilePath, fileName), jsonData, 0644)
+}
+
+// Update how a profile handles a second publisher connecting with its stream key
+func UpdateProfilePublisherPolicy(streamKey string, publisherPolicy string) error {
+	if !isValidPublisherPolicy(publisherPolicy) {
+		return fmt.Errorf("publisher policy must be one of %s, %s or %s", PublisherPolicyReject, PublisherPolicyTakeover, PublisherPolicyStandby)
+	}
+
+	fileName, _ := getProfileFileNameByStreamKey(streamKey)
+	if fileName == "" {
+		return fmt.Errorf("profile could not be found")
+	}
+
+	profilePath := os.Getenv(environment.StreamProfilePath)
+	data, err := os.ReadFile(filepath.Join(profilePath, fileName))
+	if err != nil {
+		return err
+	}
+
+	var profile profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		slog.Error("Authorization: could not read. File may be corrupt", "err", err, "streamKey", streamKey)
+		return err
+	}
+
+	profile.FileName = fileName
+	profile.PublisherPolicy = publisherPolicy
+
+	jsonData, err := json.MarshalIndent(profile, "", " ")
+	if err != nil {
+		slog.Error("Authorization: Error ocurred while trying to update profile", "err", err)
+		return err
+	}
+
+	slog.Info("Authorization: Updated Profile Publisher Policy", "streamKey", streamKey, "publisherPolicy", publisherPolicy)
+	return os.WriteFile(filepath.Join(profilePath, fileName), jsonData, 0644)
+}
+
 func RemoveProfile(streamKey string) (bool, error) {
 	if !isValidStreamKey(streamKey) {
 		slog.Error("Authorization: Remove profile failed due to invalid streamkey", "streamKey", streamKey)
@@ -10,6 +10,13 @@ type profile struct {
 	IsActive bool
 	IsPublic bool
 	MOTD     string
+
+	// Source shown to viewers while the publisher is offline
+	FallbackStreamKey string `json:",omitempty"`
+	FallbackMediaPath string `json:",omitempty"`
+
+	// Handling of a second publisher connecting with the stream key
+	PublisherPolicy string `json:",omitempty"`
 }
 
 var separator = "_"
@@ -28,6 +35,11 @@ func (p *profile) asPublicProfile() *PublicProfile {
 		IsActive:  p.IsActive,
 		IsPublic:  p.IsPublic,
 		MOTD:      p.MOTD,
+
+		FallbackStreamKey: p.FallbackStreamKey,
+		FallbackMediaPath: p.FallbackMediaPath,
+
+		PublisherPolicy: p.PublisherPolicy,
 	}
 }
 func (p *profile) asPersonalProfile() *PersonalProfile {
@@ -36,6 +48,11 @@ func (p *profile) asPersonalProfile() *PersonalProfile {
 		IsActive:  p.IsActive,
 		IsPublic:  p.IsPublic,
 		MOTD:      p.MOTD,
+
+		FallbackStreamKey: p.FallbackStreamKey,
+		FallbackMediaPath: p.FallbackMediaPath,
+
+		PublisherPolicy: p.PublisherPolicy,
 	}
 }
 func (p *profile) asAdminProfile() *adminProfile {
@@ -44,6 +61,11 @@ func (p *profile) asAdminProfile() *adminProfile {
 		Token:     p.streamToken(),
 		IsPublic:  p.IsPublic,
 		MOTD:      p.MOTD,
+
+		FallbackStreamKey: p.FallbackStreamKey,
+		FallbackMediaPath: p.FallbackMediaPath,
+
+		PublisherPolicy: p.PublisherPolicy,
 	}
 }
 
@@ -53,6 +75,11 @@ type PublicProfile struct {
 	IsActive  bool   `json:"isActive"`
 	IsPublic  bool   `json:"isPublic"`
 	MOTD      string `json:"motd"`
+
+	FallbackStreamKey string `json:"fallbackStreamKey"`
+	FallbackMediaPath string `json:"fallbackMediaPath"`
+
+	PublisherPolicy string `json:"publisherPolicy"`
 }
 
 // Personal profile struct for serving to profile owner endpoints
@@ -61,6 +88,11 @@ type PersonalProfile struct {
 	IsActive  bool   `json:"isActive"`
 	IsPublic  bool   `json:"isPublic"`
 	MOTD      string `json:"motd"`
+
+	FallbackStreamKey string `json:"fallbackStreamKey"`
+	FallbackMediaPath string `json:"-"`
+
+	PublisherPolicy string `json:"publisherPolicy"`
 }
 
 // Admin profile struct for serving to admin specific endpoints
@@ -69,4 +101,9 @@ type adminProfile struct {
 	Token     string `json:"token"`
 	IsPublic  bool   `json:"isPublic"`
 	MOTD      string `json:"motd"`
+
+	FallbackStreamKey string `json:"fallbackStreamKey"`
+	FallbackMediaPath string `json:"fallbackMediaPath"`
+
+	PublisherPolicy string `json:"publisherPolicy"`
 }
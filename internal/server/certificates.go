@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultACMECacheDirectory = "acme-cache"
+	defaultSSLReloadInterval  = 30 * time.Second
+)
+
+var errMissingCertificate = errors.New("SSL_CERT and SSL_KEY or ACME_DOMAINS are required for HTTPS")
+
+// Certificates are provided per handshake, renewed or replaced certificates are used for new connections only
+func getTLSConfig(acmeManager *autocert.Manager) (*tls.Config, error) {
+	if acmeManager != nil {
+		tlsConfig := acmeManager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, nil
+	}
+
+	sslCert := os.Getenv(environment.SSLCert)
+	sslKey := os.Getenv(environment.SSLKey)
+	if sslCert == "" || sslKey == "" {
+		return nil, errMissingCertificate
+	}
+
+	reloader, err := newCertificateReloader(sslCert, sslKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if interval := getSSLReloadInterval(); interval > 0 {
+		go reloader.watch(context.Background(), interval)
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}, nil
+}
+
+// Get the ACME certificate manager, nil if ACME_DOMAINS is not configured.
+// Certificates are requested on the first handshake of a domain and renewed automatically.
+func getACMEManager() *autocert.Manager {
+	domains := os.Getenv(environment.ACMEDomains)
+	if domains == "" {
+		return nil
+	}
+
+	cacheDirectory := os.Getenv(environment.ACMECacheDirectory)
+	if cacheDirectory == "" {
+		cacheDirectory = defaultACMECacheDirectory
+	}
+
+	directoryURL := os.Getenv(environment.ACMEDirectoryURL)
+	if directoryURL == "" {
+		directoryURL = autocert.DefaultACMEDirectory
+	}
+
+	slog.Info("Using ACME certificates", "domains", domains, "directoryURL", directoryURL, "cache", cacheDirectory)
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDirectory),
+		HostPolicy: autocert.HostWhitelist(strings.Split(domains, "|")...),
+		Email:      os.Getenv(environment.ACMEEmail),
+		Client:     &acme.Client{DirectoryURL: directoryURL},
+	}
+}
+
+func getSSLReloadInterval() time.Duration {
+	value := os.Getenv(environment.SSLReloadInterval)
+	if value == "" {
+		return defaultSSLReloadInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Error("Invalid SSL reload interval", "value", value, "err", err)
+		return defaultSSLReloadInterval
+	}
+
+	return interval
+}
+
+// Serves a certificate from files and reloads it when the files change
+type certificateReloader struct {
+	certPath string
+	keyPath  string
+
+	lock        sync.RWMutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+func newCertificateReloader(certPath string, keyPath string) (*certificateReloader, error) {
+	reloader := &certificateReloader{
+		certPath: certPath,
+		keyPath:  keyPath,
+	}
+
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (r *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.certificate, nil
+}
+
+// Poll the certificate files until the context is done, a certificate that fails to load keeps the current one in use
+func (r *certificateReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := r.getModTime()
+		if err != nil {
+			slog.Error("SSL certificate check failed", "err", err)
+			continue
+		}
+
+		r.lock.RLock()
+		isChanged := !modTime.Equal(r.modTime)
+		r.lock.RUnlock()
+
+		if !isChanged {
+			continue
+		}
+
+		if err := r.reload(); err != nil {
+			slog.Error("SSL certificate reload failed, keeping current certificate", "err", err)
+			continue
+		}
+
+		slog.Info("SSL certificate reloaded", "cert", r.certPath)
+	}
+}
+
+func (r *certificateReloader) reload() error {
+	modTime, err := r.getModTime()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.certificate = &certificate
+	r.modTime = modTime
+	return nil
+}
+
+// Get the latest modification time of the certificate and key files
+func (r *certificateReloader) getModTime() (time.Time, error) {
+	certInfo, err := os.Stat(r.certPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(r.keyPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+
+	return certInfo.ModTime(), nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+)
+
+// Write a self-signed certificate with the provided serial number
+func writeCertificate(t *testing.T, certPath string, keyPath string, serialNumber int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: "broadcast-box.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func getSerialNumber(t *testing.T, reloader *certificateReloader) int64 {
+	certificate, err := reloader.getCertificate(nil)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	require.NoError(t, err)
+
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertificateReloaderReloadsChangedFiles(t *testing.T) {
+	directory := t.TempDir()
+	certPath := filepath.Join(directory, "cert.pem")
+	keyPath := filepath.Join(directory, "key.pem")
+	writeCertificate(t, certPath, keyPath, 1)
+
+	reloader, err := newCertificateReloader(certPath, keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), getSerialNumber(t, reloader))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.watch(ctx, 10*time.Millisecond)
+
+	// A broken certificate keeps the current one in use
+	require.NoError(t, os.WriteFile(certPath, []byte("invalid"), 0o600))
+	require.NoError(t, os.Chtimes(certPath, time.Now(), time.Now().Add(time.Second)))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(1), getSerialNumber(t, reloader))
+
+	writeCertificate(t, certPath, keyPath, 2)
+	require.NoError(t, os.Chtimes(certPath, time.Now(), time.Now().Add(2*time.Second)))
+	assert.Eventually(t, func() bool {
+		return getSerialNumber(t, reloader) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestACMEManager(t *testing.T) {
+	assert.Nil(t, getACMEManager())
+
+	t.Setenv(environment.ACMEDomains, "broadcast-box.test|www.broadcast-box.test")
+	t.Setenv(environment.ACMEDirectoryURL, "https://localhost:14000/dir")
+	t.Setenv(environment.ACMECacheDirectory, t.TempDir())
+
+	acmeManager := getACMEManager()
+	require.NotNil(t, acmeManager)
+	assert.Equal(t, "https://localhost:14000/dir", acmeManager.Client.DirectoryURL)
+	assert.NoError(t, acmeManager.HostPolicy(context.Background(), "www.broadcast-box.test"))
+	assert.Error(t, acmeManager.HostPolicy(context.Background(), "other.test"))
+
+	tlsConfig, err := getTLSConfig(acmeManager)
+	require.NoError(t, err)
+	assert.Contains(t, tlsConfig.NextProtos, acme.ALPNProto)
+	assert.NotNil(t, tlsConfig.GetCertificate)
+}
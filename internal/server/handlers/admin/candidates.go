@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc"
+)
+
+// Show the ICE candidates a new WHIP or WHEP PeerConnection would gather
+func CandidatesHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("GET", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var isWHIP bool
+	switch request.URL.Query().Get("type") {
+	case "whip":
+		isWHIP = true
+	case "", "whep":
+		isWHIP = false
+	default:
+		helpers.LogHTTPError(responseWriter, "type must be whip or whep", http.StatusBadRequest)
+		return
+	}
+
+	candidates, err := webrtc.GatherCandidates(isWHIP)
+	if err != nil {
+		slog.Error("API.Admin.Candidates", "err", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(responseWriter).Encode(candidates); err != nil {
+		slog.Error("API.Admin.Candidates Encode Error", "err", err)
+	}
+}
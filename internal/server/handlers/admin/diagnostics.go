@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/networktest"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+)
+
+// Run the network diagnostics and return the report
+func DiagnosticsHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	// The checks can take longer than HTTP_WRITE_TIMEOUT
+	if err := http.NewResponseController(responseWriter).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Error("API.Admin.Diagnostics SetWriteDeadline error", "err", err)
+	}
+
+	report, err := networktest.RunDiagnostics()
+	if errors.Is(err, networktest.ErrDiagnosticsRunning) {
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		slog.Error("API.Admin.Diagnostics", "err", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(responseWriter).Encode(report); err != nil {
+		slog.Error("API.Admin.Diagnostics Encode Error", "err", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
 )
 
 // Retrieve all existing profiles
@@ -126,3 +127,72 @@ func ProfileRemoveHandler(responseWriter http.ResponseWriter, request *http.Requ
 
 	responseWriter.WriteHeader(http.StatusOK)
 }
+
+type adminProfileFallbackPayload struct {
+	StreamKey         string `json:"streamKey"`
+	FallbackStreamKey string `json:"fallbackStreamKey"`
+	FallbackMediaPath string `json:"fallbackMediaPath"`
+}
+
+// Set the fallback source of an existing stream profile
+func ProfileFallbackHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminProfileFallbackPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	if err := authorization.UpdateProfileFallback(payload.StreamKey, payload.FallbackStreamKey, payload.FallbackMediaPath); err != nil {
+		slog.Error("API.Admin.ProfileFallback", "err", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	manager.SessionsManager.UpdateProfileFallback(payload.StreamKey, payload.FallbackStreamKey, payload.FallbackMediaPath)
+
+	responseWriter.WriteHeader(http.StatusOK)
+}
+
+type adminProfilePublisherPolicyPayload struct {
+	StreamKey       string `json:"streamKey"`
+	PublisherPolicy string `json:"publisherPolicy"`
+}
+
+// Set how an existing stream profile handles a second publisher
+func ProfilePublisherPolicyHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminProfilePublisherPolicyPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	if err := authorization.UpdateProfilePublisherPolicy(payload.StreamKey, payload.PublisherPolicy); err != nil {
+		slog.Error("API.Admin.ProfilePublisherPolicy", "err", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	manager.SessionsManager.UpdateProfilePublisherPolicy(payload.StreamKey, payload.PublisherPolicy)
+
+	responseWriter.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+)
+
+type adminStagePayload struct {
+	StreamKey string `json:"streamKey"`
+	GuestID   string `json:"guestId"`
+}
+
+// Create a stage invite for a stream
+func StageInviteHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminStagePayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := manager.SessionsManager.CreateStageInvite(payload.StreamKey)
+	if err != nil {
+		slog.Error("API.Admin.StageInvite", "err", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(responseWriter).Encode(invite); err != nil {
+		slog.Error("API.Admin.StageInvite Encode Error", "err", err)
+	}
+}
+
+// Remove a guest from the stage of a stream
+func StageRemoveHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminStagePayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	if err := manager.SessionsManager.RemoveStageGuest(payload.StreamKey, payload.GuestID); err != nil {
+		slog.Error("API.Admin.StageRemove", "err", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseWriter.WriteHeader(http.StatusOK)
+}
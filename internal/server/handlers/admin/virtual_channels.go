@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+)
+
+type adminVirtualChannelPayload struct {
+	StreamKey       string    `json:"streamKey"`
+	SourceStreamKey string    `json:"sourceStreamKey"`
+	At              time.Time `json:"at"`
+}
+
+// Retrieve all virtual channels
+func VirtualChannelsHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("GET", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(responseWriter).Encode(manager.SessionsManager.GetVirtualChannelStates()); err != nil {
+		slog.Error("API.Admin.VirtualChannels Error", "err", err)
+	}
+}
+
+// Create a virtual channel or switch the source of an existing one
+func VirtualChannelSwitchHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminVirtualChannelPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil || payload.StreamKey == "" || payload.SourceStreamKey == "" {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	if err := manager.SessionsManager.SetVirtualChannelSource(payload.StreamKey, payload.SourceStreamKey); err != nil {
+		slog.Error("API.Admin.VirtualChannelSwitch", "err", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseWriter.WriteHeader(http.StatusOK)
+}
+
+// Schedule a source switch of an existing virtual channel
+func VirtualChannelScheduleHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminVirtualChannelPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil || payload.StreamKey == "" || payload.SourceStreamKey == "" || payload.At.IsZero() {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	if err := manager.SessionsManager.ScheduleVirtualChannelSource(payload.StreamKey, payload.SourceStreamKey, payload.At); err != nil {
+		slog.Error("API.Admin.VirtualChannelSchedule", "err", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseWriter.WriteHeader(http.StatusOK)
+}
+
+// Remove a virtual channel
+func VirtualChannelRemoveHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminVirtualChannelPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	if err := manager.SessionsManager.RemoveVirtualChannel(payload.StreamKey); err != nil {
+		slog.Error("API.Admin.VirtualChannelRemove", "err", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseWriter.WriteHeader(http.StatusOK)
+}
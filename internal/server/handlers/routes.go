@@ -6,64 +6,118 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"slices"
 	"strings"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
 	adminHandlers "github.com/glimesh/broadcast-box/internal/server/handlers/admin"
 	whipHandlers "github.com/glimesh/broadcast-box/internal/server/handlers/whip"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc"
+	"github.com/google/uuid"
 )
 
+const (
+	// Frontend assets and UI routes
+	RoutesFrontend = "frontend"
+	// WHIP, WHEP, SSE, status and log endpoints
+	RoutesAPI = "api"
+	// /api/admin endpoints
+	RoutesAdmin = "admin"
+)
+
+var AllRoutes = []string{RoutesFrontend, RoutesAPI, RoutesAdmin}
+
 func GetServeMuxHandler() http.HandlerFunc {
+	return GetServeMuxHandlerForRoutes(AllRoutes)
+}
+
+// Get a handler serving the provided route groups only
+func GetServeMuxHandlerForRoutes(routes []string) http.HandlerFunc {
 	serverMux := http.NewServeMux()
 
-	if os.Getenv(environment.FrontendDisabled) == "" {
+	if slices.Contains(routes, RoutesFrontend) && os.Getenv(environment.FrontendDisabled) == "" {
 		serverMux.HandleFunc("/", frontendHandler)
+
+		// API routes not served by this listener should not fall through to the frontend
+		serverMux.Handle("/api/", http.NotFoundHandler())
+	}
+
+	if slices.Contains(routes, RoutesAPI) {
+		registerAPIRoutes(serverMux)
 	}
 
+	if slices.Contains(routes, RoutesAdmin) {
+		registerAdminRoutes(serverMux)
+	}
+
+	// Path middleware
+	debugOutputWebRequests := os.Getenv(environment.DebugIncomingAPIRequest)
+	handler := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if strings.EqualFold(debugOutputWebRequests, "TRUE") {
+			slog.Info("Calling path", "path", request.URL.Path)
+			_, pattern := serverMux.Handler(request)
+
+			if pattern == "" {
+				slog.Info("Unmatched path", "path", request.URL.Path)
+			} else {
+				slog.Info("Found pattern", "pattern", pattern)
+			}
+		}
+
+		serverMux.ServeHTTP(responseWriter, request)
+	})
+
+	return handler
+}
+
+func registerAPIRoutes(serverMux *http.ServeMux) {
 	// WHIP/WHEP shared endpoints
-	serverMux.HandleFunc("/api/whep", corsHandler(whepHandler))
-	serverMux.HandleFunc("/api/whep/", corsHandler(whepHandler))
+	serverMux.HandleFunc("/api/whep", iceServersCorsHandler(whepHandler))
+	serverMux.HandleFunc("/api/whep/", iceServersCorsHandler(whepHandler))
 	serverMux.HandleFunc("/api/sse/", corsHandler(sseHandler))
 
 	// WHIP session endpoints
-	serverMux.HandleFunc("/api/whip", corsHandler(whipHandlers.WHIPHandler))
-	serverMux.HandleFunc("/api/whip/", corsHandler(whipHandlers.WHIPHandler))
+	serverMux.HandleFunc("/api/whip", iceServersCorsHandler(whipHandlers.WHIPHandler))
+	serverMux.HandleFunc("/api/whip/", iceServersCorsHandler(whipHandlers.WHIPHandler))
 	serverMux.HandleFunc("/api/whip/profile", corsHandler(whipHandlers.ProfileHandler))
+	serverMux.HandleFunc("/api/whip/stage", corsHandler(whipHandlers.StageHandler))
+	serverMux.HandleFunc("/api/whip/stage/", corsHandler(whipHandlers.StageHandler))
 
 	// WHEP session endpoints
 	serverMux.HandleFunc("/api/layer/", corsHandler(layerChangeHandler))
 
+	// Fragmented MP4 playback for viewers without an ICE path
+	serverMux.HandleFunc("/api/websocket/", webSocketHandler)
+
+	// Virtual channel endpoints
+	serverMux.HandleFunc("/api/virtual-channel/", corsHandler(virtualChannelSwitchHandler))
+
 	// Logging and status endpoints
 	serverMux.HandleFunc("/api/log", corsHandler(logHandler))
 	serverMux.HandleFunc("/api/status", corsHandler(statusHandler))
+}
 
+func registerAdminRoutes(serverMux *http.ServeMux) {
 	// Admin endpoints
 	serverMux.HandleFunc("/api/admin/login", corsHandler(adminHandlers.LoginHandler))
 	serverMux.HandleFunc("/api/admin/status", corsHandler(adminHandlers.StatusHandler))
+	serverMux.HandleFunc("/api/admin/candidates", corsHandler(adminHandlers.CandidatesHandler))
+	serverMux.HandleFunc("/api/admin/diagnostics", corsHandler(adminHandlers.DiagnosticsHandler))
+	serverMux.HandleFunc("/api/admin/udp-mux", corsHandler(adminHandlers.UDPMuxHandler))
 	serverMux.HandleFunc("/api/admin/logging", corsHandler(adminHandlers.LoggingHandler))
 	serverMux.HandleFunc("/api/admin/profiles", corsHandler(adminHandlers.ProfilesHandler))
 	serverMux.HandleFunc("/api/admin/profiles/reset-token", corsHandler(adminHandlers.ProfilesResetTokenHandler))
 	serverMux.HandleFunc("/api/admin/profiles/add-profile", corsHandler(adminHandlers.ProfileAddHandler))
 	serverMux.HandleFunc("/api/admin/profiles/remove-profile", corsHandler(adminHandlers.ProfileRemoveHandler))
-
-	// Path middleware
-	debugOutputWebRequests := os.Getenv(environment.DebugIncomingAPIRequest)
-	handler := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
-		if strings.EqualFold(debugOutputWebRequests, "TRUE") {
-			slog.Info("Calling path", "path", request.URL.Path)
-			_, pattern := serverMux.Handler(request)
-
-			if pattern == "" {
-				slog.Info("Unmatched path", "path", request.URL.Path)
-			} else {
-				slog.Info("Found pattern", "pattern", pattern)
-			}
-		}
-
-		serverMux.ServeHTTP(responseWriter, request)
-	})
-
-	return handler
+	serverMux.HandleFunc("/api/admin/profiles/fallback", corsHandler(adminHandlers.ProfileFallbackHandler))
+	serverMux.HandleFunc("/api/admin/profiles/publisher-policy", corsHandler(adminHandlers.ProfilePublisherPolicyHandler))
+	serverMux.HandleFunc("/api/admin/stage/invite", corsHandler(adminHandlers.StageInviteHandler))
+	serverMux.HandleFunc("/api/admin/stage/remove", corsHandler(adminHandlers.StageRemoveHandler))
+	serverMux.HandleFunc("/api/admin/virtual-channels", corsHandler(adminHandlers.VirtualChannelsHandler))
+	serverMux.HandleFunc("/api/admin/virtual-channels/switch", corsHandler(adminHandlers.VirtualChannelSwitchHandler))
+	serverMux.HandleFunc("/api/admin/virtual-channels/schedule", corsHandler(adminHandlers.VirtualChannelScheduleHandler))
+	serverMux.HandleFunc("/api/admin/virtual-channels/remove", corsHandler(adminHandlers.VirtualChannelRemoveHandler))
 }
 
 func RedirectToHttpsHandler(httpWriter http.ResponseWriter, request *http.Request) {
@@ -83,6 +137,19 @@ func corsHandler(next func(responseWriter http.ResponseWriter, request *http.Req
 	}
 }
 
+// Same as corsHandler, OPTIONS requests are also answered with the ICE servers clients should use
+func iceServersCorsHandler(next func(responseWriter http.ResponseWriter, request *http.Request)) http.HandlerFunc {
+	cors := corsHandler(next)
+
+	return func(response http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodOptions {
+			helpers.AddICEServerLinks(response.Header(), webrtc.GetICEServers(uuid.New().String()))
+		}
+
+		cors(response, request)
+	}
+}
+
 func frontendHandler(response http.ResponseWriter, request *http.Request) {
 	frontendFilePath := environment.GetFrontendPath()
 
@@ -12,6 +12,7 @@ import (
 	"github.com/glimesh/broadcast-box/internal/environment"
 	"github.com/glimesh/broadcast-box/internal/server/helpers"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 )
 
 func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
@@ -75,11 +76,27 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 			return
 		}
 
-		host := streamSession.Host.Load()
+		host := streamSession.ActiveHost()
 		if host != nil && !writeEvent(host.GetAvailableLayersEvent()) {
 			return
 		}
 
+		stateChanged := streamSession.StateChanged()
+		if !writeEvent(streamSession.GetStreamStateEvent()) {
+			return
+		}
+
+		stageChanged := streamSession.StageChanged()
+		if !writeEvent(streamSession.GetStageEvent()) {
+			return
+		}
+
+		candidatesChanged := whepSession.Candidates.Changed()
+		candidatesEvent, candidatesOffset := whepSession.Candidates.GetCandidatesEvent(0)
+		if candidatesEvent != "" && !writeEvent(candidatesEvent) {
+			return
+		}
+
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
@@ -88,6 +105,22 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 			case <-ctx.Done():
 				slog.Info("API.SSE: Client disconnected")
 				return
+			case <-stateChanged:
+				stateChanged = streamSession.StateChanged()
+				if !writeEvent(streamSession.GetStreamStateEvent()) {
+					return
+				}
+			case <-stageChanged:
+				stageChanged = streamSession.StageChanged()
+				if !writeEvent(streamSession.GetStageEvent()) {
+					return
+				}
+			case <-candidatesChanged:
+				candidatesChanged = whepSession.Candidates.Changed()
+				candidatesEvent, candidatesOffset = whepSession.Candidates.GetCandidatesEvent(candidatesOffset)
+				if candidatesEvent != "" && !writeEvent(candidatesEvent) {
+					return
+				}
 			case <-ticker.C:
 				if whepSession.IsSessionClosed.Load() {
 					return
@@ -97,7 +130,7 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 					return
 				}
 
-				host := streamSession.Host.Load()
+				host := streamSession.ActiveHost()
 				if host != nil && !writeEvent(host.GetAvailableLayersEvent()) {
 					return
 				}
@@ -110,6 +143,26 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 			return
 		}
 
+		var candidates *utils.CandidateCollector
+		var layerDemandChanged <-chan struct{}
+		host := streamSession.GetPublisher(sessionID)
+		if host != nil {
+			candidates = host.Candidates
+			layerDemandChanged = host.LayerDemandChanged()
+		}
+
+		candidatesChanged := candidates.Changed()
+		candidatesEvent, candidatesOffset := candidates.GetCandidatesEvent(0)
+		if candidatesEvent != "" && !writeEvent(candidatesEvent) {
+			return
+		}
+
+		if host != nil {
+			if layerDemandEvent := host.GetLayerDemandEvent(); layerDemandEvent != "" && !writeEvent(layerDemandEvent) {
+				return
+			}
+		}
+
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
@@ -118,6 +171,17 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 			case <-ctx.Done():
 				slog.Info("API.SSE: Client disconnected")
 				return
+			case <-candidatesChanged:
+				candidatesChanged = candidates.Changed()
+				candidatesEvent, candidatesOffset = candidates.GetCandidatesEvent(candidatesOffset)
+				if candidatesEvent != "" && !writeEvent(candidatesEvent) {
+					return
+				}
+			case <-layerDemandChanged:
+				layerDemandChanged = host.LayerDemandChanged()
+				if !writeEvent(host.GetLayerDemandEvent()) {
+					return
+				}
 			case <-ticker.C:
 				if !writeEvent(streamSession.GetSessionStatsEvent()) {
 					return
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+)
+
+type virtualChannelSwitchJSON struct {
+	SourceStreamKey string `json:"sourceStreamKey"`
+}
+
+// Switches the source of a virtual channel from an external system such as a scheduler or production switcher.
+// Requests are authorized with the VIRTUAL_CHANNEL_WEBHOOK_TOKEN bearer token.
+func virtualChannelSwitchHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		helpers.LogHTTPError(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	webhookToken := os.Getenv(environment.VirtualChannelWebhookToken)
+	token := helpers.ResolveBearerToken(request.Header.Get("Authorization"))
+	if webhookToken == "" || token == "" || subtle.ConstantTimeCompare([]byte(webhookToken), []byte(token)) != 1 {
+		helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
+		return
+	}
+
+	streamKey := strings.TrimPrefix(request.URL.Path, "/api/virtual-channel/")
+	if streamKey == "" || strings.Contains(streamKey, "/") {
+		helpers.LogHTTPError(responseWriter, "Missing stream key", http.StatusBadRequest)
+		return
+	}
+
+	var requestContent virtualChannelSwitchJSON
+	if err := json.NewDecoder(request.Body).Decode(&requestContent); err != nil || requestContent.SourceStreamKey == "" {
+		helpers.LogHTTPError(responseWriter, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	slog.Info("API.VirtualChannel.Switch", "streamKey", streamKey, "sourceStreamKey", requestContent.SourceStreamKey)
+	if err := manager.SessionsManager.SetVirtualChannelSource(streamKey, requestContent.SourceStreamKey); err != nil {
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseWriter.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/server/webhook"
+	"github.com/glimesh/broadcast-box/internal/webrtc"
+	"github.com/glimesh/broadcast-box/internal/webrtc/fmp4"
+	"golang.org/x/net/websocket"
+)
+
+const webSocketWriteTimeout = 10 * time.Second
+
+// Text message sent before the init segment and when the viewer is closed by the server
+type webSocketMessage struct {
+	MimeType string `json:"mimeType,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Writes the MIME type as a text message and the init segment and fragments as binary messages
+type webSocketOutput struct {
+	conn *websocket.Conn
+}
+
+func (o *webSocketOutput) WriteMimeType(mimeType string) error {
+	return o.send(webSocketMessage{MimeType: mimeType})
+}
+
+func (o *webSocketOutput) WriteSegment(segment []byte) error {
+	if err := o.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout)); err != nil {
+		return err
+	}
+
+	return websocket.Message.Send(o.conn, segment)
+}
+
+func (o *webSocketOutput) send(message webSocketMessage) error {
+	if err := o.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout)); err != nil {
+		return err
+	}
+
+	return websocket.JSON.Send(o.conn, message)
+}
+
+// Stream fragmented MP4 of /api/websocket/<streamKey> for Media Source Extensions playback
+func webSocketHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	streamKey, ok := getViewerStreamKey(responseWriter, request, "/api/websocket/")
+	if !ok {
+		return
+	}
+
+	layer := request.URL.Query().Get("layer")
+
+	// Browsers connect from any origin, like the CORS headers of the other endpoints allow
+	server := websocket.Server{
+		Handler: func(conn *websocket.Conn) {
+			serveWebSocketViewer(conn, streamKey, layer)
+		},
+	}
+	server.ServeHTTP(responseWriter, request)
+}
+
+// Get the stream key of a viewer path, authorized by the webhook like WHEP viewers. Writes the error response if invalid.
+func getViewerStreamKey(responseWriter http.ResponseWriter, request *http.Request, pathPrefix string) (string, bool) {
+	streamKey := strings.TrimPrefix(request.URL.Path, pathPrefix)
+	if streamKey == "" || strings.Contains(streamKey, "/") {
+		helpers.LogHTTPError(responseWriter, "Invalid stream key", http.StatusBadRequest)
+		return "", false
+	}
+
+	if webhookURL := os.Getenv(environment.WebhookURL); webhookURL != "" {
+		var err error
+		streamKey, err = webhook.CallWebhook(webhookURL, webhook.WHEPConnect, streamKey, request)
+		if err != nil {
+			helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
+			return "", false
+		}
+	}
+
+	return streamKey, true
+}
+
+func serveWebSocketViewer(conn *websocket.Conn, streamKey string, layer string) {
+	defer func() {
+		if err := conn.Close(); err != nil {
+			slog.Debug("API.WebSocket Close error", "err", err)
+		}
+	}()
+
+	// The hijacked connection keeps the deadlines of the HTTP server
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		slog.Error("API.WebSocket SetDeadline error", "err", err)
+		return
+	}
+
+	output := &webSocketOutput{conn: conn}
+	whepSession, muxer, err := webrtc.WebSocket(streamKey, layer, output)
+	if err != nil {
+		slog.Error("API.WebSocket: Setup Error", "err", err)
+		_ = output.send(webSocketMessage{Error: err.Error()})
+		return
+	}
+
+	slog.Info("API.WebSocket: Viewer connected", "streamKey", streamKey, "sessionID", whepSession.SessionID, "layer", layer)
+	defer whepSession.Close()
+
+	// Viewers send nothing, reading returns once the connection is closed
+	go func() {
+		var message []byte
+		for websocket.Message.Receive(conn, &message) == nil {
+		}
+
+		whepSession.Close()
+	}()
+
+	<-whepSession.Done()
+	slog.Info("API.WebSocket: Viewer disconnected", "sessionID", whepSession.SessionID)
+
+	if err := muxer.Err(); errors.Is(err, fmp4.ErrUnsupportedCodec) {
+		_ = output.send(webSocketMessage{Error: fmp4.ErrUnsupportedCodec.Error()})
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc"
+	"github.com/glimesh/broadcast-box/internal/webrtc/moq"
+	"github.com/quic-go/webtransport-go"
+)
+
+const (
+	webTransportOpenStreamTimeout = 5 * time.Second
+
+	// Session closed because the publisher's video codec can not be sent
+	webTransportErrorUnsupportedCodec webtransport.SessionErrorCode = 1
+	// Session closed because the viewer could not be added to the stream
+	webTransportErrorSetup webtransport.SessionErrorCode = 2
+
+	// Group stream reset because the viewer did not receive it in time
+	webTransportErrorGroupDropped webtransport.StreamErrorCode = 1
+)
+
+// Opens a unidirectional stream of the WebTransport session for each group
+type webTransportOutput struct {
+	session *webtransport.Session
+}
+
+func (o *webTransportOutput) OpenGroupStream() (moq.GroupStream, error) {
+	ctx, cancel := context.WithTimeout(o.session.Context(), webTransportOpenStreamTimeout)
+	defer cancel()
+
+	stream, err := o.session.OpenUniStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return webTransportGroupStream{stream}, nil
+}
+
+type webTransportGroupStream struct {
+	*webtransport.SendStream
+}
+
+func (s webTransportGroupStream) Cancel() {
+	s.CancelWrite(webTransportErrorGroupDropped)
+}
+
+// Get the handler of the HTTP/3 server, which serves WebTransport sessions upgraded by server only
+func GetWebTransportHandler(server *webtransport.Server) http.Handler {
+	serverMux := http.NewServeMux()
+	serverMux.HandleFunc("/api/webtransport/", func(responseWriter http.ResponseWriter, request *http.Request) {
+		webTransportHandler(server, responseWriter, request)
+	})
+
+	return serverMux
+}
+
+// Send the tracks of /api/webtransport/<streamKey> as MoQ tracks over a WebTransport session
+func webTransportHandler(server *webtransport.Server, responseWriter http.ResponseWriter, request *http.Request) {
+	streamKey, ok := getViewerStreamKey(responseWriter, request, "/api/webtransport/")
+	if !ok {
+		return
+	}
+
+	session, err := server.Upgrade(responseWriter, request)
+	if err != nil {
+		helpers.LogHTTPError(responseWriter, "WebTransport upgrade failed", http.StatusBadRequest)
+		slog.Debug("API.WebTransport: Upgrade error", "err", err)
+		return
+	}
+
+	layer := request.URL.Query().Get("layer")
+	whepSession, publisher, err := webrtc.WebTransport(streamKey, layer, &webTransportOutput{session: session})
+	if err != nil {
+		slog.Error("API.WebTransport: Setup Error", "err", err)
+		_ = session.CloseWithError(webTransportErrorSetup, err.Error())
+		return
+	}
+
+	slog.Info("API.WebTransport: Viewer connected", "streamKey", streamKey, "sessionID", whepSession.SessionID, "layer", layer)
+
+	select {
+	case <-whepSession.Done():
+	case <-session.Context().Done():
+	}
+
+	whepSession.Close()
+	slog.Info("API.WebTransport: Viewer disconnected", "sessionID", whepSession.SessionID)
+
+	if err := publisher.Err(); errors.Is(err, moq.ErrUnsupportedCodec) {
+		_ = session.CloseWithError(webTransportErrorUnsupportedCodec, moq.ErrUnsupportedCodec.Error())
+		return
+	}
+
+	_ = session.CloseWithError(0, "")
+}
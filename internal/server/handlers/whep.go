@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -17,37 +19,51 @@ import (
 )
 
 func whepHandler(responseWriter http.ResponseWriter, request *http.Request) {
-	if request.Method != http.MethodPost && request.Method != http.MethodPatch {
+	sessionID := getSessionIDFromWHEPPath(request.URL.Path)
+
+	// The endpoint creates sessions, the session resource is read, patched or deleted
+	if sessionID == "" && request.Method != http.MethodPost {
+		responseWriter.Header().Set("Allow", http.MethodPost)
+		helpers.LogHTTPError(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	} else if sessionID != "" && request.Method != http.MethodGet && request.Method != http.MethodPatch && request.Method != http.MethodDelete {
+		responseWriter.Header().Set("Allow", "GET, PATCH, DELETE")
 		helpers.LogHTTPError(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	offer, err := io.ReadAll(request.Body)
-	if err != nil || string(offer) == "" {
-		helpers.LogHTTPError(responseWriter, "error reading offer", http.StatusBadRequest)
+	if request.Method == http.MethodGet {
+		if err := whepCandidatesHandler(responseWriter, sessionID); err != nil {
+			slog.Error("API.WHEP.Get Error", "err", err)
+			helpers.LogHTTPError(responseWriter, err.Error(), helpers.GetSessionErrorStatus(err))
+		}
+
 		return
 	}
 
-	if request.Method == http.MethodPatch {
-		if err := utils.ValidateOffer(string(offer)); err != nil {
-			helpers.LogHTTPError(responseWriter, "invalid offer: "+err.Error(), http.StatusBadRequest)
+	if request.Method == http.MethodDelete {
+		slog.Info("API.WHEP.Delete: Removing session", "sessionID", sessionID)
+		if err := webrtc.HandleWHEPDelete(sessionID); err != nil {
+			slog.Error("API.WHEP.Delete Error", "err", err)
+			helpers.LogHTTPError(responseWriter, err.Error(), helpers.GetSessionErrorStatus(err))
 			return
 		}
 
-		path := strings.Replace(request.URL.Path, "/api/whep", "", 1)
-		segments := strings.Split(path, "/")
-		sessionID := strings.TrimSpace(segments[len(segments)-1])
+		responseWriter.WriteHeader(http.StatusOK)
+		return
+	}
 
-		if sessionID == "" {
-			slog.Info("API.WHEP.Patch Error: Missing session id")
-			helpers.LogHTTPError(responseWriter, "Missing session id", http.StatusBadRequest)
-			return
-		}
+	offer, err := io.ReadAll(request.Body)
+	if err != nil || string(offer) == "" {
+		helpers.LogHTTPError(responseWriter, "error reading offer", http.StatusBadRequest)
+		return
+	}
 
+	if request.Method == http.MethodPatch {
 		slog.Info("API.WHEP.Patch: Patching session", "sessionID", sessionID)
 		if err := patchHandler(responseWriter, request, sessionID, string(offer)); err != nil {
 			slog.Error("API.WHEP.Patch Error", "err", err)
-			helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+			helpers.LogHTTPError(responseWriter, err.Error(), helpers.GetSessionErrorStatus(err))
 		}
 
 		return
@@ -76,8 +92,10 @@ func whepHandler(responseWriter http.ResponseWriter, request *http.Request) {
 
 	responseWriter.Header().Add("Link", `<`+"/api/sse/"+sessionID+`>; rel="urn:ietf:params:whep:ext:core:server-sent-events"; events="layers"`)
 	responseWriter.Header().Add("Link", `<`+"/api/layer/"+sessionID+`>; rel="urn:ietf:params:whep:ext:core:layer"`)
+	helpers.AddICEServerLinks(responseWriter.Header(), webrtc.GetICEServers(sessionID))
 
 	responseWriter.Header().Add("Location", "/api/whep/"+sessionID)
+	responseWriter.Header().Add("ETag", webrtc.GetETag(whipAnswer))
 	responseWriter.Header().Add("Content-Type", "application/sdp")
 	responseWriter.WriteHeader(http.StatusCreated)
 
@@ -90,12 +108,28 @@ func whepHandler(responseWriter http.ResponseWriter, request *http.Request) {
 
 func patchHandler(res http.ResponseWriter, r *http.Request, sessionID, body string) error {
 	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
-	if err != nil || mediaType != "application/trickle-ice-sdpfrag" {
+	if err == nil && mediaType == "application/json" {
+		return mediaPausedHandler(res, sessionID, body, r.Header.Get("If-Match"))
+	} else if err != nil || mediaType != "application/trickle-ice-sdpfrag" {
 		helpers.LogHTTPError(res, "invalid content type", http.StatusUnsupportedMediaType)
 		return err
 	}
 
-	if err = webrtc.HandleWHEPPatch(sessionID, body); err != nil {
+	if err = utils.ValidateSDPFragment(body); err != nil {
+		return err
+	}
+
+	answer, err := webrtc.HandleWHEPPatch(sessionID, body, r.Header.Get("If-Match"))
+	if err != nil {
+		return err
+	}
+
+	// An ICE restart is answered with the new server credentials and candidates
+	if answer != "" {
+		res.Header().Set("ETag", webrtc.GetETag(answer))
+		res.Header().Set("Content-Type", "application/trickle-ice-sdpfrag")
+		res.WriteHeader(http.StatusOK)
+		_, err = fmt.Fprint(res, answer)
 		return err
 	}
 
@@ -103,3 +137,51 @@ func patchHandler(res http.ResponseWriter, r *http.Request, sessionID, body stri
 
 	return nil
 }
+
+// Largest pause or resume payload accepted in a PATCH
+const maxMediaPausedPayloadSize = 1024
+
+var errMediaPausedPayloadTooLarge = errors.New("pause payload is too large")
+
+type whepMediaPausedPayload struct {
+	Kind   string `json:"kind"`
+	Paused bool   `json:"paused"`
+}
+
+// Pause or resume the media of a viewer, if ifMatch matches its current ICE session
+func mediaPausedHandler(res http.ResponseWriter, sessionID, body, ifMatch string) error {
+	if len(body) > maxMediaPausedPayloadSize {
+		return errMediaPausedPayloadTooLarge
+	}
+
+	var payload whepMediaPausedPayload
+	if err := json.Unmarshal([]byte(body), &payload); err != nil {
+		return err
+	}
+
+	if err := webrtc.HandleWHEPMediaPaused(sessionID, payload.Kind, payload.Paused, ifMatch); err != nil {
+		return err
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Returns the server candidates gathered so far, for clients that received the answer before gathering completed
+func whepCandidatesHandler(res http.ResponseWriter, sessionID string) error {
+	fragment, err := webrtc.GetWHEPCandidates(sessionID)
+	if err != nil {
+		return err
+	}
+
+	res.Header().Set("Content-Type", "application/trickle-ice-sdpfrag")
+	res.WriteHeader(http.StatusOK)
+	_, err = fmt.Fprint(res, fragment)
+	return err
+}
+
+func getSessionIDFromWHEPPath(path string) string {
+	path = strings.Replace(path, "/api/whep", "", 1)
+	segments := strings.Split(path, "/")
+	return strings.TrimSpace(segments[len(segments)-1])
+}
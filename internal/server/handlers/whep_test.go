@@ -2,12 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	pionWebrtc "github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type whepWebhookPayload struct {
@@ -64,3 +70,99 @@ func TestWHEPHandlerCallsWebhook(t *testing.T) {
 		t.Fatal("expected webhook to be called")
 	}
 }
+
+func TestWHEPHandlerResourceMethods(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "/api/whep", nil)
+	resp := httptest.NewRecorder()
+	whepHandler(resp, req)
+
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, resp.Code)
+	}
+
+	if allow := resp.Header().Get("Allow"); allow != http.MethodPost {
+		t.Fatalf("expected Allow %q, got %q", http.MethodPost, allow)
+	}
+
+	manager.SessionsManager = &manager.SessionManager{}
+	req = httptest.NewRequest(http.MethodDelete, "/api/whep/unknown-session", nil)
+	resp = httptest.NewRecorder()
+	whepHandler(resp, req)
+
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, resp.Code)
+	}
+}
+
+// Keep the lines of a session description that make up a trickle ICE sdpfrag
+func getSDPFragment(sessionDescription string) string {
+	fragment := ""
+	for line := range strings.SplitSeq(sessionDescription, "\r\n") {
+		if strings.HasPrefix(line, "a=ice-ufrag:") || strings.HasPrefix(line, "a=ice-pwd:") || strings.HasPrefix(line, "m=") || strings.HasPrefix(line, "a=mid:") {
+			fragment += line + "\r\n"
+		}
+	}
+
+	return fragment
+}
+
+func TestWHEPHandlerPatchRestartsICE(t *testing.T) {
+	webrtc.Setup(nil)
+
+	client, err := pionWebrtc.NewPeerConnection(pionWebrtc.Configuration{})
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	_, err = client.AddTransceiverFromKind(pionWebrtc.RTPCodecTypeVideo, pionWebrtc.RTPTransceiverInit{Direction: pionWebrtc.RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+
+	offer, err := client.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, client.SetLocalDescription(offer))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/whep", strings.NewReader(offer.SDP))
+	req.Header.Set("Authorization", "Bearer ice_restart_stream")
+	resp := httptest.NewRecorder()
+	whepHandler(resp, req)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	answer := resp.Body.String()
+	require.NoError(t, client.SetRemoteDescription(pionWebrtc.SessionDescription{Type: pionWebrtc.SDPTypeAnswer, SDP: answer}))
+
+	// Pausing media and malformed sdpfrags are checked like ICE restarts
+	for _, patch := range []struct {
+		contentType string
+		body        string
+		ifMatch     string
+		status      int
+	}{
+		{"application/json", `{"kind":"video","paused":true}`, `"stale"`, http.StatusPreconditionFailed},
+		{"application/json", `{"kind":"video","paused":true}`, resp.Header().Get("ETag"), http.StatusNoContent},
+		{"application/trickle-ice-sdpfrag", "not an sdpfrag", resp.Header().Get("ETag"), http.StatusBadRequest},
+	} {
+		req = httptest.NewRequest(http.MethodPatch, resp.Header().Get("Location"), strings.NewReader(patch.body))
+		req.Header.Set("Content-Type", patch.contentType)
+		req.Header.Set("If-Match", patch.ifMatch)
+		patchResp := httptest.NewRecorder()
+		whepHandler(patchResp, req)
+		assert.Equal(t, patch.status, patchResp.Code, patch.body)
+	}
+
+	restartOffer, err := client.CreateOffer(&pionWebrtc.OfferOptions{ICERestart: true})
+	require.NoError(t, err)
+	require.NoError(t, client.SetLocalDescription(restartOffer))
+
+	req = httptest.NewRequest(http.MethodPatch, resp.Header().Get("Location"), strings.NewReader(getSDPFragment(restartOffer.SDP)))
+	req.Header.Set("Content-Type", "application/trickle-ice-sdpfrag")
+	req.Header.Set("If-Match", resp.Header().Get("ETag"))
+	resp = httptest.NewRecorder()
+	whepHandler(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	// The answer carries the new server credentials
+	answerFragment, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "application/trickle-ice-sdpfrag", resp.Header().Get("Content-Type"))
+	assert.Contains(t, string(answerFragment), "a=ice-ufrag:")
+	assert.NotEqual(t, webrtc.GetETag(answer), resp.Header().Get("ETag"))
+}
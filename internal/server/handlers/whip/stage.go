@@ -0,0 +1,96 @@
+package whip
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+)
+
+// Lets the host invite guests to the stage, list and remove them.
+// Requests are authorized with the bearer token the host publishes with.
+func StageHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	streamKey, ok := resolveHostStreamKey(helpers.ResolveBearerToken(request.Header.Get("Authorization")))
+	if !ok {
+		helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
+		return
+	}
+
+	guestID := strings.Trim(strings.TrimPrefix(request.URL.Path, "/api/whip/stage"), "/")
+
+	switch {
+	case guestID == "" && request.Method == http.MethodPost:
+		invite, err := manager.SessionsManager.CreateStageInvite(streamKey)
+		if err != nil {
+			helpers.LogHTTPError(responseWriter, err.Error(), getStageErrorStatus(err))
+			return
+		}
+
+		slog.Info("API.WHIP.Stage: Invite created", "streamKey", streamKey)
+		responseWriter.Header().Set("Content-Type", "application/json")
+		responseWriter.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(responseWriter).Encode(invite); err != nil {
+			slog.Error("API.WHIP.Stage Encode Error", "err", err)
+		}
+
+	case guestID == "" && request.Method == http.MethodGet:
+		guests, err := manager.SessionsManager.GetStageGuests(streamKey)
+		if err != nil {
+			helpers.LogHTTPError(responseWriter, err.Error(), getStageErrorStatus(err))
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(responseWriter).Encode(guests); err != nil {
+			slog.Error("API.WHIP.Stage Encode Error", "err", err)
+		}
+
+	case guestID != "" && request.Method == http.MethodDelete:
+		if err := manager.SessionsManager.RemoveStageGuest(streamKey, guestID); err != nil {
+			helpers.LogHTTPError(responseWriter, err.Error(), getStageErrorStatus(err))
+			return
+		}
+
+		slog.Info("API.WHIP.Stage: Guest removed", "streamKey", streamKey, "guestID", guestID)
+		responseWriter.WriteHeader(http.StatusNoContent)
+
+	default:
+		helpers.LogHTTPError(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Resolve the stream key the bearer token publishes to
+func resolveHostStreamKey(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+
+	if profile, err := authorization.GetPublicProfile(token); err == nil && profile != nil {
+		return profile.StreamKey, true
+	}
+
+	if os.Getenv(environment.StreamProfilePolicy) == authorization.StreamPolicyReservedOnly || authorization.IsProfileReserved(token) {
+		return "", false
+	}
+
+	return token, true
+}
+
+func getStageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, manager.ErrStreamNotFound), errors.Is(err, session.ErrStageGuestNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, session.ErrStageFull), errors.Is(err, session.ErrStageOffline):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
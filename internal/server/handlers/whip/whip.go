@@ -14,10 +14,19 @@ import (
 	"github.com/glimesh/broadcast-box/internal/server/helpers"
 	"github.com/glimesh/broadcast-box/internal/server/webhook"
 	"github.com/glimesh/broadcast-box/internal/webrtc"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 )
 
 func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
-	if request.Method != http.MethodPost && request.Method != http.MethodPatch && request.Method != http.MethodDelete {
+	sessionID := getSessionIDFromWHIPPath(request.URL.Path)
+
+	// The endpoint creates sessions, the session resource is read, patched or deleted
+	if sessionID == "" && request.Method != http.MethodPost {
+		responseWriter.Header().Set("Allow", http.MethodPost)
+		helpers.LogHTTPError(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	} else if sessionID != "" && request.Method != http.MethodGet && request.Method != http.MethodPatch && request.Method != http.MethodDelete {
+		responseWriter.Header().Set("Allow", "GET, PATCH, DELETE")
 		helpers.LogHTTPError(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -38,18 +47,19 @@ func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
 	}
 
 	if request.Method == http.MethodDelete {
-		sessionID := getSessionIDFromWHIPPath(request.URL.Path)
-
-		if sessionID == "" {
-			slog.Info("API.WHIP.Delete Error: Missing session id")
-			helpers.LogHTTPError(responseWriter, "Missing session id", http.StatusBadRequest)
-			return
-		}
-
 		slog.Info("API.WHIP.Delete: Removing session", "sessionID", sessionID)
 		if err := deleteHandler(responseWriter, sessionID); err != nil {
 			slog.Error("API.WHIP.Delete Error", "err", err)
-			helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+			helpers.LogHTTPError(responseWriter, err.Error(), helpers.GetSessionErrorStatus(err))
+		}
+
+		return
+	}
+
+	if request.Method == http.MethodGet {
+		if err := candidatesHandler(responseWriter, sessionID); err != nil {
+			slog.Error("API.WHIP.Get Error", "err", err)
+			helpers.LogHTTPError(responseWriter, err.Error(), helpers.GetSessionErrorStatus(err))
 		}
 
 		return
@@ -62,6 +72,23 @@ func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	// The session resource is patched without running the stream profile policy and webhook again
+	if request.Method == http.MethodPatch {
+		slog.Info("API.WHIP.Patch: Patching session", "sessionID", sessionID)
+		if err := patchHandler(responseWriter, request, sessionID, string(offer)); err != nil {
+			slog.Error("API.WHIP.Patch Error:", "err", err)
+			helpers.LogHTTPError(responseWriter, err.Error(), helpers.GetSessionErrorStatus(err))
+		}
+
+		return
+	}
+
+	// Guests invited to the stage publish with their invite token
+	if webrtc.IsStageInvite(token) {
+		stageGuestHandler(responseWriter, string(offer), token)
+		return
+	}
+
 	var userProfile authorization.PublicProfile
 
 	// Stream profile policy
@@ -118,31 +145,6 @@ func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		}
 	}
 
-	if request.Method == http.MethodPatch {
-
-		if contentType := request.Header.Get("Content-Type"); contentType != "application/trickle-ice-sdpfrag" {
-			slog.Info("API.WHIP.Patch Error: Invalid patch request")
-			helpers.LogHTTPError(responseWriter, "Invalid patch request", http.StatusBadRequest)
-			return
-		}
-
-		sessionID := getSessionIDFromWHIPPath(request.URL.Path)
-
-		if sessionID == "" {
-			slog.Info("API.WHIP.Patch Error: Missing session id")
-			helpers.LogHTTPError(responseWriter, "Missing session id", http.StatusBadRequest)
-			return
-		}
-
-		slog.Info("API.WHIP.Patch: Patching session", "sessionID", sessionID)
-		if err := patchHandler(responseWriter, request, sessionID, string(offer)); err != nil {
-			slog.Error("API.WHIP.Patch Error:", "err", err)
-			helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
-		}
-
-		return
-	}
-
 	whipAnswer, sessionID, err := webrtc.WHIP(string(offer), userProfile)
 	if err != nil {
 		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
@@ -150,7 +152,9 @@ func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
 	}
 
 	responseWriter.Header().Add("Link", `<`+"/api/sse/"+sessionID+`>; rel="urn:ietf:params:whep:ext:core:server-sent-events"; events="status"`)
+	helpers.AddICEServerLinks(responseWriter.Header(), webrtc.GetICEServers(sessionID))
 	responseWriter.Header().Add("Location", "/api/whip/"+sessionID)
+	responseWriter.Header().Add("ETag", webrtc.GetETag(whipAnswer))
 	responseWriter.Header().Add("Content-Type", "application/sdp")
 	responseWriter.WriteHeader(http.StatusCreated)
 
@@ -162,6 +166,26 @@ func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
 
 }
 
+func stageGuestHandler(responseWriter http.ResponseWriter, offer string, token string) {
+	whipAnswer, sessionID, err := webrtc.WHIPStageGuest(offer, token)
+	if err != nil {
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	helpers.AddICEServerLinks(responseWriter.Header(), webrtc.GetICEServers(sessionID))
+	responseWriter.Header().Add("Location", "/api/whip/"+sessionID)
+	responseWriter.Header().Add("ETag", webrtc.GetETag(whipAnswer))
+	responseWriter.Header().Add("Content-Type", "application/sdp")
+	responseWriter.WriteHeader(http.StatusCreated)
+
+	if _, err = fmt.Fprint(responseWriter, whipAnswer); err != nil {
+		slog.Error("API.WHIP.StageGuest Error", "err", err)
+	} else {
+		slog.Info("API.WHIP.StageGuest Completed")
+	}
+}
+
 func patchHandler(res http.ResponseWriter, r *http.Request, sessionID, body string) error {
 	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 	if err != nil || mediaType != "application/trickle-ice-sdpfrag" {
@@ -169,7 +193,21 @@ func patchHandler(res http.ResponseWriter, r *http.Request, sessionID, body stri
 		return err
 	}
 
-	if err = webrtc.HandleWHIPPatch(sessionID, body); err != nil {
+	if err = utils.ValidateSDPFragment(body); err != nil {
+		return err
+	}
+
+	answer, err := webrtc.HandleWHIPPatch(sessionID, body, r.Header.Get("If-Match"))
+	if err != nil {
+		return err
+	}
+
+	// An ICE restart is answered with the new server credentials and candidates
+	if answer != "" {
+		res.Header().Set("ETag", webrtc.GetETag(answer))
+		res.Header().Set("Content-Type", "application/trickle-ice-sdpfrag")
+		res.WriteHeader(http.StatusOK)
+		_, err = fmt.Fprint(res, answer)
 		return err
 	}
 
@@ -178,12 +216,25 @@ func patchHandler(res http.ResponseWriter, r *http.Request, sessionID, body stri
 	return nil
 }
 
+// Returns the server candidates gathered so far, for clients that received the answer before gathering completed
+func candidatesHandler(res http.ResponseWriter, sessionID string) error {
+	fragment, err := webrtc.GetWHIPCandidates(sessionID)
+	if err != nil {
+		return err
+	}
+
+	res.Header().Set("Content-Type", "application/trickle-ice-sdpfrag")
+	res.WriteHeader(http.StatusOK)
+	_, err = fmt.Fprint(res, fragment)
+	return err
+}
+
 func deleteHandler(res http.ResponseWriter, sessionID string) error {
 	if err := webrtc.HandleWHIPDelete(sessionID); err != nil {
 		return err
 	}
 
-	res.WriteHeader(http.StatusNoContent)
+	res.WriteHeader(http.StatusOK)
 
 	return nil
 }
@@ -9,6 +9,9 @@ import (
 
 	"github.com/glimesh/broadcast-box/internal/environment"
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	pionWebrtc "github.com/pion/webrtc/v4"
 	"github.com/stretchr/testify/require"
 )
 
@@ -38,6 +41,7 @@ func TestWHIPHandlerWebhookUsesResolvedStreamKey(t *testing.T) {
 	defer server.Close()
 
 	t.Setenv(environment.WebhookURL, server.URL)
+	manager.SessionsManager = &manager.SessionManager{}
 
 	req := httptest.NewRequest(http.MethodPost, "/api/whip", strings.NewReader("v=0"))
 	req.Header.Set("Authorization", "Bearer "+bearerToken)
@@ -55,3 +59,59 @@ func TestWHIPHandlerWebhookUsesResolvedStreamKey(t *testing.T) {
 		require.Fail(t, "expected webhook to be called")
 	}
 }
+
+func TestWHIPHandlerSessionResource(t *testing.T) {
+	t.Setenv(environment.StreamProfilePath, t.TempDir())
+	webrtc.Setup(nil)
+
+	client, err := pionWebrtc.NewPeerConnection(pionWebrtc.Configuration{})
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	_, err = client.AddTransceiverFromKind(pionWebrtc.RTPCodecTypeVideo, pionWebrtc.RTPTransceiverInit{Direction: pionWebrtc.RTPTransceiverDirectionSendonly})
+	require.NoError(t, err)
+
+	offer, err := client.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, client.SetLocalDescription(offer))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/whip", strings.NewReader(offer.SDP))
+	req.Header.Set("Authorization", "Bearer resource_stream")
+	resp := httptest.NewRecorder()
+	WHIPHandler(resp, req)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	location := resp.Header().Get("Location")
+
+	// Patching the session does not ask the webhook again
+	webhookCalled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookCalled = true
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	t.Setenv(environment.WebhookURL, server.URL)
+
+	parsedOffer, err := offer.Unmarshal()
+	require.NoError(t, err)
+	ufrag, _ := parsedOffer.MediaDescriptions[0].Attribute("ice-ufrag")
+
+	req = httptest.NewRequest(http.MethodPatch, location, strings.NewReader("a=ice-ufrag:"+ufrag+"\r\n"))
+	req.Header.Set("Authorization", "Bearer resource_stream")
+	req.Header.Set("Content-Type", "application/trickle-ice-sdpfrag")
+	resp = httptest.NewRecorder()
+	WHIPHandler(resp, req)
+	require.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+	require.False(t, webhookCalled)
+
+	req = httptest.NewRequest(http.MethodDelete, location, nil)
+	req.Header.Set("Authorization", "Bearer resource_stream")
+	resp = httptest.NewRecorder()
+	WHIPHandler(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	req = httptest.NewRequest(http.MethodDelete, location, nil)
+	req.Header.Set("Authorization", "Bearer resource_stream")
+	resp = httptest.NewRecorder()
+	WHIPHandler(resp, req)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+// Get the IP of the client that made the request.
+// X-Forwarded-For is only used when the request comes from a trusted proxy or a Unix socket, the client is the
+// right-most address that is not a trusted proxy itself.
+func GetClientIP(request *http.Request) string {
+	remoteIP := request.RemoteAddr
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+
+	trustedProxies := getTrustedProxies()
+
+	// Unix socket peers have no IP and are local reverse proxies
+	isUnixSocket := net.ParseIP(remoteIP) == nil
+	if !isUnixSocket && !isTrustedProxy(trustedProxies, remoteIP) {
+		return remoteIP
+	}
+
+	forwardedFor := []string{}
+	for _, header := range request.Header.Values("X-Forwarded-For") {
+		for address := range strings.SplitSeq(header, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				forwardedFor = append(forwardedFor, address)
+			}
+		}
+	}
+
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		if net.ParseIP(forwardedFor[i]) == nil {
+			break
+		}
+
+		if i == 0 || !isTrustedProxy(trustedProxies, forwardedFor[i]) {
+			return forwardedFor[i]
+		}
+	}
+
+	return remoteIP
+}
+
+func getTrustedProxies() (networks []*net.IPNet) {
+	for entry := range strings.SplitSeq(os.Getenv(environment.TrustedProxies), "|") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			slog.Error("Invalid trusted proxy", "value", entry, "err", err)
+			continue
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+func isTrustedProxy(trustedProxies []*net.IPNet, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetClientIP(t *testing.T) {
+	t.Setenv(environment.TrustedProxies, "10.0.0.0/8|2001:db8::1")
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "Direct connection",
+			remoteAddr: "203.0.113.5:4000",
+			want:       "203.0.113.5",
+		},
+		{
+			name:         "Untrusted proxy header is ignored",
+			remoteAddr:   "203.0.113.5:4000",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "203.0.113.5",
+		},
+		{
+			name:         "Trusted proxy",
+			remoteAddr:   "10.1.2.3:4000",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "Trusted IPv6 proxy",
+			remoteAddr:   "[2001:db8::1]:4000",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "Spoofed addresses left of the first untrusted address are ignored",
+			remoteAddr:   "10.1.2.3:4000",
+			forwardedFor: []string{"192.0.2.9, 198.51.100.1", "10.0.0.7"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "Only trusted proxies",
+			remoteAddr:   "10.1.2.3:4000",
+			forwardedFor: []string{"10.0.0.8, 10.0.0.7"},
+			want:         "10.0.0.8",
+		},
+		{
+			name:         "Invalid forwarded address",
+			remoteAddr:   "10.1.2.3:4000",
+			forwardedFor: []string{"unknown"},
+			want:         "10.1.2.3",
+		},
+		{
+			name:         "Unix socket",
+			remoteAddr:   "@",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/api/whip", nil)
+			request.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+
+			assert.Equal(t, tt.want, GetClientIP(request))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package helpers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Advertise ICE servers to WHIP and WHEP clients with a Link header per URL
+func AddICEServerLinks(header http.Header, iceServers []webrtc.ICEServer) {
+	for _, iceServer := range iceServers {
+		credential, _ := iceServer.Credential.(string)
+
+		for _, url := range iceServer.URLs {
+			link := "<" + url + `>; rel="ice-server"`
+			if iceServer.Username != "" {
+				link += "; username=" + strconv.Quote(iceServer.Username) +
+					"; credential=" + strconv.Quote(credential) +
+					`; credential-type="password"`
+			}
+
+			header.Add("Link", link)
+		}
+	}
+}
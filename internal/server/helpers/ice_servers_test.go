@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddICEServerLinks(t *testing.T) {
+	header := http.Header{}
+	AddICEServerLinks(header, []webrtc.ICEServer{
+		{URLs: []string{"stun:stun.example.net"}},
+		{
+			URLs:       []string{"turn:turn.example.net?transport=udp", "turns:turn.example.net?transport=tcp"},
+			Username:   "1700000000:viewer",
+			Credential: "secret",
+		},
+	})
+
+	assert.Equal(t, []string{
+		`<stun:stun.example.net>; rel="ice-server"`,
+		`<turn:turn.example.net?transport=udp>; rel="ice-server"; username="1700000000:viewer"; credential="secret"; credential-type="password"`,
+		`<turns:turn.example.net?transport=tcp>; rel="ice-server"; username="1700000000:viewer"; credential="secret"; credential-type="password"`,
+	}, header.Values("Link"))
+}
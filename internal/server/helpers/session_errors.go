@@ -0,0 +1,20 @@
+package helpers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc"
+)
+
+// Map WHIP and WHEP session lookup errors to their HTTP status
+func GetSessionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, webrtc.ErrSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, webrtc.ErrETagMismatch):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/glimesh/broadcast-box/internal/environment"
 	"github.com/glimesh/broadcast-box/internal/server/handlers"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 var (
@@ -14,19 +15,6 @@ var (
 	defaultHTTPRedirectAddress string = ":80"
 )
 
-func startHTTPServer(serverMux http.HandlerFunc) {
-	server := &http.Server{
-		Handler: serverMux,
-		Addr:    getHTTPAddress(),
-	}
-
-	slog.Info("Starting HTTP", "address", getHTTPAddress())
-	if err := server.ListenAndServe(); err != nil {
-		slog.Error("Server closed with error", "err", err)
-		os.Exit(1)
-	}
-}
-
 func getHTTPAddress() string {
 	if httpAddress := os.Getenv(environment.HTTPAddress); httpAddress != "" {
 		return httpAddress
@@ -35,29 +23,36 @@ func getHTTPAddress() string {
 	return defaultHTTPAddress
 }
 
-func setupHTTPRedirect() {
-	if shouldRedirectToHTTPS := os.Getenv(environment.HTTPEnableRedirect); shouldRedirectToHTTPS != "" {
-		httpRedirectPort := defaultHTTPRedirectAddress
+// Redirect HTTP to HTTPS if enabled, ACME HTTP-01 challenges are answered on the same listener
+func setupHTTPRedirect(acmeManager *autocert.Manager) {
+	shouldRedirectToHTTPS := os.Getenv(environment.HTTPEnableRedirect) != ""
+	if !shouldRedirectToHTTPS && acmeManager == nil {
+		return
+	}
 
-		if httpRedirectPortEnvVar := os.Getenv(environment.HTTPSRedirectPort); httpRedirectPortEnvVar != "" {
-			httpRedirectPort = httpRedirectPortEnvVar
-		}
+	httpRedirectPort := defaultHTTPRedirectAddress
 
-		go func() {
-			slog.Info("Setting up HTTP Redirecting")
+	if httpRedirectPortEnvVar := os.Getenv(environment.HTTPSRedirectPort); httpRedirectPortEnvVar != "" {
+		httpRedirectPort = httpRedirectPortEnvVar
+	}
 
-			redirectServer := &http.Server{
-				Addr:    httpRedirectPort,
-				Handler: http.HandlerFunc(handlers.RedirectToHttpsHandler),
-			}
+	var handler http.Handler = http.HandlerFunc(handlers.RedirectToHttpsHandler)
+	if acmeManager != nil {
+		handler = acmeManager.HTTPHandler(handler)
+	}
 
-			slog.Info("Forwarding requests to HTTPS server", "address", redirectServer.Addr)
-			err := redirectServer.ListenAndServe()
+	go func() {
+		slog.Info("Setting up HTTP Redirecting")
 
-			if err != nil {
-				slog.Error("Redirect Server closed with error", "err", err)
-				os.Exit(1)
-			}
-		}()
-	}
+		redirectServer := newHTTPServer(handler)
+		redirectServer.Addr = httpRedirectPort
+
+		slog.Info("Forwarding requests to HTTPS server", "address", redirectServer.Addr)
+		err := redirectServer.ListenAndServe()
+
+		if err != nil {
+			slog.Error("Redirect Server closed with error", "err", err)
+			os.Exit(1)
+		}
+	}()
 }
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/handlers"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	listenerSchemeHTTP  = "http"
+	listenerSchemeHTTPS = "https"
+	listenerSchemeUnix  = "unix"
+
+	defaultReadTimeout       = 30 * time.Second
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+)
+
+var errInvalidListener = errors.New("listeners must be formatted as http://<address>, https://<address> or unix://<path>")
+
+type listener struct {
+	scheme  string
+	address string
+	routes  []string
+}
+
+// Get the listeners of LISTENERS, delineated by |.
+// Without LISTENERS a single HTTP or HTTPS listener serving all routes is used on HTTP_ADDRESS.
+func getListeners(isTLSConfigured bool) ([]listener, error) {
+	value := os.Getenv(environment.HTTPListeners)
+	if value == "" {
+		if isTLSConfigured {
+			return []listener{{scheme: listenerSchemeHTTPS, address: getHTTPSAddress(), routes: handlers.AllRoutes}}, nil
+		}
+
+		return []listener{{scheme: listenerSchemeHTTP, address: getHTTPAddress(), routes: handlers.AllRoutes}}, nil
+	}
+
+	listeners := []listener{}
+	for entry := range strings.SplitSeq(value, "|") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		parsed, err := parseListener(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if parsed.scheme == listenerSchemeHTTPS && !isTLSConfigured {
+			return nil, fmt.Errorf("%s: %w", entry, errMissingCertificate)
+		}
+
+		listeners = append(listeners, parsed)
+	}
+
+	return listeners, nil
+}
+
+// Parse a listener such as https://:443?routes=frontend,api or unix:///run/broadcast-box.sock
+func parseListener(value string) (listener, error) {
+	listenerURL, err := url.Parse(value)
+	if err != nil {
+		return listener{}, errors.Join(errInvalidListener, err)
+	}
+
+	parsed := listener{
+		scheme:  listenerURL.Scheme,
+		address: listenerURL.Host,
+		routes:  handlers.AllRoutes,
+	}
+
+	switch parsed.scheme {
+	case listenerSchemeHTTP, listenerSchemeHTTPS:
+	case listenerSchemeUnix:
+		parsed.address = listenerURL.Host + listenerURL.Path
+	default:
+		return listener{}, fmt.Errorf("%w: %s", errInvalidListener, value)
+	}
+
+	if parsed.address == "" {
+		return listener{}, fmt.Errorf("%w: %s", errInvalidListener, value)
+	}
+
+	if routes := listenerURL.Query().Get("routes"); routes != "" {
+		parsed.routes = strings.Split(routes, ",")
+		for _, route := range parsed.routes {
+			if !slices.Contains(handlers.AllRoutes, route) {
+				return listener{}, fmt.Errorf("%s: unknown routes %s, expected one of %v", value, route, handlers.AllRoutes)
+			}
+		}
+	}
+
+	return parsed, nil
+}
+
+// Serve all listeners, returns once one of them failed
+func serveListeners(listeners []listener, tlsConfig *tls.Config) error {
+	errs := make(chan error, len(listeners))
+
+	for _, current := range listeners {
+		netListener, err := listen(current, tlsConfig)
+		if err != nil {
+			return err
+		}
+
+		server := newHTTPServer(handlers.GetServeMuxHandlerForRoutes(current.routes))
+		slog.Info("Serving "+strings.ToUpper(current.scheme), "address", current.address, "routes", current.routes)
+
+		go func() {
+			errs <- fmt.Errorf("%s://%s: %w", current.scheme, current.address, server.Serve(netListener))
+		}()
+	}
+
+	return <-errs
+}
+
+func listen(current listener, tlsConfig *tls.Config) (net.Listener, error) {
+	switch current.scheme {
+	case listenerSchemeUnix:
+		// A socket left behind by a previous run would fail the listen
+		if err := os.Remove(current.address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		return net.Listen("unix", current.address)
+	case listenerSchemeHTTPS:
+		netListener, err := net.Listen("tcp", current.address)
+		if err != nil {
+			return nil, err
+		}
+
+		return tls.NewListener(netListener, tlsConfig), nil
+	default:
+		return net.Listen("tcp", current.address)
+	}
+}
+
+// Create a server with the configured timeouts, long-lived responses such as SSE clear their write deadline
+func newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       getServerTimeout(environment.HTTPReadTimeout, defaultReadTimeout),
+		ReadHeaderTimeout: getServerTimeout(environment.HTTPReadHeaderTimeout, defaultReadHeaderTimeout),
+		WriteTimeout:      getServerTimeout(environment.HTTPWriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       getServerTimeout(environment.HTTPIdleTimeout, defaultIdleTimeout),
+	}
+}
+
+func getServerTimeout(variable string, defaultTimeout time.Duration) time.Duration {
+	value := os.Getenv(variable)
+	if value == "" {
+		return defaultTimeout
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Error("Invalid server timeout", "variable", variable, "value", value, "err", err)
+		return defaultTimeout
+	}
+
+	return timeout
+}
+
+// Use the TLS configuration for HTTPS listeners, nil if neither ACME nor SSL_CERT and SSL_KEY are configured
+func getListenerTLSConfig(acmeManager *autocert.Manager) (*tls.Config, error) {
+	if acmeManager == nil && (os.Getenv(environment.SSLKey) == "" || os.Getenv(environment.SSLCert) == "") {
+		return nil, nil
+	}
+
+	return getTLSConfig(acmeManager)
+}
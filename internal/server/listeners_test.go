@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetListeners(t *testing.T) {
+	listeners, err := getListeners(false)
+	require.NoError(t, err)
+	assert.Equal(t, []listener{{scheme: listenerSchemeHTTP, address: defaultHTTPAddress, routes: handlers.AllRoutes}}, listeners)
+
+	listeners, err = getListeners(true)
+	require.NoError(t, err)
+	assert.Equal(t, []listener{{scheme: listenerSchemeHTTPS, address: defaultHTTPSAddress, routes: handlers.AllRoutes}}, listeners)
+
+	t.Setenv(environment.HTTPListeners, "https://:443?routes=frontend,api|http://10.0.0.5:9000?routes=admin|unix:///run/broadcast-box.sock")
+	listeners, err = getListeners(true)
+	require.NoError(t, err)
+	assert.Equal(t, []listener{
+		{scheme: listenerSchemeHTTPS, address: ":443", routes: []string{handlers.RoutesFrontend, handlers.RoutesAPI}},
+		{scheme: listenerSchemeHTTP, address: "10.0.0.5:9000", routes: []string{handlers.RoutesAdmin}},
+		{scheme: listenerSchemeUnix, address: "/run/broadcast-box.sock", routes: handlers.AllRoutes},
+	}, listeners)
+
+	_, err = getListeners(false)
+	assert.ErrorIs(t, err, errMissingCertificate)
+
+	for _, value := range []string{"tcp://:8080", "http://", "http://:8080?routes=metrics"} {
+		t.Setenv(environment.HTTPListeners, value)
+		_, err = getListeners(true)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestListenerRoutes(t *testing.T) {
+	t.Setenv(environment.FrontendDisabled, "true")
+
+	adminOnly := handlers.GetServeMuxHandlerForRoutes([]string{handlers.RoutesAdmin})
+
+	recorder := httptest.NewRecorder()
+	adminOnly.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	adminOnly.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/status", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
@@ -1,21 +1,49 @@
 package server
 
 import (
+	"log/slog"
 	"os"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
-	"github.com/glimesh/broadcast-box/internal/server/handlers"
+	"github.com/glimesh/broadcast-box/internal/turnserver"
 )
 
 // HTTP Setup
 func StartWebServer() {
-	setupHTTPRedirect()
+	if err := turnserver.Start(); err != nil {
+		slog.Error("Failed to start TURN server", "err", err)
+		os.Exit(1)
+	}
+
+	acmeManager := getACMEManager()
+	setupHTTPRedirect(acmeManager)
+
+	tlsConfig, err := getListenerTLSConfig(acmeManager)
+	if err != nil {
+		slog.Error("Failed to setup TLS", "err", err)
+		os.Exit(1)
+	}
 
-	serverMux := handlers.GetServeMuxHandler()
+	listeners, err := getListeners(tlsConfig != nil)
+	if err != nil {
+		slog.Error("Invalid listeners", "err", err)
+		os.Exit(1)
+	}
+
+	if address := os.Getenv(environment.WebTransportAddress); address != "" {
+		if tlsConfig == nil {
+			slog.Error("WebTransport requires TLS", "err", errMissingCertificate)
+			os.Exit(1)
+		}
+
+		go func() {
+			slog.Error("WebTransport server closed with error", "err", serveWebTransport(address, tlsConfig))
+			os.Exit(1)
+		}()
+	}
 
-	if os.Getenv(environment.SSLKey) != "" && os.Getenv(environment.SSLCert) != "" {
-		startHTTPSServer(serverMux)
-	} else {
-		startHTTPServer(serverMux)
+	if err := serveListeners(listeners, tlsConfig); err != nil {
+		slog.Error("Server closed with error", "err", err)
+		os.Exit(1)
 	}
 }
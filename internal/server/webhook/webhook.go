@@ -7,6 +7,8 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
 )
 
 const defaultTimeout = time.Second * 5
@@ -42,7 +44,7 @@ func CallWebhook(url string, action action, bearerToken string, request *http.Re
 
 	jsonPayload, err := json.Marshal(webhookPayload{
 		Action:      action,
-		IP:          getIPAddress(request),
+		IP:          helpers.GetClientIP(request),
 		BearerToken: bearerToken,
 		QueryParams: queryParams,
 		UserAgent:   request.UserAgent(),
@@ -85,10 +87,3 @@ func CallWebhook(url string, action action, bearerToken string, request *http.Re
 
 	return response.StreamKey, nil
 }
-
-func getIPAddress(r *http.Request) string {
-	if r.Header.Get("X-Forwarded-For") != "" {
-		return r.Header.Get("X-Forwarded-For")
-	}
-	return r.RemoteAddr
-}
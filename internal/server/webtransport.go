@@ -0,0 +1,39 @@
+package server
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/glimesh/broadcast-box/internal/server/handlers"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+// Serve WebTransport viewers over HTTP/3 on the UDP address
+func serveWebTransport(address string, tlsConfig *tls.Config) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Serving WebTransport", "address", address)
+	return newWebTransportServer(tlsConfig).Serve(conn)
+}
+
+func newWebTransportServer(tlsConfig *tls.Config) *webtransport.Server {
+	server := &webtransport.Server{
+		H3: &http3.Server{
+			TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+		},
+
+		// Browsers connect from any origin, like the CORS headers of the other endpoints allow
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+
+	webtransport.ConfigureHTTP3Server(server.H3)
+	server.H3.Handler = handlers.GetWebTransportHandler(server)
+
+	return server
+}
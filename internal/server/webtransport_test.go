@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/moq"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/pion/rtp"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type receivedObject struct {
+	header moq.GroupHeader
+	object moq.Object
+}
+
+// Connect a WebTransport viewer and read the objects of every group stream it receives
+func dialWebTransportViewer(t *testing.T, address string, streamKey string) <-chan receivedObject {
+	dialer := webtransport.Dialer{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h3"}},
+		QUICConfig:      &quic.Config{EnableDatagrams: true, EnableStreamResetPartialDelivery: true},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, session, err := dialer.Dial(ctx, "https://"+address+"/api/webtransport/"+streamKey, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = session.CloseWithError(0, "")
+		_ = dialer.Close()
+	})
+
+	objects := make(chan receivedObject, 64)
+	go func() {
+		for {
+			stream, err := session.AcceptUniStream(context.Background())
+			if err != nil {
+				return
+			}
+
+			go func() {
+				reader := bufio.NewReader(stream)
+				header, err := moq.ReadGroupHeader(reader)
+				if err != nil {
+					return
+				}
+
+				for {
+					object, err := moq.ReadObject(reader)
+					if err != nil {
+						return
+					}
+
+					objects <- receivedObject{header: header, object: object}
+				}
+			}()
+		}
+	}()
+
+	return objects
+}
+
+func TestWebTransportDeliversGroupsAndObjects(t *testing.T) {
+	manager.SessionsManager = &manager.SessionManager{}
+	manager.SessionsManager.Setup()
+
+	certPath, keyPath := filepath.Join(t.TempDir(), "cert.pem"), filepath.Join(t.TempDir(), "key.pem")
+	writeCertificate(t, certPath, keyPath, 1)
+	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := newWebTransportServer(&tls.Config{Certificates: []tls.Certificate{certificate}})
+	go func() {
+		_ = server.Serve(conn)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	objects := dialWebTransportViewer(t, conn.LocalAddr().String(), "webtransport-test")
+
+	var whepSession *whep.WHEPSession
+	require.Eventually(t, func() bool {
+		streamSession, ok := manager.SessionsManager.GetSessionByID("webtransport-test")
+		if !ok {
+			return false
+		}
+
+		streamSession.WHEPSessionsLock.RLock()
+		defer streamSession.WHEPSessionsLock.RUnlock()
+		for _, current := range streamSession.WHEPSessions {
+			whepSession = current
+		}
+
+		return whepSession != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, whep.TransportWebTransport, whepSession.Transport)
+
+	idr := []byte{0x65, 0x88, 0x84, 0x00}
+	nonIDR := []byte{0x41, 0x9a, 0x02}
+	sendVideo := func(payload []byte, isKeyframe bool) {
+		whepSession.SendVideoPacket(codecs.TrackPacket{
+			Packet:       &rtp.Packet{Header: rtp.Header{Marker: true}, Payload: payload},
+			Codec:        codecs.VideoTrackCodecH264,
+			IsKeyframe:   isKeyframe,
+			TimeDiff:     3000,
+			SequenceDiff: 1,
+		})
+	}
+
+	whepSession.SendAudioPacket(codecs.TrackPacket{Packet: &rtp.Packet{Payload: []byte{0xfc, 0xff}}})
+	sendVideo(idr, true)
+	sendVideo(nonIDR, false)
+	sendVideo(idr, true)
+	sendVideo(nonIDR, false)
+
+	// Groups are read concurrently, objects are ordered within their group only
+	received := map[moq.GroupHeader][]moq.Object{}
+	var catalog moq.Catalog
+	isComplete := func() bool {
+		return len(received[moq.GroupHeader{TrackAlias: moq.VideoTrackAlias, GroupID: 0}]) == 2 &&
+			len(received[moq.GroupHeader{TrackAlias: moq.VideoTrackAlias, GroupID: 1}]) == 2 &&
+			len(received[moq.GroupHeader{TrackAlias: moq.AudioTrackAlias, GroupID: 0}]) == 1 &&
+			len(catalog.Tracks) == 2
+	}
+
+	for !isComplete() {
+		select {
+		case current := <-objects:
+			received[current.header] = append(received[current.header], current.object)
+			if current.header.TrackAlias == moq.CatalogTrackAlias {
+				var next moq.Catalog
+				require.NoError(t, json.Unmarshal(current.object.Payload, &next))
+				if len(next.Tracks) > len(catalog.Tracks) {
+					catalog = next
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for objects, received %v", received)
+		}
+	}
+
+	assert.ElementsMatch(t, []moq.CatalogTrack{
+		{Name: moq.VideoTrackName, Alias: moq.VideoTrackAlias, Codec: "h264"},
+		{Name: moq.AudioTrackName, Alias: moq.AudioTrackAlias, Codec: "opus"},
+	}, catalog.Tracks)
+
+	audio := received[moq.GroupHeader{TrackAlias: moq.AudioTrackAlias, GroupID: 0}]
+	require.Len(t, audio, 1)
+	assert.Equal(t, []byte{0xfc, 0xff}, audio[0].Payload)
+
+	// One group per GOP with one object per frame, frames are Annex B access units
+	for groupID := range uint64(2) {
+		group := received[moq.GroupHeader{TrackAlias: moq.VideoTrackAlias, GroupID: groupID}]
+		require.Len(t, group, 2)
+		assert.Equal(t, uint64(0), group[0].ObjectID)
+		assert.Equal(t, append([]byte{0, 0, 0, 1}, idr...), group[0].Payload)
+		assert.Equal(t, uint64(1), group[1].ObjectID)
+		assert.Equal(t, append([]byte{0, 0, 0, 1}, nonIDR...), group[1].Payload)
+		assert.Greater(t, group[1].Timestamp, group[0].Timestamp)
+	}
+
+	streamSession, _ := manager.SessionsManager.GetSessionByID("webtransport-test")
+	assert.Equal(t, 1, streamSession.GetStreamStatus().WebTransportViewerCount)
+}
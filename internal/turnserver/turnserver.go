@@ -0,0 +1,247 @@
+package turnserver
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/pion/turn/v5"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	realm                = "broadcast-box"
+	defaultCredentialTTL = time.Hour
+)
+
+var (
+	errMissingRelayAddress = errors.New("TURN_PUBLIC_IP or NAT_1_TO_1_IP is required to relay traffic")
+	errMissingCertificate  = errors.New("TURN_TLS_ADDRESS requires SSL_CERT and SSL_KEY")
+
+	serverLock sync.RWMutex
+	server     *turn.Server
+	urls       []string
+	secret     string
+	ttl        time.Duration
+)
+
+// Start the embedded TURN server if any of its listener addresses is configured
+func Start() (err error) {
+	udpAddress := os.Getenv(environment.TURNUDPAddress)
+	tcpAddress := os.Getenv(environment.TURNTCPAddress)
+	tlsAddress := os.Getenv(environment.TURNTLSAddress)
+	if udpAddress == "" && tcpAddress == "" && tlsAddress == "" {
+		return nil
+	}
+
+	relayIP := getRelayIP()
+	if relayIP == nil {
+		return errMissingRelayAddress
+	}
+
+	host := os.Getenv(environment.TURNHost)
+	if host == "" {
+		host = relayIP.String()
+	}
+
+	relayAddressGenerator := &turn.RelayAddressGeneratorStatic{
+		RelayAddress: relayIP,
+		Address:      "0.0.0.0",
+	}
+
+	config := turn.ServerConfig{Realm: realm}
+	serverURLs := []string{}
+
+	// Listeners are owned by the TURN server once it started
+	defer func() {
+		if err != nil {
+			closeListeners(config)
+		}
+	}()
+
+	if udpAddress != "" {
+		packetConn, listenErr := net.ListenPacket("udp4", udpAddress)
+		if listenErr != nil {
+			return listenErr
+		}
+
+		config.PacketConnConfigs = append(config.PacketConnConfigs, turn.PacketConnConfig{
+			PacketConn:            packetConn,
+			RelayAddressGenerator: relayAddressGenerator,
+		})
+		serverURLs = append(serverURLs, "turn:"+net.JoinHostPort(host, getPort(packetConn.LocalAddr()))+"?transport=udp")
+	}
+
+	if tcpAddress != "" {
+		listener, listenErr := net.Listen("tcp4", tcpAddress)
+		if listenErr != nil {
+			return listenErr
+		}
+
+		config.ListenerConfigs = append(config.ListenerConfigs, turn.ListenerConfig{
+			Listener:              listener,
+			RelayAddressGenerator: relayAddressGenerator,
+		})
+		serverURLs = append(serverURLs, "turn:"+net.JoinHostPort(host, getPort(listener.Addr()))+"?transport=tcp")
+	}
+
+	if tlsAddress != "" {
+		sslCert := os.Getenv(environment.SSLCert)
+		sslKey := os.Getenv(environment.SSLKey)
+		if sslCert == "" || sslKey == "" {
+			return errMissingCertificate
+		}
+
+		cert, certErr := tls.LoadX509KeyPair(sslCert, sslKey)
+		if certErr != nil {
+			return certErr
+		}
+
+		listener, listenErr := tls.Listen("tcp4", tlsAddress, &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		})
+		if listenErr != nil {
+			return listenErr
+		}
+
+		config.ListenerConfigs = append(config.ListenerConfigs, turn.ListenerConfig{
+			Listener:              listener,
+			RelayAddressGenerator: relayAddressGenerator,
+		})
+		serverURLs = append(serverURLs, "turns:"+net.JoinHostPort(host, getPort(listener.Addr()))+"?transport=tcp")
+	}
+
+	sharedSecret, err := getSecret()
+	if err != nil {
+		return err
+	}
+	config.AuthHandler = turn.LongTermTURNRESTAuthHandler(sharedSecret, nil)
+
+	turnServer, err := turn.NewServer(config)
+	if err != nil {
+		return err
+	}
+
+	serverLock.Lock()
+	server = turnServer
+	urls = serverURLs
+	secret = sharedSecret
+	ttl = GetCredentialTTL()
+	serverLock.Unlock()
+
+	slog.Info("TURNServer.Start", "urls", serverURLs, "relayIP", relayIP.String())
+	return nil
+}
+
+// Stop the embedded TURN server
+func Stop() {
+	serverLock.Lock()
+	defer serverLock.Unlock()
+
+	if server == nil {
+		return
+	}
+
+	if err := server.Close(); err != nil {
+		slog.Error("TURNServer.Stop", "err", err)
+	}
+	server = nil
+	urls = nil
+}
+
+// Get the ICE servers of the embedded TURN server with time-limited credentials for the provided session,
+// nil if the TURN server is not running
+func GetICEServers(sessionID string) []webrtc.ICEServer {
+	serverLock.RLock()
+	defer serverLock.RUnlock()
+
+	if server == nil {
+		return nil
+	}
+
+	username, password, err := turn.GenerateLongTermTURNRESTCredentials(secret, sessionID, ttl)
+	if err != nil {
+		slog.Error("TURNServer.GetICEServers", "err", err)
+		return nil
+	}
+
+	return []webrtc.ICEServer{{
+		URLs:       urls,
+		Username:   username,
+		Credential: password,
+	}}
+}
+
+func closeListeners(config turn.ServerConfig) {
+	for _, packetConnConfig := range config.PacketConnConfigs {
+		if err := packetConnConfig.PacketConn.Close(); err != nil {
+			slog.Error("TURNServer.CloseListeners", "err", err)
+		}
+	}
+
+	for _, listenerConfig := range config.ListenerConfigs {
+		if err := listenerConfig.Listener.Close(); err != nil {
+			slog.Error("TURNServer.CloseListeners", "err", err)
+		}
+	}
+}
+
+func getRelayIP() net.IP {
+	if publicIP := os.Getenv(environment.TURNPublicIP); publicIP != "" {
+		return net.ParseIP(publicIP)
+	}
+
+	if natIPs := os.Getenv(environment.NAT1To1IP); natIPs != "" {
+		return net.ParseIP(strings.Split(natIPs, "|")[0])
+	}
+
+	return nil
+}
+
+// Use the configured shared secret, or a random one that only lives as long as the process
+func getSecret() (string, error) {
+	if sharedSecret := os.Getenv(environment.TURNSecret); sharedSecret != "" {
+		return sharedSecret, nil
+	}
+
+	randomSecret := make([]byte, 32)
+	if _, err := rand.Read(randomSecret); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(randomSecret), nil
+}
+
+// Get the time TURN credentials stay valid
+func GetCredentialTTL() time.Duration {
+	value := os.Getenv(environment.TURNCredentialTTL)
+	if value == "" {
+		return defaultCredentialTTL
+	}
+
+	credentialTTL, err := time.ParseDuration(value)
+	if err != nil || credentialTTL <= 0 {
+		slog.Error("TURNServer: Invalid credential TTL", "value", value, "err", err)
+		return defaultCredentialTTL
+	}
+
+	return credentialTTL
+}
+
+func getPort(address net.Addr) string {
+	_, port, err := net.SplitHostPort(address.String())
+	if err != nil {
+		return ""
+	}
+
+	return port
+}
@@ -0,0 +1,59 @@
+package turnserver
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/pion/turn/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTURNServerAllocation(t *testing.T) {
+	t.Setenv(environment.TURNUDPAddress, "127.0.0.1:0")
+	t.Setenv(environment.TURNPublicIP, "127.0.0.1")
+
+	require.NoError(t, Start())
+	defer Stop()
+
+	iceServers := GetICEServers("viewer")
+	require.Len(t, iceServers, 1)
+	require.Len(t, iceServers[0].URLs, 1)
+	assert.True(t, strings.HasSuffix(iceServers[0].Username, ":viewer"))
+
+	serverAddress := strings.TrimSuffix(strings.TrimPrefix(iceServers[0].URLs[0], "turn:"), "?transport=udp")
+	allocate := func(password string) error {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		client, err := turn.NewClient(&turn.ClientConfig{
+			STUNServerAddr: serverAddress,
+			TURNServerAddr: serverAddress,
+			Conn:           conn,
+			Username:       iceServers[0].Username,
+			Password:       password,
+			Realm:          realm,
+		})
+		require.NoError(t, err)
+		defer client.Close()
+		require.NoError(t, client.Listen())
+
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return err
+		}
+
+		return relayConn.Close()
+	}
+
+	assert.NoError(t, allocate(iceServers[0].Credential.(string)))
+	assert.Error(t, allocate("invalid"))
+}
+
+func TestTURNServerDisabled(t *testing.T) {
+	require.NoError(t, Start())
+	assert.Nil(t, GetICEServers("viewer"))
+}
@@ -0,0 +1,287 @@
+package webrtc
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/ip"
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	candidatePolicyError = "Configuration error: ICE candidate policy"
+	ipv4LocalAddresses   = "0.0.0.0/0"
+	ipv6LocalAddresses   = "::/0"
+)
+
+var (
+	errInvalidPortRange = errors.New("port range must be formatted as <min>-<max>")
+	errInvalidIPOrCIDR  = errors.New("invalid IP or CIDR")
+	errInvalidNATIP     = errors.New("invalid NAT IP")
+
+	ipv4NetworkTypes = []webrtc.NetworkType{webrtc.NetworkTypeUDP4, webrtc.NetworkTypeTCP4}
+	ipv6NetworkTypes = []webrtc.NetworkType{webrtc.NetworkTypeUDP6, webrtc.NetworkTypeTCP6}
+)
+
+// Apply the interface, IP, port range and ICE-lite settings that decide which candidates are gathered
+func setupCandidatePolicy(settingEngine *webrtc.SettingEngine, muxOpts *[]ice.UDPMuxFromPortOption) {
+	interfaceFilter, err := newInterfaceFilter(os.Getenv(environment.InterfaceFilter), os.Getenv(environment.InterfaceExclude))
+	if err != nil {
+		slog.Error(candidatePolicyError, "variable", environment.InterfaceFilter, "err", err)
+		os.Exit(1)
+	}
+
+	if interfaceFilter != nil {
+		settingEngine.SetInterfaceFilter(interfaceFilter)
+		*muxOpts = append(*muxOpts, ice.UDPMuxFromPortWithInterfaceFilter(interfaceFilter))
+	}
+
+	ipFilter, err := newIPFilter(os.Getenv(environment.ICEIPInclude), os.Getenv(environment.ICEIPExclude))
+	if err != nil {
+		slog.Error(candidatePolicyError, "variable", environment.ICEIPInclude, "err", err)
+		os.Exit(1)
+	}
+
+	if ipFilter != nil {
+		settingEngine.SetIPFilter(ipFilter)
+		*muxOpts = append(*muxOpts, ice.UDPMuxFromPortWithIPFilter(ipFilter))
+	}
+
+	if portRange := os.Getenv(environment.UDPPortRange); portRange != "" {
+		portMin, portMax, err := parsePortRange(portRange)
+		if err == nil {
+			err = settingEngine.SetEphemeralUDPPortRange(portMin, portMax)
+		}
+
+		if err != nil {
+			slog.Error(candidatePolicyError, "variable", environment.UDPPortRange, "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if isICELite() {
+		if os.Getenv(environment.NATICECandidateType) == "srflx" {
+			slog.Warn("ICE_LITE only gathers host candidates, NAT_ICE_CANDIDATE_TYPE=srflx is ignored")
+		}
+
+		settingEngine.SetLite(true)
+	}
+}
+
+func isICELite() bool {
+	return os.Getenv(environment.ICELite) != ""
+}
+
+// Interfaces are matched against glob patterns delineated by |, excluded interfaces take precedence
+func newInterfaceFilter(include string, exclude string) (func(string) bool, error) {
+	includePatterns, err := parseInterfacePatterns(include)
+	if err != nil {
+		return nil, err
+	}
+
+	excludePatterns, err := parseInterfacePatterns(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(includePatterns) == 0 && len(excludePatterns) == 0 {
+		return nil, nil
+	}
+
+	return func(interfaceName string) bool {
+		if matchesInterfacePattern(excludePatterns, interfaceName) {
+			return false
+		}
+
+		return len(includePatterns) == 0 || matchesInterfacePattern(includePatterns, interfaceName)
+	}, nil
+}
+
+func parseInterfacePatterns(value string) (patterns []string, err error) {
+	for pattern := range strings.SplitSeq(value, "|") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+func matchesInterfacePattern(patterns []string, interfaceName string) bool {
+	for _, pattern := range patterns {
+		if isMatch, _ := path.Match(pattern, interfaceName); isMatch {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Addresses are matched against IPs or CIDRs delineated by |, excluded addresses take precedence
+func newIPFilter(include string, exclude string) (func(net.IP) bool, error) {
+	includeNetworks, err := parseIPNetworks(include)
+	if err != nil {
+		return nil, err
+	}
+
+	excludeNetworks, err := parseIPNetworks(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(includeNetworks) == 0 && len(excludeNetworks) == 0 {
+		return nil, nil
+	}
+
+	return func(address net.IP) bool {
+		if containsIP(excludeNetworks, address) {
+			return false
+		}
+
+		return len(includeNetworks) == 0 || containsIP(includeNetworks, address)
+	}, nil
+}
+
+func parseIPNetworks(value string) (networks []*net.IPNet, err error) {
+	for entry := range strings.SplitSeq(value, "|") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			address := net.ParseIP(entry)
+			if address == nil {
+				return nil, errors.Join(errInvalidIPOrCIDR, errors.New(entry))
+			}
+
+			bits := 8 * net.IPv6len
+			if address.To4() != nil {
+				address, bits = address.To4(), 8*net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: address, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, errors.Join(errInvalidIPOrCIDR, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, address net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parsePortRange(value string) (portMin uint16, portMax uint16, err error) {
+	minValue, maxValue, isFound := strings.Cut(value, "-")
+	if !isFound {
+		return 0, 0, errInvalidPortRange
+	}
+
+	parsedMin, err := strconv.ParseUint(strings.TrimSpace(minValue), 10, 16)
+	if err != nil {
+		return 0, 0, errors.Join(errInvalidPortRange, err)
+	}
+
+	parsedMax, err := strconv.ParseUint(strings.TrimSpace(maxValue), 10, 16)
+	if err != nil {
+		return 0, 0, errors.Join(errInvalidPortRange, err)
+	}
+
+	if parsedMin == 0 || parsedMax < parsedMin {
+		return 0, 0, errInvalidPortRange
+	}
+
+	return uint16(parsedMin), uint16(parsedMax), nil
+}
+
+// Get the address rewrite rules of NAT_1_TO_1_IP and the per address family NAT mappings
+func getNATRewriteRules() ([]webrtc.ICEAddressRewriteRule, error) {
+	var (
+		natIps []string
+		rules  []webrtc.ICEAddressRewriteRule
+	)
+
+	natICECandidateType := webrtc.ICECandidateTypeHost
+	if os.Getenv(environment.NATICECandidateType) == "srflx" {
+		natICECandidateType = webrtc.ICECandidateTypeSrflx
+	}
+
+	// Without a discovered public IP only the configured NAT IPs are announced until a refresh succeeds
+	if os.Getenv(environment.IncludePublicIPInNAT1To1IP) != "" {
+		if publicIP := ip.GetPublicIP(); publicIP != "" {
+			natIps = append(natIps, publicIP)
+		}
+	}
+
+	if os.Getenv(environment.NAT1To1IP) != "" {
+		natIps = append(natIps, strings.Split(os.Getenv(environment.NAT1To1IP), "|")...)
+	}
+
+	if len(natIps) != 0 {
+		rules = append(rules, webrtc.ICEAddressRewriteRule{
+			External:        natIps,
+			AsCandidateType: natICECandidateType,
+			Mode:            webrtc.ICEAddressRewriteAppend,
+		})
+	}
+
+	// Candidates of one local address family may be announced on external IPs of either family
+	for _, family := range []struct {
+		variable       string
+		localAddresses string
+		networkTypes   []webrtc.NetworkType
+	}{
+		{environment.NAT1To1IPv4, ipv4LocalAddresses, ipv4NetworkTypes},
+		{environment.NAT1To1IPv6, ipv6LocalAddresses, ipv6NetworkTypes},
+	} {
+		value := os.Getenv(family.variable)
+		if value == "" {
+			continue
+		}
+
+		external := strings.Split(value, "|")
+		for _, externalIP := range external {
+			if net.ParseIP(externalIP) == nil {
+				return nil, errors.Join(errInvalidNATIP, errors.New(family.variable+": "+externalIP))
+			}
+		}
+
+		rules = append(rules, webrtc.ICEAddressRewriteRule{
+			External:        external,
+			CIDR:            family.localAddresses,
+			AsCandidateType: natICECandidateType,
+			Mode:            webrtc.ICEAddressRewriteAppend,
+			Networks:        family.networkTypes,
+		})
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,115 @@
+package webrtc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterfaceFilter(t *testing.T) {
+	filter, err := newInterfaceFilter("", "")
+	require.NoError(t, err)
+	assert.Nil(t, filter)
+
+	filter, err = newInterfaceFilter("eth*|ens*", "eth1")
+	require.NoError(t, err)
+	assert.True(t, filter("eth0"))
+	assert.True(t, filter("ens3"))
+	assert.False(t, filter("eth1"))
+	assert.False(t, filter("docker0"))
+
+	filter, err = newInterfaceFilter("", "docker*|veth*")
+	require.NoError(t, err)
+	assert.True(t, filter("eth0"))
+	assert.False(t, filter("veth1234"))
+
+	_, err = newInterfaceFilter("eth[", "")
+	assert.Error(t, err)
+}
+
+func TestIPFilter(t *testing.T) {
+	filter, err := newIPFilter("203.0.113.0/24|2001:db8::1", "203.0.113.7")
+	require.NoError(t, err)
+	assert.True(t, filter(net.ParseIP("203.0.113.1")))
+	assert.False(t, filter(net.ParseIP("203.0.113.7")))
+	assert.True(t, filter(net.ParseIP("2001:db8::1")))
+	assert.False(t, filter(net.ParseIP("2001:db8::2")))
+	assert.False(t, filter(net.ParseIP("10.0.0.1")))
+
+	filter, err = newIPFilter("", "10.0.0.0/8|fd00::/8")
+	require.NoError(t, err)
+	assert.False(t, filter(net.ParseIP("10.1.2.3")))
+	assert.False(t, filter(net.ParseIP("fd00::1")))
+	assert.True(t, filter(net.ParseIP("198.51.100.1")))
+
+	_, err = newIPFilter("not-an-ip", "")
+	assert.ErrorIs(t, err, errInvalidIPOrCIDR)
+}
+
+func TestParsePortRange(t *testing.T) {
+	portMin, portMax, err := parsePortRange("50000-50100")
+	require.NoError(t, err)
+	assert.Equal(t, uint16(50000), portMin)
+	assert.Equal(t, uint16(50100), portMax)
+
+	for _, value := range []string{"50000", "50100-50000", "0-10", "a-b", "1-70000"} {
+		_, _, err := parsePortRange(value)
+		assert.ErrorIs(t, err, errInvalidPortRange, value)
+	}
+}
+
+func TestNATRewriteRules(t *testing.T) {
+	t.Setenv(environment.NAT1To1IP, "198.51.100.1")
+	t.Setenv(environment.NAT1To1IPv6, "198.51.100.2|2001:db8::1")
+
+	rules, err := getNATRewriteRules()
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, []string{"198.51.100.1"}, rules[0].External)
+	assert.Empty(t, rules[0].CIDR)
+	assert.Equal(t, []string{"198.51.100.2", "2001:db8::1"}, rules[1].External)
+	assert.Equal(t, ipv6LocalAddresses, rules[1].CIDR)
+	assert.Equal(t, ipv6NetworkTypes, rules[1].Networks)
+
+	var settingEngine webrtc.SettingEngine
+	assert.NoError(t, settingEngine.SetICEAddressRewriteRules(rules...))
+
+	t.Setenv(environment.NAT1To1IPv4, "invalid")
+	_, err = getNATRewriteRules()
+	assert.ErrorIs(t, err, errInvalidNATIP)
+
+	// Invalid NAT rules are returned instead of exiting, a public IP refresh keeps the current APIs
+	_, err = getSettingEngine(false, 0, map[string]ice.TCPMux{}, map[int]*udpMuxShard{})
+	assert.ErrorIs(t, err, errInvalidNATIP)
+}
+
+func TestGatherCandidatesAppliesPolicy(t *testing.T) {
+	t.Setenv(environment.IncludeLoopbackCandidate, "true")
+	t.Setenv(environment.ICEIPInclude, "127.0.0.1")
+	t.Setenv(environment.UDPPortRange, "45000-45010")
+	t.Setenv(environment.ICELite, "true")
+
+	settingEngine, err := getSettingEngine(false, 0, map[string]ice.TCPMux{}, map[int]*udpMuxShard{})
+	require.NoError(t, err)
+	manager.SetAPIWHEP(webrtc.NewAPI(webrtc.WithSettingEngine(settingEngine)))
+	t.Cleanup(func() { manager.SetAPIWHEP(nil) })
+
+	gathered, err := GatherCandidates(false)
+	require.NoError(t, err)
+	assert.True(t, gathered.ICELite)
+	assert.True(t, gathered.GatheringComplete)
+	require.NotEmpty(t, gathered.Candidates)
+
+	for _, candidate := range gathered.Candidates {
+		assert.Equal(t, "host", candidate.Type)
+		assert.Equal(t, "127.0.0.1", candidate.Address)
+		assert.GreaterOrEqual(t, candidate.Port, uint16(45000))
+		assert.LessOrEqual(t, candidate.Port, uint16(45010))
+	}
+}
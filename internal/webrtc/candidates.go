@@ -0,0 +1,106 @@
+package webrtc
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/peerconnection"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+)
+
+const candidateGatheringTimeout = 10 * time.Second
+
+type GatheredCandidates struct {
+	ICELite           bool                `json:"iceLite"`
+	GatheringComplete bool                `json:"gatheringComplete"`
+	Candidates        []GatheredCandidate `json:"candidates"`
+}
+
+type GatheredCandidate struct {
+	Type           string `json:"type"`
+	Protocol       string `json:"protocol"`
+	Address        string `json:"address"`
+	Port           uint16 `json:"port"`
+	RelatedAddress string `json:"relatedAddress,omitempty"`
+	RelatedPort    uint16 `json:"relatedPort,omitempty"`
+	TCPType        string `json:"tcpType,omitempty"`
+	Candidate      string `json:"candidate"`
+}
+
+// Gather the candidates a new WHIP or WHEP PeerConnection would offer with the current candidate policy.
+// The PeerConnection is closed once gathering completed or timed out.
+func GatherCandidates(isWHIP bool) (*GatheredCandidates, error) {
+	api := manager.GetAPIWHEP()
+	if isWHIP {
+		api = manager.GetAPIWHIP()
+	}
+
+	peerConnection, err := api.NewPeerConnection(webrtc.Configuration{
+		ICEServers: peerconnection.GetICEServers(uuid.New().String()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := peerConnection.Close(); err != nil {
+			slog.Error("WebRTC.GatherCandidates.Close", "err", err)
+		}
+	}()
+
+	var (
+		candidatesLock sync.Mutex
+		candidates     []GatheredCandidate
+		gathered       = &GatheredCandidates{ICELite: isICELite()}
+	)
+
+	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+
+		candidatesLock.Lock()
+		defer candidatesLock.Unlock()
+
+		candidates = append(candidates, GatheredCandidate{
+			Type:           candidate.Typ.String(),
+			Protocol:       candidate.Protocol.String(),
+			Address:        candidate.Address,
+			Port:           candidate.Port,
+			RelatedAddress: candidate.RelatedAddress,
+			RelatedPort:    candidate.RelatedPort,
+			TCPType:        candidate.TCPType,
+			Candidate:      candidate.ToJSON().Candidate,
+		})
+	})
+
+	if _, err := peerConnection.CreateDataChannel("candidates", nil); err != nil {
+		return nil, err
+	}
+
+	offer, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	gatheringComplete := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(offer); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-gatheringComplete:
+		gathered.GatheringComplete = true
+	case <-time.After(candidateGatheringTimeout):
+		slog.Warn("WebRTC.GatherCandidates: Gathering timed out", "timeout", candidateGatheringTimeout)
+	}
+
+	// Candidates trickling in after a timeout are not part of the result
+	candidatesLock.Lock()
+	gathered.Candidates = append([]GatheredCandidate{}, candidates...)
+	candidatesLock.Unlock()
+
+	return gathered, nil
+}
@@ -1,6 +1,7 @@
 package codecs
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/pion/webrtc/v4"
@@ -162,6 +163,27 @@ func GetDefaultTracks(streamKey string) (audioTrack *TrackMultiCodec, videoTrack
 	return audioTrack, videoTrack
 }
 
+// Tracks for the stage guest in the slot, sent to viewers as their own stream next to the host
+func GetStageTracks(streamKey string, slot int) (audioTrack *TrackMultiCodec, videoTrack *TrackMultiCodec) {
+	streamID := streamKey + "-stage-" + strconv.Itoa(slot)
+
+	audioTrack = CreateTrackMultiCodec(
+		"audio-stage-"+strconv.Itoa(slot),
+		"pion",
+		streamID,
+		webrtc.RTPCodecTypeAudio,
+		0)
+
+	videoTrack = CreateTrackMultiCodec(
+		"video-stage-"+strconv.Itoa(slot),
+		"pion",
+		streamID,
+		webrtc.RTPCodecTypeVideo,
+		0)
+
+	return audioTrack, videoTrack
+}
+
 func GetAudioTrackCodec(codec string) TrackCodeType {
 	lowerCase := strings.ToLower(codec)
 
@@ -0,0 +1,53 @@
+package codecs
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+)
+
+// Largest packet read from a publisher
+const packetBufferSize = 1500
+
+var packetBufferPool = sync.Pool{
+	New: func() any {
+		return &PacketBuffer{}
+	},
+}
+
+// A pooled packet read from a publisher. The packet is unmarshalled in place, so its payload
+// points into the buffer, and returns to the pool once every viewer it was queued for released it.
+type PacketBuffer struct {
+	Packet rtp.Packet
+
+	data       [packetBufferSize]byte
+	references atomic.Int32
+}
+
+// Get a packet buffer from the pool, held by the caller until released
+func GetPacketBuffer() *PacketBuffer {
+	buffer := packetBufferPool.Get().(*PacketBuffer)
+	buffer.references.Store(1)
+	return buffer
+}
+
+// Buffer to read the packet into
+func (b *PacketBuffer) Data() []byte {
+	return b.data[:]
+}
+
+// Unmarshal the first n bytes of the buffer into Packet
+func (b *PacketBuffer) Unmarshal(n int) error {
+	return b.Packet.Unmarshal(b.data[:n])
+}
+
+func (b *PacketBuffer) retain() {
+	b.references.Add(1)
+}
+
+func (b *PacketBuffer) release() {
+	if b.references.Add(-1) == 0 {
+		packetBufferPool.Put(b)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/pion/webrtc/v4"
 )
 
+// Packet fanned out from a publisher to its viewers. Packet is shared between all viewers
+// and must be treated as read-only, viewers write their own header.
 type TrackPacket struct {
 	Layer        string
 	Packet       *rtp.Packet
@@ -14,6 +16,28 @@ type TrackPacket struct {
 	SequenceDiff int
 	Codec        TrackCodeType
 	IsKeyframe   bool
+
+	// Pooled buffer holding Packet, nil if the packet is not pooled
+	Buffer *PacketBuffer
+}
+
+// Hold the pooled buffer of the packet until Release, for viewers writing the packet asynchronously
+func (p TrackPacket) Retain() {
+	if p.Buffer != nil {
+		p.Buffer.retain()
+	}
+}
+
+// Release the pooled buffer of the packet, the packet must not be used afterwards
+func (p TrackPacket) Release() {
+	if p.Buffer != nil {
+		p.Buffer.release()
+	}
+}
+
+// Receives the packets of a track that is not bound to a PeerConnection
+type PacketSink interface {
+	WritePacket(kind webrtc.RTPCodecType, packet *rtp.Packet, codec TrackCodeType) error
 }
 
 type TrackMultiCodec struct {
@@ -26,6 +50,7 @@ type TrackMultiCodec struct {
 
 	ssrc        webrtc.SSRC
 	writeStream webrtc.TrackLocalWriter
+	sink        PacketSink
 
 	payloadTypeH264 uint8
 	payloadTypeH265 uint8
@@ -52,6 +77,13 @@ func CreateTrackMultiCodec(id string, rid string, streamID string, kind webrtc.R
 	}
 }
 
+// Create a track that writes its packets to the sink instead of a PeerConnection
+func CreateTrackMultiCodecSink(id string, rid string, streamID string, kind webrtc.RTPCodecType, sink PacketSink) *TrackMultiCodec {
+	track := CreateTrackMultiCodec(id, rid, streamID, kind, 0)
+	track.sink = sink
+	return track
+}
+
 func (t *TrackMultiCodec) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
 	t.ssrc = ctx.SSRC()
 	t.writeStream = ctx.WriteStream()
@@ -126,6 +158,10 @@ func (t *TrackMultiCodec) Unbind(context webrtc.TrackLocalContext) error {
 }
 
 func (t *TrackMultiCodec) WriteRTP(packet *rtp.Packet, codec TrackCodeType) error {
+	if t.sink != nil {
+		return t.sink.WritePacket(t.kind, packet, codec)
+	}
+
 	packet.SSRC = uint32(t.ssrc)
 
 	if codec != t.codec {
@@ -0,0 +1,249 @@
+package fmp4
+
+import (
+	"encoding/binary"
+)
+
+const (
+	videoTrackID = 1
+	audioTrackID = 2
+
+	videoTimescale = 90000
+	audioTimescale = 48000
+
+	// Sample does not depend on others
+	sampleFlagsSync = 0x02000000
+	// Sample depends on others and is not a sync sample
+	sampleFlagsNonSync = 0x01010000
+
+	trunFlagDataOffset     = 0x000001
+	trunFlagSampleDuration = 0x000100
+	trunFlagSampleSize     = 0x000200
+	trunFlagSampleFlags    = 0x000400
+
+	tfhdFlagDefaultBaseIsMoof = 0x020000
+)
+
+var unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+type sample struct {
+	data       []byte
+	decodeTime uint64
+	duration   uint32
+	isKeyframe bool
+}
+
+type videoSampleEntry struct {
+	width  uint16
+	height uint16
+	avcC   []byte
+}
+
+type audioSampleEntry struct {
+	channels uint16
+}
+
+// Samples of a track written to a fragment
+type trackFragment struct {
+	trackID uint32
+	samples []sample
+}
+
+// Encode the values of a box in big endian
+func fields(values ...any) []byte {
+	buffer := []byte{}
+	for _, value := range values {
+		switch value := value.(type) {
+		case uint8:
+			buffer = append(buffer, value)
+		case uint16:
+			buffer = binary.BigEndian.AppendUint16(buffer, value)
+		case uint32:
+			buffer = binary.BigEndian.AppendUint32(buffer, value)
+		case uint64:
+			buffer = binary.BigEndian.AppendUint64(buffer, value)
+		case []uint32:
+			for _, v := range value {
+				buffer = binary.BigEndian.AppendUint32(buffer, v)
+			}
+		case []byte:
+			buffer = append(buffer, value...)
+		case string:
+			buffer = append(buffer, value...)
+		default:
+			panic("fmp4: unsupported field type")
+		}
+	}
+
+	return buffer
+}
+
+func box(boxType string, payloads ...[]byte) []byte {
+	size := 8
+	for _, payload := range payloads {
+		size += len(payload)
+	}
+
+	buffer := make([]byte, 0, size)
+	buffer = binary.BigEndian.AppendUint32(buffer, uint32(size))
+	buffer = append(buffer, boxType...)
+	for _, payload := range payloads {
+		buffer = append(buffer, payload...)
+	}
+
+	return buffer
+}
+
+func fullBox(boxType string, version uint8, flags uint32, payloads ...[]byte) []byte {
+	return box(boxType, append([][]byte{fields(uint32(version)<<24 | flags)}, payloads...)...)
+}
+
+// Create the init segment declaring the tracks, nil entries are left out
+func initSegment(video *videoSampleEntry, audio *audioSampleEntry) []byte {
+	traks := [][]byte{mvhd()}
+	trexs := [][]byte{}
+
+	if video != nil {
+		traks = append(traks, videoTrak(video))
+		trexs = append(trexs, trex(videoTrackID))
+	}
+
+	if audio != nil {
+		traks = append(traks, audioTrak(audio))
+		trexs = append(trexs, trex(audioTrackID))
+	}
+
+	ftyp := box("ftyp", fields("iso5", uint32(512), "iso5iso6mp41"))
+	moov := box("moov", append(traks, box("mvex", trexs...))...)
+
+	return append(ftyp, moov...)
+}
+
+func mvhd() []byte {
+	return fullBox("mvhd", 0, 0, fields(
+		uint32(0), uint32(0), // creation and modification time
+		uint32(1000), uint32(0), // timescale and duration
+		uint32(0x00010000), uint16(0x0100), // rate and volume
+		make([]byte, 10),
+		unityMatrix,
+		make([]byte, 24),
+		uint32(audioTrackID+1), // next track ID
+	))
+}
+
+func tkhd(trackID uint32, volume uint16, width uint16, height uint16) []byte {
+	// Enabled and in movie
+	return fullBox("tkhd", 0, 3, fields(
+		uint32(0), uint32(0), // creation and modification time
+		trackID, uint32(0), uint32(0), // track ID, reserved and duration
+		make([]byte, 8),
+		uint16(0), uint16(0), // layer and alternate group
+		volume, uint16(0),
+		unityMatrix,
+		uint32(width)<<16, uint32(height)<<16,
+	))
+}
+
+func mdia(timescale uint32, handlerType string, handlerName string, mediaHeader []byte, sampleEntry []byte) []byte {
+	mdhd := fullBox("mdhd", 0, 0, fields(
+		uint32(0), uint32(0), // creation and modification time
+		timescale, uint32(0),
+		uint16(0x55c4), uint16(0), // und language
+	))
+	hdlr := fullBox("hdlr", 0, 0, fields(uint32(0), handlerType, make([]byte, 12), handlerName, uint8(0)))
+
+	dref := fullBox("dref", 0, 0, fields(uint32(1)), fullBox("url ", 0, 1))
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, fields(uint32(1)), sampleEntry),
+		fullBox("stts", 0, 0, fields(uint32(0))),
+		fullBox("stsc", 0, 0, fields(uint32(0))),
+		fullBox("stsz", 0, 0, fields(uint32(0), uint32(0))),
+		fullBox("stco", 0, 0, fields(uint32(0))),
+	)
+
+	return box("mdia", mdhd, hdlr, box("minf", mediaHeader, box("dinf", dref), stbl))
+}
+
+func videoTrak(video *videoSampleEntry) []byte {
+	avc1 := box("avc1",
+		fields(
+			make([]byte, 6), uint16(1), // reserved and data reference index
+			make([]byte, 16),
+			video.width, video.height,
+			uint32(0x00480000), uint32(0x00480000), // 72 dpi
+			uint32(0), uint16(1), // reserved and frame count
+			make([]byte, 32),               // compressor name
+			uint16(0x0018), uint16(0xffff), // depth and pre defined
+		),
+		box("avcC", video.avcC),
+	)
+
+	return box("trak",
+		tkhd(videoTrackID, 0, video.width, video.height),
+		mdia(videoTimescale, "vide", "VideoHandler", fullBox("vmhd", 0, 1, make([]byte, 8)), avc1),
+	)
+}
+
+func audioTrak(audio *audioSampleEntry) []byte {
+	opus := box("Opus",
+		fields(
+			make([]byte, 6), uint16(1), // reserved and data reference index
+			make([]byte, 8),
+			audio.channels, uint16(16), // channels and sample size
+			uint32(0),
+			uint32(audioTimescale)<<16,
+		),
+		// Version, output channels, pre-skip, input sample rate, output gain and channel mapping family
+		box("dOps", fields(uint8(0), uint8(audio.channels), uint16(0), uint32(audioTimescale), uint16(0), uint8(0))),
+	)
+
+	return box("trak",
+		tkhd(audioTrackID, 0x0100, 0, 0),
+		mdia(audioTimescale, "soun", "SoundHandler", fullBox("smhd", 0, 0, make([]byte, 4)), opus),
+	)
+}
+
+func trex(trackID uint32) []byte {
+	return fullBox("trex", 0, 0, fields(trackID, uint32(1), uint32(0), uint32(0), uint32(0)))
+}
+
+// Create a media fragment out of the samples of the tracks
+func fragment(sequenceNumber uint32, tracks []trackFragment) []byte {
+	// The data offsets depend on the size of the moof, which does not depend on the offsets
+	moof := fragmentMoof(sequenceNumber, tracks, 0)
+	moof = fragmentMoof(sequenceNumber, tracks, uint32(len(moof))+8)
+
+	mdat := [][]byte{}
+	for _, track := range tracks {
+		for _, sample := range track.samples {
+			mdat = append(mdat, sample.data)
+		}
+	}
+
+	return append(moof, box("mdat", mdat...)...)
+}
+
+func fragmentMoof(sequenceNumber uint32, tracks []trackFragment, dataOffset uint32) []byte {
+	trafs := [][]byte{fullBox("mfhd", 0, 0, fields(sequenceNumber))}
+
+	for _, track := range tracks {
+		trun := fields(uint32(len(track.samples)), dataOffset)
+		for _, sample := range track.samples {
+			flags := uint32(sampleFlagsNonSync)
+			if sample.isKeyframe {
+				flags = sampleFlagsSync
+			}
+
+			trun = append(trun, fields(sample.duration, uint32(len(sample.data)), flags)...)
+			dataOffset += uint32(len(sample.data))
+		}
+
+		trafs = append(trafs, box("traf",
+			fullBox("tfhd", 0, tfhdFlagDefaultBaseIsMoof, fields(track.trackID)),
+			fullBox("tfdt", 1, 0, fields(track.samples[0].decodeTime)),
+			fullBox("trun", 0, trunFlagDataOffset|trunFlagSampleDuration|trunFlagSampleSize|trunFlagSampleFlags, trun),
+		))
+	}
+
+	return box("moof", trafs...)
+}
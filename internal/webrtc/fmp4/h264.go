@@ -0,0 +1,233 @@
+package fmp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	h264NALUTypeIDR = 5
+	h264NALUTypeSPS = 7
+	h264NALUTypePPS = 8
+	h264NALUTypeAUD = 9
+
+	h264NALUTypeBitmask = 0x1f
+)
+
+var errInvalidSPS = errors.New("invalid H.264 sequence parameter set")
+
+// Profiles whose SPS carry chroma format, bit depth and scaling matrices
+var h264HighProfiles = []uint8{100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135}
+
+// Split AVC length prefixed NALUs
+func splitAVCNALUs(frame []byte) (nalus [][]byte, err error) {
+	for len(frame) > 0 {
+		if len(frame) < 4 {
+			return nil, errors.New("truncated NALU length")
+		}
+
+		length := int(binary.BigEndian.Uint32(frame))
+		if length > len(frame)-4 {
+			return nil, errors.New("truncated NALU")
+		}
+
+		nalus = append(nalus, frame[4:4+length])
+		frame = frame[4+length:]
+	}
+
+	return nalus, nil
+}
+
+// Get the avcC decoder configuration of the parameter sets
+func getAVCDecoderConfiguration(sps []byte, pps []byte) []byte {
+	// Version, profile, compatibility, level, 4 byte NALU lengths and one SPS
+	configuration := []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1}
+	configuration = binary.BigEndian.AppendUint16(configuration, uint16(len(sps)))
+	configuration = append(configuration, sps...)
+	configuration = append(configuration, 1)
+	configuration = binary.BigEndian.AppendUint16(configuration, uint16(len(pps)))
+	return append(configuration, pps...)
+}
+
+// Get the RFC 6381 codecs parameter of the SPS, e.g. avc1.42e01f
+func getAVCCodec(sps []byte) string {
+	return fmt.Sprintf("avc1.%02x%02x%02x", sps[1], sps[2], sps[3])
+}
+
+// Get the cropped picture size of the SPS
+func getSPSPictureSize(sps []byte) (width uint16, height uint16, err error) {
+	if len(sps) < 4 {
+		return 0, 0, errInvalidSPS
+	}
+
+	reader := &bitReader{data: removeEmulationPrevention(sps[4:])}
+	profile := sps[1]
+
+	reader.readExpGolomb() // seq_parameter_set_id
+
+	chromaFormat := uint32(1)
+	separateColourPlane := false
+	if slices.Contains(h264HighProfiles, profile) {
+		chromaFormat = reader.readExpGolomb()
+		if chromaFormat == 3 {
+			separateColourPlane = reader.readBit() == 1
+		}
+
+		reader.readExpGolomb() // bit_depth_luma_minus8
+		reader.readExpGolomb() // bit_depth_chroma_minus8
+		reader.readBit()       // qpprime_y_zero_transform_bypass_flag
+
+		if reader.readBit() == 1 {
+			scalingLists := 8
+			if chromaFormat == 3 {
+				scalingLists = 12
+			}
+
+			for i := range scalingLists {
+				if reader.readBit() == 0 {
+					continue
+				}
+
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				reader.skipScalingList(size)
+			}
+		}
+	}
+
+	reader.readExpGolomb() // log2_max_frame_num_minus4
+	switch reader.readExpGolomb() {
+	case 0:
+		reader.readExpGolomb() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		reader.readBit()             // delta_pic_order_always_zero_flag
+		reader.readSignedExpGolomb() // offset_for_non_ref_pic
+		reader.readSignedExpGolomb() // offset_for_top_to_bottom_field
+		for range reader.readExpGolomb() {
+			reader.readSignedExpGolomb() // offset_for_ref_frame
+		}
+	}
+
+	reader.readExpGolomb() // max_num_ref_frames
+	reader.readBit()       // gaps_in_frame_num_value_allowed_flag
+
+	widthInMacroblocks := reader.readExpGolomb() + 1
+	heightInMapUnits := reader.readExpGolomb() + 1
+	frameMacroblocksOnly := reader.readBit()
+	if frameMacroblocksOnly == 0 {
+		reader.readBit() // mb_adaptive_frame_field_flag
+	}
+	reader.readBit() // direct_8x8_inference_flag
+
+	pictureWidth := widthInMacroblocks * 16
+	pictureHeight := (2 - frameMacroblocksOnly) * heightInMapUnits * 16
+
+	if reader.readBit() == 1 {
+		cropUnitX, cropUnitY := uint32(1), 2-frameMacroblocksOnly
+		if chromaFormat != 0 && !separateColourPlane {
+			if chromaFormat != 3 {
+				cropUnitX = 2
+			}
+			if chromaFormat == 1 {
+				cropUnitY *= 2
+			}
+		}
+
+		left, right := reader.readExpGolomb(), reader.readExpGolomb()
+		top, bottom := reader.readExpGolomb(), reader.readExpGolomb()
+		pictureWidth -= (left + right) * cropUnitX
+		pictureHeight -= (top + bottom) * cropUnitY
+	}
+
+	if reader.err != nil || pictureWidth == 0 || pictureHeight == 0 || pictureWidth > 0xffff || pictureHeight > 0xffff {
+		return 0, 0, errInvalidSPS
+	}
+
+	return uint16(pictureWidth), uint16(pictureHeight), nil
+}
+
+// Remove the emulation prevention bytes of 0x000003 sequences
+func removeEmulationPrevention(data []byte) []byte {
+	rbsp := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+
+	return rbsp
+}
+
+type bitReader struct {
+	data     []byte
+	position int
+	err      error
+}
+
+func (r *bitReader) readBit() uint32 {
+	if r.position >= len(r.data)*8 {
+		r.err = errInvalidSPS
+		return 0
+	}
+
+	bit := (r.data[r.position/8] >> (7 - r.position%8)) & 1
+	r.position++
+	return uint32(bit)
+}
+
+func (r *bitReader) readBits(count int) uint32 {
+	value := uint32(0)
+	for range count {
+		value = value<<1 | r.readBit()
+	}
+
+	return value
+}
+
+func (r *bitReader) readExpGolomb() uint32 {
+	leadingZeros := 0
+	for r.readBit() == 0 {
+		if r.err != nil || leadingZeros >= 31 {
+			r.err = errInvalidSPS
+			return 0
+		}
+		leadingZeros++
+	}
+
+	return (1 << leadingZeros) - 1 + r.readBits(leadingZeros)
+}
+
+func (r *bitReader) readSignedExpGolomb() int32 {
+	value := r.readExpGolomb()
+	if value%2 == 0 {
+		return -int32(value / 2)
+	}
+
+	return int32(value/2) + 1
+}
+
+func (r *bitReader) skipScalingList(size int) {
+	lastScale, nextScale := int32(8), int32(8)
+	for range size {
+		if nextScale != 0 {
+			nextScale = (lastScale + r.readSignedExpGolomb() + 256) % 256
+		}
+
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+}
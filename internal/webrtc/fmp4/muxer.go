@@ -0,0 +1,472 @@
+package fmp4
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	pionCodecs "github.com/pion/rtp/codecs"
+)
+
+const (
+	DefaultFragmentDuration = 200 * time.Millisecond
+
+	// Audio is sent without video if no keyframe arrived while it was received for this long
+	audioOnlyTimeout = 3 * time.Second
+
+	// Timestamp jumps of a new publisher continue the timeline with the previous sample duration
+	maxTimestampJump = 10 * time.Second
+
+	opusChannels = 2
+)
+
+var ErrUnsupportedCodec = errors.New("only H.264 video and Opus audio can be sent as fragmented MP4")
+
+// Receives the output of a Muxer
+type Output interface {
+	// Announces the MIME type of the init segment and fragments that follow, e.g. video/mp4; codecs="avc1.42e01f,opus"
+	WriteMimeType(mimeType string) error
+
+	// Writes an init segment or a media fragment
+	WriteSegment(segment []byte) error
+}
+
+// Muxes the RTP packets of a viewer into fragmented MP4. An init segment is written on the first keyframe,
+// fragments start at every keyframe and long keyframe intervals are split into fragments of fragmentDuration.
+// Packets must be written from a single goroutine.
+type Muxer struct {
+	output           Output
+	fragmentDuration time.Duration
+	now              func() time.Time
+
+	onKeyframeRequired func()
+
+	// Arrival of the first keyframe, the first sample of each track is placed relative to it
+	start          time.Time
+	isInitialized  bool
+	hasVideo       bool
+	hasAudio       bool
+	mimeType       string
+	sequenceNumber uint32
+
+	video      videoTrack
+	audio      audioTrack
+	firstAudio time.Time
+
+	errLock sync.Mutex
+	err     error
+}
+
+type videoTrack struct {
+	depacketizer *pionCodecs.H264Packet
+
+	lastSequenceNumber    uint16
+	lastSequenceNumberSet bool
+	isWaitingForKeyframe  bool
+
+	// NALUs of the frame being received, discarded if a packet of it was lost
+	frame          []byte
+	frameTimestamp uint32
+	hasFrame       bool
+	isFrameBroken  bool
+
+	sps []byte
+	pps []byte
+
+	timeline timeline
+	samples  sampleQueue
+}
+
+type audioTrack struct {
+	timeline timeline
+	samples  sampleQueue
+}
+
+// Create a muxer writing to output, onKeyframeRequired is called when video can only continue with a keyframe
+func NewMuxer(output Output, fragmentDuration time.Duration, onKeyframeRequired func()) *Muxer {
+	if fragmentDuration <= 0 {
+		fragmentDuration = DefaultFragmentDuration
+	}
+
+	return &Muxer{
+		output:             output,
+		fragmentDuration:   fragmentDuration,
+		now:                time.Now,
+		onKeyframeRequired: onKeyframeRequired,
+		video: videoTrack{
+			depacketizer:         &pionCodecs.H264Packet{IsAVC: true},
+			isWaitingForKeyframe: true,
+			timeline:             timeline{clockRate: videoTimescale},
+		},
+		audio: audioTrack{
+			timeline: timeline{clockRate: audioTimescale},
+		},
+	}
+}
+
+// Get the error that stopped the muxer, nil while it is running
+func (m *Muxer) Err() error {
+	m.errLock.Lock()
+	defer m.errLock.Unlock()
+
+	return m.err
+}
+
+// Write a packet of the viewer's audio or video track. Returns an error wrapping io.ErrClosedPipe once the muxer
+// stopped, either because the output failed or the codec is not supported.
+func (m *Muxer) WritePacket(kind webrtc.RTPCodecType, packet *rtp.Packet, codec codecs.TrackCodeType) error {
+	if err := m.Err(); err != nil {
+		return err
+	}
+
+	var err error
+	if kind == webrtc.RTPCodecTypeAudio {
+		err = m.writeAudioPacket(packet)
+	} else if codec != codecs.VideoTrackCodecH264 {
+		err = ErrUnsupportedCodec
+	} else {
+		err = m.writeVideoPacket(packet)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	m.errLock.Lock()
+	m.err = fmt.Errorf("%w: %w", io.ErrClosedPipe, err)
+	m.errLock.Unlock()
+
+	return m.Err()
+}
+
+func (m *Muxer) writeAudioPacket(packet *rtp.Packet) error {
+	now := m.now()
+
+	if !m.isInitialized {
+		if m.firstAudio.IsZero() {
+			m.firstAudio = now
+		}
+
+		if now.Sub(m.firstAudio) < audioOnlyTimeout {
+			return nil
+		}
+
+		slog.Info("FMP4Muxer: No video keyframe received, sending audio only")
+		if err := m.initialize(now, false, true); err != nil {
+			return err
+		}
+	}
+
+	if !m.hasAudio || len(packet.Payload) == 0 {
+		return nil
+	}
+
+	m.audio.samples.push(sample{
+		data:       bytes.Clone(packet.Payload),
+		decodeTime: m.audio.timeline.getDecodeTime(packet.Timestamp, now.Sub(m.start)),
+		isKeyframe: true,
+	})
+
+	// Audio is usually flushed together with video
+	if m.audio.samples.getDuration(audioTimescale) >= m.fragmentDuration {
+		return m.flush()
+	}
+
+	return nil
+}
+
+func (m *Muxer) writeVideoPacket(packet *rtp.Packet) error {
+	video := &m.video
+
+	// A lost packet breaks the frame it belongs to and every frame until the next keyframe
+	isPacketLost := video.lastSequenceNumberSet && packet.SequenceNumber != video.lastSequenceNumber+1
+	if isPacketLost {
+		video.depacketizer = &pionCodecs.H264Packet{IsAVC: true}
+		m.requireKeyframe()
+	}
+	video.lastSequenceNumber = packet.SequenceNumber
+	video.lastSequenceNumberSet = true
+
+	if video.hasFrame && packet.Timestamp != video.frameTimestamp {
+		video.isFrameBroken = video.isFrameBroken || isPacketLost
+		if err := m.completeVideoFrame(); err != nil {
+			return err
+		}
+	}
+
+	if !video.hasFrame {
+		video.hasFrame = true
+		video.frameTimestamp = packet.Timestamp
+		video.isFrameBroken = isPacketLost && !video.depacketizer.IsPartitionHead(packet.Payload)
+	} else if isPacketLost {
+		video.isFrameBroken = true
+	}
+
+	nalus, err := video.depacketizer.Unmarshal(packet.Payload)
+	if err != nil {
+		video.isFrameBroken = true
+	}
+	video.frame = append(video.frame, nalus...)
+
+	if packet.Marker {
+		return m.completeVideoFrame()
+	}
+
+	return nil
+}
+
+func (m *Muxer) completeVideoFrame() error {
+	video := &m.video
+	frame, timestamp, isFrameBroken := video.frame, video.frameTimestamp, video.isFrameBroken
+	video.frame = nil
+	video.hasFrame = false
+	video.isFrameBroken = false
+
+	nalus, err := splitAVCNALUs(frame)
+	if isFrameBroken || err != nil || len(nalus) == 0 {
+		m.requireKeyframe()
+		return nil
+	}
+
+	// Parameter sets are part of the init segment, not the samples
+	data := []byte{}
+	isKeyframe, isParameterSetChanged := false, false
+	for _, nalu := range nalus {
+		switch nalu[0] & h264NALUTypeBitmask {
+		case h264NALUTypeSPS:
+			isParameterSetChanged = isParameterSetChanged || !bytes.Equal(nalu, video.sps)
+			video.sps = bytes.Clone(nalu)
+		case h264NALUTypePPS:
+			isParameterSetChanged = isParameterSetChanged || !bytes.Equal(nalu, video.pps)
+			video.pps = bytes.Clone(nalu)
+		case h264NALUTypeAUD:
+		case h264NALUTypeIDR:
+			isKeyframe = true
+			data = appendAVCNALU(data, nalu)
+		default:
+			data = appendAVCNALU(data, nalu)
+		}
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	if video.isWaitingForKeyframe && !isKeyframe {
+		m.requireKeyframe()
+		return nil
+	}
+
+	if isKeyframe && (video.sps == nil || video.pps == nil) {
+		slog.Info("FMP4Muxer: Keyframe without parameter sets, waiting for the next keyframe")
+		m.requireKeyframe()
+		return nil
+	}
+	video.isWaitingForKeyframe = false
+
+	now := m.now()
+	isInitSegmentChanged := false
+	if !m.isInitialized {
+		if err := m.initialize(now, true, !m.firstAudio.IsZero()); err != nil {
+			return err
+		}
+	} else if !m.hasVideo {
+		return nil
+	} else {
+		isInitSegmentChanged = isParameterSetChanged
+	}
+
+	// Fragments start at keyframes, the samples before it are complete once it has a decode time
+	decodeTime := video.timeline.getDecodeTime(timestamp, now.Sub(m.start))
+	video.samples.setLastDuration(decodeTime)
+	if isKeyframe || isInitSegmentChanged {
+		if err := m.flush(); err != nil {
+			return err
+		}
+	}
+
+	// A new init segment is only valid at a fragment boundary
+	if isInitSegmentChanged {
+		if err := m.writeInitSegment(); err != nil {
+			return err
+		}
+	}
+
+	video.samples.push(sample{data: data, decodeTime: decodeTime, isKeyframe: isKeyframe})
+	if video.samples.getDuration(videoTimescale) >= m.fragmentDuration {
+		return m.flush()
+	}
+
+	return nil
+}
+
+func (m *Muxer) initialize(now time.Time, hasVideo bool, hasAudio bool) error {
+	m.start = now
+	m.isInitialized = true
+	m.hasVideo = hasVideo
+	m.hasAudio = hasAudio
+
+	return m.writeInitSegment()
+}
+
+func (m *Muxer) writeInitSegment() error {
+	var (
+		videoEntry *videoSampleEntry
+		audioEntry *audioSampleEntry
+		codecNames []string
+	)
+
+	if m.hasVideo {
+		width, height, err := getSPSPictureSize(m.video.sps)
+		if err != nil {
+			return err
+		}
+
+		videoEntry = &videoSampleEntry{
+			width:  width,
+			height: height,
+			avcC:   getAVCDecoderConfiguration(m.video.sps, m.video.pps),
+		}
+		codecNames = append(codecNames, getAVCCodec(m.video.sps))
+	}
+
+	if m.hasAudio {
+		audioEntry = &audioSampleEntry{channels: opusChannels}
+		codecNames = append(codecNames, "opus")
+	}
+
+	mimeType := `audio/mp4; codecs="` + strings.Join(codecNames, ",") + `"`
+	if m.hasVideo {
+		mimeType = "video" + strings.TrimPrefix(mimeType, "audio")
+	}
+
+	if mimeType != m.mimeType {
+		if err := m.output.WriteMimeType(mimeType); err != nil {
+			return err
+		}
+		m.mimeType = mimeType
+	}
+
+	return m.output.WriteSegment(initSegment(videoEntry, audioEntry))
+}
+
+// Write the samples with a known duration as a fragment
+func (m *Muxer) flush() error {
+	tracks := []trackFragment{}
+	if samples := m.video.samples.takeComplete(); len(samples) != 0 {
+		tracks = append(tracks, trackFragment{trackID: videoTrackID, samples: samples})
+	}
+
+	if samples := m.audio.samples.takeComplete(); len(samples) != 0 {
+		tracks = append(tracks, trackFragment{trackID: audioTrackID, samples: samples})
+	}
+
+	if len(tracks) == 0 {
+		return nil
+	}
+
+	m.sequenceNumber++
+	return m.output.WriteSegment(fragment(m.sequenceNumber, tracks))
+}
+
+// Drop video until the next keyframe, repeated requests are suppressed by the publisher's keyframe coordinator
+func (m *Muxer) requireKeyframe() {
+	m.video.isWaitingForKeyframe = true
+	if m.onKeyframeRequired != nil {
+		m.onKeyframeRequired()
+	}
+}
+
+func appendAVCNALU(data []byte, nalu []byte) []byte {
+	data = append(data, byte(len(nalu)>>24), byte(len(nalu)>>16), byte(len(nalu)>>8), byte(len(nalu)))
+	return append(data, nalu...)
+}
+
+// Converts the RTP timestamps of a track to decode times
+type timeline struct {
+	clockRate uint32
+
+	lastTimestamp uint32
+	lastDuration  uint64
+	decodeTime    uint64
+	isSet         bool
+}
+
+// Get the decode time of the RTP timestamp. The first sample is placed at its arrival since the start,
+// the following ones by their timestamps. WebRTC publishers send no B-frames, so decode and presentation time match.
+func (t *timeline) getDecodeTime(timestamp uint32, sinceStart time.Duration) uint64 {
+	if !t.isSet {
+		t.isSet = true
+		t.lastTimestamp = timestamp
+		t.decodeTime = uint64(max(sinceStart, 0)) * uint64(t.clockRate) / uint64(time.Second)
+		return t.decodeTime
+	}
+
+	difference := int64(int32(timestamp - t.lastTimestamp))
+	t.lastTimestamp = timestamp
+
+	if difference > 0 && difference <= int64(maxTimestampJump.Seconds())*int64(t.clockRate) {
+		t.lastDuration = uint64(difference)
+	} else if t.lastDuration == 0 {
+		t.lastDuration = 1
+	}
+
+	t.decodeTime += t.lastDuration
+	return t.decodeTime
+}
+
+// Samples waiting to be written, the last one until the next sample gives it a duration
+type sampleQueue struct {
+	samples []sample
+}
+
+func (q *sampleQueue) push(next sample) {
+	q.setLastDuration(next.decodeTime)
+	q.samples = append(q.samples, next)
+}
+
+func (q *sampleQueue) setLastDuration(decodeTime uint64) {
+	if len(q.samples) == 0 {
+		return
+	}
+
+	last := &q.samples[len(q.samples)-1]
+	last.duration = uint32(max(decodeTime, last.decodeTime+1) - last.decodeTime)
+}
+
+// Take the samples with a known duration
+func (q *sampleQueue) takeComplete() []sample {
+	if len(q.samples) == 0 {
+		return nil
+	}
+
+	last := q.samples[len(q.samples)-1]
+	if last.duration == 0 {
+		complete := q.samples[:len(q.samples)-1]
+		q.samples = []sample{last}
+		return complete
+	}
+
+	complete := q.samples
+	q.samples = nil
+	return complete
+}
+
+// Get the duration of the samples with a known duration
+func (q *sampleQueue) getDuration(clockRate uint32) time.Duration {
+	duration := uint64(0)
+	for _, sample := range q.samples {
+		duration += uint64(sample.duration)
+	}
+
+	return time.Duration(duration * uint64(time.Second) / uint64(clockRate))
+}
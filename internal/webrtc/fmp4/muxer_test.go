@@ -0,0 +1,258 @@
+package fmp4
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOutput struct {
+	mimeTypes []string
+	segments  [][]byte
+}
+
+func (o *testOutput) WriteMimeType(mimeType string) error {
+	o.mimeTypes = append(o.mimeTypes, mimeType)
+	return nil
+}
+
+func (o *testOutput) WriteSegment(segment []byte) error {
+	o.segments = append(o.segments, segment)
+	return nil
+}
+
+type bitWriter struct {
+	data  []byte
+	count int
+}
+
+func (w *bitWriter) writeBits(value uint32, count int) {
+	for i := count - 1; i >= 0; i-- {
+		if w.count%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte((value>>i)&1) << (7 - w.count%8)
+		w.count++
+	}
+}
+
+func (w *bitWriter) writeExpGolomb(value uint32) {
+	length := 0
+	for (value+1)>>length > 1 {
+		length++
+	}
+
+	w.writeBits(0, length)
+	w.writeBits(value+1, length+1)
+}
+
+// Create a baseline SPS of 1920x1080, coded as 1920x1088 with 8 lines cropped
+func newTestSPS() []byte {
+	writer := &bitWriter{}
+	writer.writeExpGolomb(0)   // seq_parameter_set_id
+	writer.writeExpGolomb(0)   // log2_max_frame_num_minus4
+	writer.writeExpGolomb(0)   // pic_order_cnt_type
+	writer.writeExpGolomb(0)   // log2_max_pic_order_cnt_lsb_minus4
+	writer.writeExpGolomb(1)   // max_num_ref_frames
+	writer.writeBits(0, 1)     // gaps_in_frame_num_value_allowed_flag
+	writer.writeExpGolomb(119) // pic_width_in_mbs_minus1
+	writer.writeExpGolomb(67)  // pic_height_in_map_units_minus1
+	writer.writeBits(1, 1)     // frame_mbs_only_flag
+	writer.writeBits(1, 1)     // direct_8x8_inference_flag
+	writer.writeBits(1, 1)     // frame_cropping_flag
+	writer.writeExpGolomb(0)
+	writer.writeExpGolomb(0)
+	writer.writeExpGolomb(0)
+	writer.writeExpGolomb(4)
+	writer.writeBits(0, 1) // vui_parameters_present_flag
+	writer.writeBits(1, 1) // rbsp_stop_one_bit
+
+	return append([]byte{0x67, 0x42, 0xc0, 0x28}, writer.data...)
+}
+
+var (
+	testPPS      = []byte{0x68, 0xce, 0x3c, 0x80}
+	testIDR      = []byte{0x65, 0x88, 0x84, 0x00, 0x33}
+	testNonIDR   = []byte{0x41, 0x9a, 0x02, 0x04}
+	testOpusData = []byte{0xfc, 0xff, 0xfe}
+)
+
+func newSTAPA(nalus ...[]byte) []byte {
+	payload := []byte{0x78}
+	for _, nalu := range nalus {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+
+	return payload
+}
+
+type testStream struct {
+	t     *testing.T
+	muxer *Muxer
+	clock time.Time
+
+	sequenceNumber uint16
+	videoTimestamp uint32
+	audioTimestamp uint32
+}
+
+func (s *testStream) writeVideo(payload []byte, marker bool) {
+	s.sequenceNumber++
+	packet := &rtp.Packet{
+		Header:  rtp.Header{SequenceNumber: s.sequenceNumber, Timestamp: s.videoTimestamp, Marker: marker},
+		Payload: payload,
+	}
+	require.NoError(s.t, s.muxer.WritePacket(webrtc.RTPCodecTypeVideo, packet, codecs.VideoTrackCodecH264))
+}
+
+// Write a frame and the audio received while it was displayed
+func (s *testStream) writeFrame(isKeyframe bool) {
+	if isKeyframe {
+		s.writeVideo(newSTAPA(newTestSPS(), testPPS), false)
+		s.writeVideo(testIDR, true)
+	} else {
+		s.writeVideo(testNonIDR, true)
+	}
+
+	s.writeAudio()
+	s.writeAudio()
+	s.videoTimestamp += 3600
+	s.clock = s.clock.Add(40 * time.Millisecond)
+}
+
+func (s *testStream) writeAudio() {
+	packet := &rtp.Packet{Header: rtp.Header{Timestamp: s.audioTimestamp}, Payload: testOpusData}
+	require.NoError(s.t, s.muxer.WritePacket(webrtc.RTPCodecTypeAudio, packet, 0))
+	s.audioTimestamp += 960
+}
+
+func newTestStream(t *testing.T, onKeyframeRequired func()) (*testStream, *testOutput) {
+	output := &testOutput{}
+	stream := &testStream{t: t, clock: time.Unix(1000, 0), videoTimestamp: 90000, audioTimestamp: 48000}
+	stream.muxer = NewMuxer(output, 100*time.Millisecond, onKeyframeRequired)
+	stream.muxer.now = func() time.Time { return stream.clock }
+
+	return stream, output
+}
+
+// Get the payload of the first box of the type, searching into the children of the parent types
+func findBox(t *testing.T, data []byte, path ...string) []byte {
+	for len(data) >= 8 {
+		size := binary.BigEndian.Uint32(data)
+		require.GreaterOrEqual(t, int(size), 8)
+		require.LessOrEqual(t, int(size), len(data))
+
+		if string(data[4:8]) == path[0] {
+			if len(path) == 1 {
+				return data[8:size]
+			}
+
+			return findBox(t, data[8:size], path[1:]...)
+		}
+
+		data = data[size:]
+	}
+
+	return nil
+}
+
+// Get the sample flags and data of the first track of a fragment
+func getFirstSample(t *testing.T, segment []byte) (flags uint32, data []byte) {
+	moofSize := binary.BigEndian.Uint32(segment)
+	trun := findBox(t, segment, "moof", "traf", "trun")
+	require.NotNil(t, trun)
+
+	dataOffset := binary.BigEndian.Uint32(trun[8:])
+	sampleSize := binary.BigEndian.Uint32(trun[16:])
+	flags = binary.BigEndian.Uint32(trun[20:])
+
+	assert.Equal(t, "mdat", string(segment[moofSize+4:moofSize+8]))
+	return flags, segment[dataOffset : dataOffset+sampleSize]
+}
+
+func TestMuxerWritesInitSegmentAndFragments(t *testing.T) {
+	stream, output := newTestStream(t, nil)
+
+	// Audio before the first keyframe is dropped
+	stream.writeAudio()
+	assert.Empty(t, output.segments)
+
+	for i := range 7 {
+		stream.writeFrame(i == 0 || i == 4)
+	}
+
+	require.Equal(t, []string{`video/mp4; codecs="avc1.42c028,opus"`}, output.mimeTypes)
+	require.Len(t, output.segments, 4)
+
+	width, height, err := getSPSPictureSize(newTestSPS())
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1920, 1080}, []uint16{width, height})
+
+	initSegment := output.segments[0]
+	assert.NotNil(t, findBox(t, initSegment, "ftyp"))
+	assert.NotNil(t, findBox(t, initSegment, "moov", "trak", "mdia", "minf", "stbl", "stsd"))
+	assert.NotNil(t, findBox(t, initSegment, "moov", "mvex", "trex"))
+
+	// The second keyframe starts a new fragment
+	for index, segment := range output.segments[1:] {
+		flags, data := getFirstSample(t, segment)
+		if index == 1 {
+			assert.Equal(t, uint32(sampleFlagsNonSync), flags)
+			assert.Equal(t, testNonIDR, data[4:])
+			continue
+		}
+
+		assert.Equal(t, uint32(sampleFlagsSync), flags)
+		assert.Equal(t, testIDR, data[4:])
+	}
+
+	tfdt := findBox(t, output.segments[3], "moof", "traf", "tfdt")
+	assert.Equal(t, uint64(4*3600), binary.BigEndian.Uint64(tfdt[4:]))
+}
+
+func TestMuxerWaitsForKeyframeAfterPacketLoss(t *testing.T) {
+	keyframeRequests := 0
+	stream, output := newTestStream(t, func() { keyframeRequests++ })
+
+	stream.writeFrame(true)
+	stream.writeFrame(false)
+	assert.Equal(t, 0, keyframeRequests)
+
+	stream.sequenceNumber++
+	stream.writeFrame(false)
+	stream.writeFrame(false)
+	assert.Positive(t, keyframeRequests)
+
+	stream.writeFrame(true)
+	stream.writeFrame(false)
+	stream.writeFrame(false)
+	stream.writeFrame(false)
+
+	videoSamples := 0
+	for _, segment := range output.segments[1:] {
+		traf := findBox(t, segment, "moof", "traf")
+		if binary.BigEndian.Uint32(findBox(t, traf, "tfhd")[4:]) == videoTrackID {
+			videoSamples += int(binary.BigEndian.Uint32(findBox(t, traf, "trun")[4:]))
+		}
+	}
+
+	// The frames between the lost packet and the keyframe are dropped, the last frame waits for its duration
+	assert.Equal(t, 5, videoSamples)
+}
+
+func TestMuxerRejectsUnsupportedCodec(t *testing.T) {
+	muxer := NewMuxer(&testOutput{}, 0, nil)
+
+	err := muxer.WritePacket(webrtc.RTPCodecTypeVideo, &rtp.Packet{Payload: []byte{0x10}}, codecs.VideoTrackCodecVP8)
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+	assert.ErrorIs(t, err, ErrUnsupportedCodec)
+	assert.ErrorIs(t, muxer.Err(), ErrUnsupportedCodec)
+}
@@ -0,0 +1,102 @@
+package webrtc
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+var errICERestartMissingCredentials = errors.New("ice restart requires ice-ufrag and ice-pwd")
+
+// Restart ICE on an existing PeerConnection with the new client credentials from a PATCH request.
+// Tracks, data channels and DTLS are kept, only the ICE agent gathers new candidates.
+// Returns the sdpfrag with the new server credentials and candidates.
+func restartICE(peerConnection *webrtc.PeerConnection, ufrag string, pwd string) (string, error) {
+	if ufrag == "" || pwd == "" {
+		return "", errICERestartMissingCredentials
+	}
+
+	slog.Info("WebRTC.RestartICE")
+
+	offer := replaceICECredentials(peerConnection.CurrentRemoteDescription().SDP, ufrag, pwd)
+	if err := peerConnection.SetRemoteDescription(webrtc.SessionDescription{
+		SDP:  offer,
+		Type: webrtc.SDPTypeOffer,
+	}); err != nil {
+		return "", err
+	}
+
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	answer, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	} else if err = peerConnection.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+
+	<-gatherComplete
+	slog.Info("WebRTC.RestartICE: Completed Gathering")
+
+	return getSDPFragment(utils.AppendCandidateToAnswer(peerConnection.LocalDescription().SDP))
+}
+
+// Replace the ICE credentials of a session description and drop its candidates, which belong to the previous ICE session
+func replaceICECredentials(sessionDescription string, ufrag string, pwd string) string {
+	var result strings.Builder
+	for line := range strings.SplitSeq(sessionDescription, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "a=candidate:"), line == "a=end-of-candidates":
+			continue
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			line = "a=ice-ufrag:" + ufrag
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			line = "a=ice-pwd:" + pwd
+		}
+
+		result.WriteString(line + "\r\n")
+	}
+
+	return result.String()
+}
+
+// Build a trickle-ice-sdpfrag (RFC 8840) with the ICE credentials and candidates of a session description
+func getSDPFragment(sessionDescription string) (string, error) {
+	var parsed sdp.SessionDescription
+	if err := parsed.UnmarshalString(sessionDescription); err != nil {
+		return "", err
+	}
+
+	ufrag, _ := parsed.Attribute("ice-ufrag")
+	pwd, _ := parsed.Attribute("ice-pwd")
+
+	var fragment strings.Builder
+	for _, media := range parsed.MediaDescriptions {
+		if ufrag == "" {
+			ufrag, _ = media.Attribute("ice-ufrag")
+		}
+
+		if pwd == "" {
+			pwd, _ = media.Attribute("ice-pwd")
+		}
+
+		mid, _ := media.Attribute("mid")
+		fragment.WriteString("m=" + media.MediaName.String() + "\r\n")
+		fragment.WriteString("a=mid:" + mid + "\r\n")
+
+		for _, attribute := range media.Attributes {
+			if attribute.Key == sdp.AttrKeyCandidate || attribute.Key == sdp.AttrKeyEndOfCandidates {
+				fragment.WriteString("a=" + attribute.String() + "\r\n")
+			}
+		}
+	}
+
+	return "a=ice-ufrag:" + ufrag + "\r\n" + "a=ice-pwd:" + pwd + "\r\n" + fragment.String(), nil
+}
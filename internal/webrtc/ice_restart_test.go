@@ -0,0 +1,60 @@
+package webrtc
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchPeerConnectionRestartsICE(t *testing.T) {
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	server, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer func() { _ = server.Close() }()
+
+	_, err = client.CreateDataChannel("data", nil)
+	require.NoError(t, err)
+
+	offer, err := client.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, client.SetLocalDescription(offer))
+	require.NoError(t, server.SetRemoteDescription(offer))
+
+	answer, err := server.CreateAnswer(nil)
+	require.NoError(t, err)
+	require.NoError(t, server.SetLocalDescription(answer))
+	require.NoError(t, client.SetRemoteDescription(answer))
+
+	// Trickled candidates without new credentials do not restart ICE
+	answerFragment, err := patchPeerConnection(server, "a=ice-ufrag:"+getSdpKeyValue(offer.SDP, "ice-ufrag")+"\r\n")
+	require.NoError(t, err)
+	assert.Empty(t, answerFragment)
+
+	restartOffer, err := client.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	require.NoError(t, err)
+	require.NoError(t, client.SetLocalDescription(restartOffer))
+
+	newUfrag := getSdpKeyValue(restartOffer.SDP, "ice-ufrag")
+	newPwd := getSdpKeyValue(restartOffer.SDP, "ice-pwd")
+	require.NotEqual(t, getSdpKeyValue(offer.SDP, "ice-ufrag"), newUfrag)
+
+	// A malformed candidate rejects the PATCH before the credentials are rotated
+	_, err = patchPeerConnection(server, "a=ice-ufrag:"+newUfrag+"\r\na=ice-pwd:"+newPwd+"\r\na=candidate:invalid\r\n")
+	require.Error(t, err)
+	assert.Equal(t, getSdpKeyValue(offer.SDP, "ice-ufrag"), getSdpKeyValue(server.CurrentRemoteDescription().SDP, "ice-ufrag"))
+
+	answerFragment, err = patchPeerConnection(server, "a=ice-ufrag:"+newUfrag+"\r\na=ice-pwd:"+newPwd+"\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\na=mid:0\r\n")
+	require.NoError(t, err)
+
+	serverUfrag := getSdpKeyValue(answerFragment, "ice-ufrag")
+	assert.NotEmpty(t, serverUfrag)
+	assert.NotEqual(t, getSdpKeyValue(answer.SDP, "ice-ufrag"), serverUfrag)
+	assert.NotEmpty(t, getSdpKeyValue(answerFragment, "ice-pwd"))
+	assert.Contains(t, answerFragment, "a=mid:0")
+	assert.Equal(t, newUfrag, getSdpKeyValue(server.CurrentRemoteDescription().SDP, "ice-ufrag"))
+}
@@ -0,0 +1,11 @@
+package webrtc
+
+import (
+	"github.com/glimesh/broadcast-box/internal/webrtc/peerconnection"
+	"github.com/pion/webrtc/v4"
+)
+
+// Get the ICE servers clients of the provided session should use, the same ones are used server-side
+func GetICEServers(sessionID string) []webrtc.ICEServer {
+	return peerconnection.GetICEServers(sessionID)
+}
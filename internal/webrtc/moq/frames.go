@@ -0,0 +1,102 @@
+package moq
+
+import (
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+
+	pionCodecs "github.com/pion/rtp/codecs"
+)
+
+const (
+	opusCodecName = "opus"
+
+	h264NALUTypeIDR     = 5
+	h264NALUTypeBitmask = 0x1f
+
+	// IDR, CRA and BLA pictures and the reserved IRAP types
+	h265NALUTypeIRAPFirst = 16
+	h265NALUTypeIRAPLast  = 23
+)
+
+// Get the catalog codec of the video codec, empty if it can not be sent
+func getVideoCodecName(codec codecs.TrackCodeType) string {
+	switch codec {
+	case codecs.VideoTrackCodecH264:
+		return "h264"
+	case codecs.VideoTrackCodecH265:
+		return "h265"
+	case codecs.VideoTrackCodecVP8:
+		return "vp8"
+	case codecs.VideoTrackCodecVP9:
+		return "vp9"
+	case codecs.VideoTrackCodecAV1:
+		return "av1"
+	default:
+		return ""
+	}
+}
+
+func newDepacketizer(codec codecs.TrackCodeType) rtp.Depacketizer {
+	switch codec {
+	case codecs.VideoTrackCodecH264:
+		return &pionCodecs.H264Packet{}
+	case codecs.VideoTrackCodecH265:
+		return &pionCodecs.H265Depacketizer{}
+	case codecs.VideoTrackCodecVP8:
+		return &pionCodecs.VP8Packet{}
+	case codecs.VideoTrackCodecVP9:
+		return &pionCodecs.VP9Packet{}
+	case codecs.VideoTrackCodecAV1:
+		return &pionCodecs.AV1Depacketizer{}
+	default:
+		return nil
+	}
+}
+
+// Whether the payload descriptor of the first packet of a frame marks a keyframe, after it was unmarshalled
+func isKeyframeDescriptor(depacketizer rtp.Depacketizer) bool {
+	switch depacketizer := depacketizer.(type) {
+	case *pionCodecs.VP9Packet:
+		return !depacketizer.P
+	case *pionCodecs.AV1Depacketizer:
+		return depacketizer.N
+	default:
+		return false
+	}
+}
+
+// Whether the depacketized frame is a keyframe a decoder can start with
+func isKeyframe(codec codecs.TrackCodeType, frame []byte, isKeyframeDescriptor bool) bool {
+	switch codec {
+	case codecs.VideoTrackCodecH264:
+		return hasAnnexBNALU(frame, func(header byte) bool {
+			return header&h264NALUTypeBitmask == h264NALUTypeIDR
+		})
+	case codecs.VideoTrackCodecH265:
+		return hasAnnexBNALU(frame, func(header byte) bool {
+			naluType := (header >> 1) & 0x3f
+			return naluType >= h265NALUTypeIRAPFirst && naluType <= h265NALUTypeIRAPLast
+		})
+	case codecs.VideoTrackCodecVP8:
+		// Inverse key frame flag of the frame tag
+		return len(frame) != 0 && frame[0]&0x01 == 0
+	default:
+		return isKeyframeDescriptor
+	}
+}
+
+// Whether the header byte of a NALU in the Annex B frame matches
+func hasAnnexBNALU(frame []byte, match func(header byte) bool) bool {
+	for i := 0; i+3 < len(frame); i++ {
+		if frame[i] != 0 || frame[i+1] != 0 || frame[i+2] != 1 {
+			continue
+		}
+
+		if match(frame[i+3]) {
+			return true
+		}
+		i += 2
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package moq
+
+import (
+	"errors"
+	"io"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Track aliases written at the start of each group stream, see WEBTRANSPORT.md for the wire format
+const (
+	CatalogTrackAlias uint64 = 0
+	VideoTrackAlias   uint64 = 1
+	AudioTrackAlias   uint64 = 2
+
+	CatalogTrackName = "catalog"
+	VideoTrackName   = "video"
+	AudioTrackName   = "audio"
+
+	// Largest object a reader accepts
+	maxObjectSize = 16 * 1024 * 1024
+)
+
+var errObjectTooLarge = errors.New("object is larger than 16 MiB")
+
+// Tracks of the stream, sent as the single object of each catalog group
+type Catalog struct {
+	Tracks []CatalogTrack `json:"tracks"`
+}
+
+type CatalogTrack struct {
+	Name  string `json:"name"`
+	Alias uint64 `json:"alias"`
+
+	// h264 and h265 frames are Annex B access units, av1 frames are OBUs with size fields
+	Codec string `json:"codec"`
+}
+
+// Header at the start of each group stream
+type GroupHeader struct {
+	TrackAlias uint64
+	GroupID    uint64
+}
+
+type Object struct {
+	ObjectID uint64
+
+	// Microseconds since the viewer connected
+	Timestamp uint64
+	Payload   []byte
+}
+
+func appendGroupHeader(buffer []byte, header GroupHeader) []byte {
+	buffer = quicvarint.Append(buffer, header.TrackAlias)
+	return quicvarint.Append(buffer, header.GroupID)
+}
+
+func appendObject(buffer []byte, object Object) []byte {
+	buffer = quicvarint.Append(buffer, object.ObjectID)
+	buffer = quicvarint.Append(buffer, object.Timestamp)
+	buffer = quicvarint.Append(buffer, uint64(len(object.Payload)))
+	return append(buffer, object.Payload...)
+}
+
+// Read the header at the start of a group stream
+func ReadGroupHeader(reader quicvarint.Reader) (header GroupHeader, err error) {
+	if header.TrackAlias, err = quicvarint.Read(reader); err != nil {
+		return header, err
+	}
+
+	header.GroupID, err = quicvarint.Read(reader)
+	return header, err
+}
+
+// Read the next object of a group stream, returns io.EOF once the group is complete
+func ReadObject(reader quicvarint.Reader) (object Object, err error) {
+	if object.ObjectID, err = quicvarint.Read(reader); err != nil {
+		return object, err
+	}
+
+	if object.Timestamp, err = quicvarint.Read(reader); err != nil {
+		return object, io.ErrUnexpectedEOF
+	}
+
+	length, err := quicvarint.Read(reader)
+	if err != nil {
+		return object, io.ErrUnexpectedEOF
+	}
+
+	if length > maxObjectSize {
+		return object, errObjectTooLarge
+	}
+
+	object.Payload = make([]byte, length)
+	if _, err = io.ReadFull(reader, object.Payload); err != nil {
+		return object, io.ErrUnexpectedEOF
+	}
+
+	return object, nil
+}
@@ -0,0 +1,402 @@
+package moq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// Audio has no keyframes, it starts a new group at this interval
+	audioGroupDuration = time.Second
+
+	// A group that can not be written for this long is cancelled, the track continues with its next group
+	groupWriteTimeout = time.Second
+
+	// Timestamp jumps of a new publisher continue the track with the previous frame duration
+	maxTimestampJump = 10 * time.Second
+
+	videoClockRate = 90000
+	audioClockRate = 48000
+)
+
+var (
+	ErrUnsupportedCodec = errors.New("video codec can not be sent as a MoQ track")
+
+	errCatalogNotWritten = errors.New("catalog could not be written")
+)
+
+// Opens the streams of a Publisher
+type Output interface {
+	// Open a unidirectional stream for a new group
+	OpenGroupStream() (GroupStream, error)
+}
+
+type GroupStream interface {
+	io.Writer
+	SetWriteDeadline(deadline time.Time) error
+
+	// Close the stream once the group is complete
+	Close() error
+
+	// Abort the stream, the receiver drops the rest of the group
+	Cancel()
+}
+
+// Publishes the RTP packets of a viewer as MoQ tracks. Video starts a group at every keyframe and sends a frame
+// per object, audio sends a packet per object. Packets must be written from a single goroutine.
+type Publisher struct {
+	output Output
+	now    func() time.Time
+
+	onKeyframeRequired func()
+
+	// Object timestamps are relative to the creation of the publisher
+	start time.Time
+
+	catalog track
+	video   videoTrack
+	audio   track
+
+	errLock sync.Mutex
+	err     error
+}
+
+type track struct {
+	alias uint64
+	codec string
+
+	// Current group, nil until the next object starts a group
+	stream     GroupStream
+	groupID    uint64
+	objectID   uint64
+	groupStart uint64
+
+	timeline timeline
+}
+
+type videoTrack struct {
+	track
+
+	trackCodec   codecs.TrackCodeType
+	depacketizer rtp.Depacketizer
+
+	lastSequenceNumber    uint16
+	lastSequenceNumberSet bool
+	isWaitingForKeyframe  bool
+
+	// Frame being received, discarded if a packet of it was lost
+	frame                     []byte
+	frameTimestamp            uint32
+	hasFrame                  bool
+	isFrameBroken             bool
+	isFrameKeyframeDescriptor bool
+}
+
+// Create a publisher writing to output, onKeyframeRequired is called when video can only continue with a keyframe
+func NewPublisher(output Output, onKeyframeRequired func()) *Publisher {
+	return &Publisher{
+		output:             output,
+		now:                time.Now,
+		onKeyframeRequired: onKeyframeRequired,
+		start:              time.Now(),
+		catalog:            track{alias: CatalogTrackAlias},
+		video: videoTrack{
+			track:                track{alias: VideoTrackAlias, timeline: timeline{clockRate: videoClockRate}},
+			isWaitingForKeyframe: true,
+		},
+		audio: track{alias: AudioTrackAlias, timeline: timeline{clockRate: audioClockRate}},
+	}
+}
+
+// Get the error that stopped the publisher, nil while it is running
+func (p *Publisher) Err() error {
+	p.errLock.Lock()
+	defer p.errLock.Unlock()
+
+	return p.err
+}
+
+// Write a packet of the viewer's audio or video track. Returns an error wrapping io.ErrClosedPipe once the publisher
+// stopped, either because no stream could be opened or the codec is not supported.
+func (p *Publisher) WritePacket(kind webrtc.RTPCodecType, packet *rtp.Packet, codec codecs.TrackCodeType) error {
+	if err := p.Err(); err != nil {
+		return err
+	}
+
+	var err error
+	if kind == webrtc.RTPCodecTypeAudio {
+		err = p.writeAudioPacket(packet)
+	} else {
+		err = p.writeVideoPacket(packet, codec)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	p.errLock.Lock()
+	p.err = fmt.Errorf("%w: %w", io.ErrClosedPipe, err)
+	p.errLock.Unlock()
+
+	return p.Err()
+}
+
+func (p *Publisher) writeAudioPacket(packet *rtp.Packet) error {
+	audio := &p.audio
+	if audio.codec == "" {
+		audio.codec = opusCodecName
+		if err := p.writeCatalog(); err != nil {
+			return err
+		}
+	}
+
+	if len(packet.Payload) == 0 {
+		return nil
+	}
+
+	timestamp := audio.timeline.getTimestamp(packet.Timestamp, p.now().Sub(p.start))
+	isNewGroup := audio.stream == nil || timestamp-audio.groupStart >= uint64(audioGroupDuration.Microseconds())
+	if isNewGroup {
+		audio.groupStart = timestamp
+	}
+
+	_, err := p.writeObject(audio, isNewGroup, timestamp, packet.Payload)
+	return err
+}
+
+func (p *Publisher) writeVideoPacket(packet *rtp.Packet, codec codecs.TrackCodeType) error {
+	video := &p.video
+	if codec != video.trackCodec || video.depacketizer == nil {
+		if err := p.setVideoCodec(codec); err != nil {
+			return err
+		}
+	}
+
+	// A lost packet breaks the frame it belongs to and every frame until the next keyframe
+	isPacketLost := video.lastSequenceNumberSet && packet.SequenceNumber != video.lastSequenceNumber+1
+	if isPacketLost {
+		video.depacketizer = newDepacketizer(codec)
+		p.requireKeyframe()
+	}
+	video.lastSequenceNumber = packet.SequenceNumber
+	video.lastSequenceNumberSet = true
+
+	if video.hasFrame && packet.Timestamp != video.frameTimestamp {
+		video.isFrameBroken = video.isFrameBroken || isPacketLost
+		if err := p.completeVideoFrame(); err != nil {
+			return err
+		}
+	}
+
+	isFirstPacket := !video.hasFrame
+	if isFirstPacket {
+		video.hasFrame = true
+		video.frameTimestamp = packet.Timestamp
+		video.isFrameBroken = isPacketLost && !video.depacketizer.IsPartitionHead(packet.Payload)
+	} else if isPacketLost {
+		video.isFrameBroken = true
+	}
+
+	payload, err := video.depacketizer.Unmarshal(packet.Payload)
+	if err != nil {
+		video.isFrameBroken = true
+	}
+	video.frame = append(video.frame, payload...)
+
+	if isFirstPacket {
+		video.isFrameKeyframeDescriptor = isKeyframeDescriptor(video.depacketizer)
+	}
+
+	if packet.Marker {
+		return p.completeVideoFrame()
+	}
+
+	return nil
+}
+
+// Switch to the codec of a new publisher, the catalog announces it before its first keyframe.
+// Viewers already wait for the keyframe of a new publisher, so none is requested.
+func (p *Publisher) setVideoCodec(codec codecs.TrackCodeType) error {
+	codecName := getVideoCodecName(codec)
+	if codecName == "" {
+		return ErrUnsupportedCodec
+	}
+
+	slog.Info("MoQPublisher: Setting video codec", "codec", codecName)
+	video := &p.video
+	video.trackCodec = codec
+	video.codec = codecName
+	video.depacketizer = newDepacketizer(codec)
+	video.frame = nil
+	video.hasFrame = false
+	video.lastSequenceNumberSet = false
+	video.isWaitingForKeyframe = true
+	p.closeGroup(&video.track)
+
+	return p.writeCatalog()
+}
+
+func (p *Publisher) completeVideoFrame() error {
+	video := &p.video
+	frame, timestamp, isFrameBroken := video.frame, video.frameTimestamp, video.isFrameBroken
+	video.frame = nil
+	video.hasFrame = false
+	video.isFrameBroken = false
+
+	if isFrameBroken {
+		p.requireKeyframe()
+		return nil
+	}
+
+	if len(frame) == 0 {
+		return nil
+	}
+
+	isFrameKeyframe := isKeyframe(video.trackCodec, frame, video.isFrameKeyframeDescriptor)
+	if video.isWaitingForKeyframe && !isFrameKeyframe {
+		p.requireKeyframe()
+		return nil
+	}
+	video.isWaitingForKeyframe = false
+
+	objectTimestamp := video.timeline.getTimestamp(timestamp, p.now().Sub(p.start))
+	isWritten, err := p.writeObject(&video.track, isFrameKeyframe, objectTimestamp, frame)
+	if err != nil {
+		return err
+	}
+
+	// The frames after a dropped group depend on it
+	if !isWritten {
+		p.requireKeyframe()
+	}
+
+	return nil
+}
+
+// Send the tracks with a known codec as the single object of a new catalog group
+func (p *Publisher) writeCatalog() error {
+	catalog := Catalog{Tracks: []CatalogTrack{}}
+	if p.video.codec != "" {
+		catalog.Tracks = append(catalog.Tracks, CatalogTrack{Name: VideoTrackName, Alias: VideoTrackAlias, Codec: p.video.codec})
+	}
+
+	if p.audio.codec != "" {
+		catalog.Tracks = append(catalog.Tracks, CatalogTrack{Name: AudioTrackName, Alias: AudioTrackAlias, Codec: p.audio.codec})
+	}
+
+	payload, err := json.Marshal(catalog)
+	if err != nil {
+		return err
+	}
+
+	timestamp := uint64(max(p.now().Sub(p.start), 0).Microseconds())
+	isWritten, err := p.writeObject(&p.catalog, true, timestamp, payload)
+	if err != nil {
+		return err
+	} else if !isWritten {
+		return errCatalogNotWritten
+	}
+
+	p.closeGroup(&p.catalog)
+	return nil
+}
+
+// Write an object to the current group of the track or to a new group. Returns an error if no stream could be
+// opened, a group that could not be written is cancelled and false is returned.
+func (p *Publisher) writeObject(t *track, isNewGroup bool, timestamp uint64, payload []byte) (bool, error) {
+	buffer := []byte{}
+	if isNewGroup || t.stream == nil {
+		p.closeGroup(t)
+
+		stream, err := p.output.OpenGroupStream()
+		if err != nil {
+			return false, err
+		}
+
+		t.stream = stream
+		t.objectID = 0
+		buffer = appendGroupHeader(buffer, GroupHeader{TrackAlias: t.alias, GroupID: t.groupID})
+		t.groupID++
+	}
+
+	buffer = appendObject(buffer, Object{ObjectID: t.objectID, Timestamp: timestamp, Payload: payload})
+	t.objectID++
+
+	err := t.stream.SetWriteDeadline(p.now().Add(groupWriteTimeout))
+	if err == nil {
+		_, err = t.stream.Write(buffer)
+	}
+
+	if err != nil {
+		slog.Debug("MoQPublisher: Dropping group", "trackAlias", t.alias, "groupID", t.groupID-1, "err", err)
+		t.stream.Cancel()
+		t.stream = nil
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (p *Publisher) closeGroup(t *track) {
+	if t.stream == nil {
+		return
+	}
+
+	if err := t.stream.Close(); err != nil {
+		slog.Debug("MoQPublisher: Closing group failed", "trackAlias", t.alias, "err", err)
+	}
+	t.stream = nil
+}
+
+// Drop video until the next keyframe, repeated requests are suppressed by the publisher's keyframe coordinator
+func (p *Publisher) requireKeyframe() {
+	p.video.isWaitingForKeyframe = true
+	p.closeGroup(&p.video.track)
+	if p.onKeyframeRequired != nil {
+		p.onKeyframeRequired()
+	}
+}
+
+// Converts the RTP timestamps of a track to microseconds since the start of the publisher
+type timeline struct {
+	clockRate uint32
+
+	lastTimestamp uint32
+	lastDuration  uint64
+	ticks         uint64
+	isSet         bool
+}
+
+// Get the timestamp of the RTP timestamp. The first frame is placed at its arrival since the start,
+// the following ones by their timestamps.
+func (t *timeline) getTimestamp(timestamp uint32, sinceStart time.Duration) uint64 {
+	if !t.isSet {
+		t.isSet = true
+		t.lastTimestamp = timestamp
+		t.ticks = uint64(max(sinceStart, 0)) * uint64(t.clockRate) / uint64(time.Second)
+		return t.ticks * 1_000_000 / uint64(t.clockRate)
+	}
+
+	difference := int64(int32(timestamp - t.lastTimestamp))
+	t.lastTimestamp = timestamp
+
+	switch {
+	case difference == 0:
+	case difference > 0 && difference <= int64(maxTimestampJump.Seconds())*int64(t.clockRate):
+		t.lastDuration = uint64(difference)
+		t.ticks += t.lastDuration
+	default:
+		t.ticks += max(t.lastDuration, 1)
+	}
+
+	return t.ticks * 1_000_000 / uint64(t.clockRate)
+}
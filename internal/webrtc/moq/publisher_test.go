@@ -0,0 +1,176 @@
+package moq
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testGroupStream struct {
+	bytes.Buffer
+	isClosed    bool
+	isCancelled bool
+	writeErr    error
+}
+
+func (s *testGroupStream) Write(data []byte) (int, error) {
+	if s.writeErr != nil {
+		return 0, s.writeErr
+	}
+
+	return s.Buffer.Write(data)
+}
+
+func (s *testGroupStream) SetWriteDeadline(time.Time) error { return nil }
+func (s *testGroupStream) Close() error                     { s.isClosed = true; return nil }
+func (s *testGroupStream) Cancel()                          { s.isCancelled = true }
+
+type testOutput struct {
+	streams []*testGroupStream
+}
+
+func (o *testOutput) OpenGroupStream() (GroupStream, error) {
+	stream := &testGroupStream{}
+	o.streams = append(o.streams, stream)
+	return stream, nil
+}
+
+// Get the groups of a track, each as the payloads of its objects
+func (o *testOutput) getGroups(t *testing.T, trackAlias uint64) (groups [][][]byte) {
+	for _, stream := range o.streams {
+		reader := bufio.NewReader(bytes.NewReader(stream.Bytes()))
+		header, err := ReadGroupHeader(reader)
+		require.NoError(t, err)
+		if header.TrackAlias != trackAlias {
+			continue
+		}
+		assert.Equal(t, uint64(len(groups)), header.GroupID)
+
+		group := [][]byte{}
+		for {
+			object, err := ReadObject(reader)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			assert.Equal(t, uint64(len(group)), object.ObjectID)
+
+			group = append(group, object.Payload)
+		}
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+type testVideo struct {
+	t         *testing.T
+	publisher *Publisher
+	codec     codecs.TrackCodeType
+
+	sequenceNumber uint16
+	timestamp      uint32
+}
+
+func (v *testVideo) writeFrame(payload []byte) {
+	v.sequenceNumber++
+	v.timestamp += 3000
+
+	packet := &rtp.Packet{
+		Header:  rtp.Header{SequenceNumber: v.sequenceNumber, Timestamp: v.timestamp, Marker: true},
+		Payload: payload,
+	}
+	require.NoError(v.t, v.publisher.WritePacket(webrtc.RTPCodecTypeVideo, packet, v.codec))
+}
+
+var (
+	// Payload descriptor starting a partition followed by the frame tag
+	testVP8Keyframe   = []byte{0x10, 0x00, 0x9d, 0x01}
+	testVP8Interframe = []byte{0x10, 0x01, 0x9d, 0x01}
+
+	testH264IDR    = []byte{0x65, 0x88, 0x84}
+	testH264NonIDR = []byte{0x41, 0x9a, 0x02}
+)
+
+func TestPublisherStartsGroupAtKeyframes(t *testing.T) {
+	output := &testOutput{}
+	video := &testVideo{t: t, publisher: NewPublisher(output, nil), codec: codecs.VideoTrackCodecVP8}
+
+	video.writeFrame(testVP8Interframe)
+	video.writeFrame(testVP8Keyframe)
+	video.writeFrame(testVP8Interframe)
+	video.writeFrame(testVP8Interframe)
+	video.writeFrame(testVP8Keyframe)
+
+	assert.Equal(t, [][][]byte{
+		{testVP8Keyframe[1:], testVP8Interframe[1:], testVP8Interframe[1:]},
+		{testVP8Keyframe[1:]},
+	}, output.getGroups(t, VideoTrackAlias))
+
+	assert.Equal(t, [][][]byte{{[]byte(`{"tracks":[{"name":"video","alias":1,"codec":"vp8"}]}`)}}, output.getGroups(t, CatalogTrackAlias))
+}
+
+func TestPublisherWaitsForKeyframeAfterPacketLoss(t *testing.T) {
+	output := &testOutput{}
+	keyframeRequests := 0
+	video := &testVideo{t: t, publisher: NewPublisher(output, func() { keyframeRequests++ }), codec: codecs.VideoTrackCodecH264}
+
+	video.writeFrame(testH264IDR)
+	video.writeFrame(testH264NonIDR)
+	assert.Equal(t, 0, keyframeRequests)
+
+	video.sequenceNumber++
+	video.writeFrame(testH264NonIDR)
+	video.writeFrame(testH264NonIDR)
+	assert.Positive(t, keyframeRequests)
+
+	video.writeFrame(testH264IDR)
+	video.writeFrame(testH264NonIDR)
+
+	annexB := func(nalu []byte) []byte { return append([]byte{0, 0, 0, 1}, nalu...) }
+	assert.Equal(t, [][][]byte{
+		{annexB(testH264IDR), annexB(testH264NonIDR)},
+		{annexB(testH264IDR), annexB(testH264NonIDR)},
+	}, output.getGroups(t, VideoTrackAlias))
+	assert.True(t, output.streams[1].isClosed)
+}
+
+func TestPublisherCancelsGroupThatCanNotBeWritten(t *testing.T) {
+	output := &testOutput{}
+	keyframeRequests := 0
+	video := &testVideo{t: t, publisher: NewPublisher(output, func() { keyframeRequests++ }), codec: codecs.VideoTrackCodecVP8}
+
+	video.writeFrame(testVP8Keyframe)
+	stream := output.streams[len(output.streams)-1]
+	stream.writeErr = errors.New("deadline exceeded")
+
+	video.writeFrame(testVP8Interframe)
+	assert.True(t, stream.isCancelled)
+	assert.Equal(t, 1, keyframeRequests)
+
+	video.writeFrame(testVP8Interframe)
+	video.writeFrame(testVP8Keyframe)
+
+	stream.writeErr = nil
+	groups := output.getGroups(t, VideoTrackAlias)
+	require.Len(t, groups, 2)
+	assert.Equal(t, [][]byte{testVP8Keyframe[1:]}, groups[1])
+}
+
+func TestPublisherRejectsUnsupportedCodec(t *testing.T) {
+	publisher := NewPublisher(&testOutput{}, nil)
+
+	err := publisher.WritePacket(webrtc.RTPCodecTypeVideo, &rtp.Packet{Payload: []byte{0x10}}, 0)
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+	assert.ErrorIs(t, err, ErrUnsupportedCodec)
+	assert.ErrorIs(t, publisher.Err(), ErrUnsupportedCodec)
+}
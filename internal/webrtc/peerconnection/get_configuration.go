@@ -1,22 +1,66 @@
 package peerconnection
 
 import (
+	"log/slog"
 	"os"
 	"strings"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/turnserver"
+	"github.com/pion/turn/v5"
 	"github.com/pion/webrtc/v4"
 )
 
-func getPeerConnectionConfig() webrtc.Configuration {
-	config := webrtc.Configuration{}
+// Get the PeerConnection configuration, TURN credentials are issued for the provided session
+func getPeerConnectionConfig(sessionID string) webrtc.Configuration {
+	return webrtc.Configuration{
+		ICEServers: GetICEServers(sessionID),
+	}
+}
+
+// Get the configured STUN and TURN servers and the embedded TURN server, ephemeral TURN credentials are issued for the provided session
+func GetICEServers(sessionID string) (iceServers []webrtc.ICEServer) {
 	if stunServers := os.Getenv(environment.STUNServers); stunServers != "" {
 		for stunServer := range strings.SplitSeq(stunServers, "|") {
-			config.ICEServers = append(config.ICEServers, webrtc.ICEServer{
-				URLs: []string{"stun:" + stunServer},
+			// Plain hosts are STUN servers, URLs with a scheme are used as-is
+			if !hasICEServerScheme(stunServer) {
+				stunServer = "stun:" + stunServer
+			}
+
+			iceServers = append(iceServers, webrtc.ICEServer{
+				URLs: []string{stunServer},
 			})
 		}
 	}
 
-	return config
+	if turnServers := os.Getenv(environment.TURNServers); turnServers != "" {
+		iceServer := webrtc.ICEServer{
+			URLs:       strings.Split(turnServers, "|"),
+			Username:   os.Getenv(environment.TURNServersUsername),
+			Credential: os.Getenv(environment.TURNServersCredential),
+		}
+
+		if secret := os.Getenv(environment.TURNServersSecret); secret != "" {
+			username, password, err := turn.GenerateLongTermTURNRESTCredentials(secret, sessionID, turnserver.GetCredentialTTL())
+			if err != nil {
+				slog.Error("PeerConnection.GetICEServers: Generating TURN credentials failed", "err", err)
+			} else {
+				iceServer.Username, iceServer.Credential = username, password
+			}
+		}
+
+		iceServers = append(iceServers, iceServer)
+	}
+
+	return append(iceServers, turnserver.GetICEServers(sessionID)...)
+}
+
+func hasICEServerScheme(url string) bool {
+	for _, scheme := range []string{"stun:", "stuns:", "turn:", "turns:"} {
+		if strings.HasPrefix(url, scheme) {
+			return true
+		}
+	}
+
+	return false
 }
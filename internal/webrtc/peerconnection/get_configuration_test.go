@@ -0,0 +1,31 @@
+package peerconnection
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetICEServers(t *testing.T) {
+	t.Setenv(environment.STUNServers, "stun.example.net:3478|stun:stun2.example.net")
+	t.Setenv(environment.TURNServers, "turn:turn.example.net?transport=udp|turns:turn.example.net")
+	t.Setenv(environment.TURNServersUsername, "static")
+	t.Setenv(environment.TURNServersCredential, "password")
+
+	iceServers := GetICEServers("viewer")
+	require.Len(t, iceServers, 3)
+	assert.Equal(t, []string{"stun:stun.example.net:3478"}, iceServers[0].URLs)
+	assert.Equal(t, []string{"stun:stun2.example.net"}, iceServers[1].URLs)
+	assert.Equal(t, []string{"turn:turn.example.net?transport=udp", "turns:turn.example.net"}, iceServers[2].URLs)
+	assert.Equal(t, "static", iceServers[2].Username)
+	assert.Equal(t, "password", iceServers[2].Credential)
+
+	// Ephemeral credentials take precedence over static ones
+	t.Setenv(environment.TURNServersSecret, "secret")
+	iceServers = GetICEServers("viewer")
+	assert.True(t, strings.HasSuffix(iceServers[2].Username, ":viewer"))
+	assert.NotEqual(t, "password", iceServers[2].Credential)
+}
@@ -4,19 +4,23 @@ import (
 	"log/slog"
 
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/pion/webrtc/v4"
 )
 
-func CreateWHEPPeerConnection() (*webrtc.PeerConnection, error) {
-	return manager.APIWHEP.NewPeerConnection(getPeerConnectionConfig())
+func CreateWHEPPeerConnection(whepSessionID string) (*webrtc.PeerConnection, error) {
+	return manager.GetAPIWHEP().NewPeerConnection(getPeerConnectionConfig(whepSessionID))
 }
 
-func CreateWHIPPeerConnection(offer string) (*webrtc.PeerConnection, error) {
+// Create the publisher PeerConnection and answer the offer. The answer includes all server candidates,
+// unless the client trickles and server side trickle ICE is enabled.
+// TURN credentials are issued for the provided credential id.
+func CreateWHIPPeerConnection(offer string, credentialID string) (*webrtc.PeerConnection, *utils.CandidateCollector, error) {
 	slog.Info("CreateWHIPPeerConnection.CreateWHIPPeerConnection")
 
-	peerConnection, err := manager.APIWHIP.NewPeerConnection(getPeerConnectionConfig())
+	peerConnection, err := manager.GetAPIWHIP().NewPeerConnection(getPeerConnectionConfig(credentialID))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Setup PeerConnection RemoteDescription
@@ -26,23 +30,29 @@ func CreateWHIPPeerConnection(offer string) (*webrtc.PeerConnection, error) {
 	}
 
 	if err := peerConnection.SetRemoteDescription(sessionDescription); err != nil {
-		return nil, err
+		return peerConnection, nil, err
 	}
 
+	candidates := utils.NewCandidateCollector(peerConnection)
 	gatheringCompleteResult := webrtc.GatheringCompletePromise(peerConnection)
 
 	answer, err := peerConnection.CreateAnswer(nil)
 	if err != nil {
-		return nil, err
+		return peerConnection, nil, err
 	}
 
 	if err := peerConnection.SetLocalDescription(answer); err != nil {
-		return nil, err
+		return peerConnection, nil, err
+	}
+
+	if utils.IsTrickleAnswer(offer) {
+		slog.Info("PeerConnection.CreateWHIPPeerConnection: Answering before gathering completed")
+		return peerConnection, candidates, nil
 	}
 
 	// Await gathering trickle
 	<-gatheringCompleteResult
 	slog.Info("PeerConnection.CreateWHIPPeerConnection.GatheringCompleteResult")
 
-	return peerConnection, nil
+	return peerConnection, candidates, nil
 }
@@ -0,0 +1,41 @@
+package manager
+
+import (
+	"sync/atomic"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// The APIs of the UDP mux shards, new PeerConnections are distributed across them round-robin
+type apiShards struct {
+	apis []*webrtc.API
+	next atomic.Uint64
+}
+
+func (a *apiShards) get() *webrtc.API {
+	if a == nil || len(a.apis) == 0 {
+		return nil
+	}
+
+	return a.apis[(a.next.Add(1)-1)%uint64(len(a.apis))]
+}
+
+// Get the API the next publisher PeerConnection is created with
+func GetAPIWHIP() *webrtc.API {
+	return apiWHIP.Load().get()
+}
+
+// Get the API the next viewer PeerConnection is created with
+func GetAPIWHEP() *webrtc.API {
+	return apiWHEP.Load().get()
+}
+
+// Replace the APIs new publisher PeerConnections are created with, existing PeerConnections are not affected
+func SetAPIWHIP(apis ...*webrtc.API) {
+	apiWHIP.Store(&apiShards{apis: apis})
+}
+
+// Replace the APIs new viewer PeerConnections are created with, existing PeerConnections are not affected
+func SetAPIWHEP(apis ...*webrtc.API) {
+	apiWHEP.Store(&apiShards{apis: apis})
+}
@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"log/slog"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+)
+
+// Update the fallback source of an active session
+func (m *SessionManager) UpdateProfileFallback(streamKey string, fallbackStreamKey string, fallbackMediaPath string) {
+	m.sessionsLock.RLock()
+	s, ok := m.sessions[streamKey]
+	m.sessionsLock.RUnlock()
+
+	if ok {
+		s.StatusLock.Lock()
+		s.FallbackStreamKey = fallbackStreamKey
+		s.FallbackMediaPath = fallbackMediaPath
+		s.StatusLock.Unlock()
+	}
+}
+
+// Resolve the session feeding viewers while their publisher is offline.
+// A live fallback stream is preferred over the fallback media file.
+func (m *SessionManager) resolveFallbackSource(fallbackStreamKey string, fallbackMediaPath string) *session.Session {
+	if fallbackStreamKey != "" {
+		if fallbackSession, ok := m.GetSessionByID(fallbackStreamKey); ok && fallbackSession.Host.Load() != nil {
+			return fallbackSession
+		}
+	}
+
+	if fallbackMediaPath != "" {
+		return m.getOrAddSlate(fallbackMediaPath)
+	}
+
+	return nil
+}
+
+// Resolve the fallback again for offline sessions falling back to the stream key,
+// viewers move to the fallback media file while the stream is offline and back once it is live
+func (m *SessionManager) refreshFallbacks(fallbackStreamKey string) {
+	m.sessionsLock.RLock()
+	sessions := make([]*session.Session, 0)
+	for _, s := range m.sessions {
+		s.StatusLock.RLock()
+		if s.FallbackStreamKey == fallbackStreamKey {
+			sessions = append(sessions, s)
+		}
+		s.StatusLock.RUnlock()
+	}
+	m.sessionsLock.RUnlock()
+
+	for _, s := range sessions {
+		s.RefreshFallback()
+	}
+}
+
+// Get the session looping the provided media file, or start it
+func (m *SessionManager) getOrAddSlate(mediaPath string) *session.Session {
+	m.slatesLock.Lock()
+	defer m.slatesLock.Unlock()
+
+	if slate, ok := m.slates[mediaPath]; ok && slate.Host.Load() != nil {
+		return slate
+	}
+
+	host, err := whip.CreateFileSession(mediaPath)
+	if err != nil {
+		slog.Error("SessionManager.GetOrAddSlate", "mediaPath", mediaPath, "err", err)
+		return nil
+	}
+
+	slate := &session.Session{
+		StreamKey:    mediaPath,
+		WHEPSessions: map[string]*whep.WHEPSession{},
+	}
+	slate.SetOnClose(func() {
+		slog.Debug("SessionManager.Slate.Done", "mediaPath", mediaPath)
+		m.slatesLock.Lock()
+		if m.slates[mediaPath] == slate {
+			delete(m.slates, mediaPath)
+		}
+		m.slatesLock.Unlock()
+	})
+
+	if err := slate.AddFileHost(host, mediaPath); err != nil {
+		slog.Error("SessionManager.GetOrAddSlate", "mediaPath", mediaPath, "err", err)
+		return nil
+	}
+
+	m.slates[mediaPath] = slate
+	return slate
+}
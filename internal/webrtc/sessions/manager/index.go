@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"sync"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+)
+
+// Index of WHEP and publisher session IDs and stage invite tokens to their session, so lookups do not scan every session
+type sessionIndex struct {
+	// Protects whepSessions, publishers, stageInvites
+	lock         sync.RWMutex
+	whepSessions map[string]*session.Session
+	publishers   map[string]*session.Session
+	stageInvites map[string]*session.Session
+}
+
+func (i *sessionIndex) AddWHEPSession(whepSessionID string, s *session.Session) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.whepSessions == nil {
+		i.whepSessions = make(map[string]*session.Session)
+	}
+	i.whepSessions[whepSessionID] = s
+}
+
+func (i *sessionIndex) RemoveWHEPSession(whepSessionID string, s *session.Session) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.whepSessions[whepSessionID] == s {
+		delete(i.whepSessions, whepSessionID)
+	}
+}
+
+func (i *sessionIndex) AddPublisher(publisherID string, s *session.Session) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.publishers == nil {
+		i.publishers = make(map[string]*session.Session)
+	}
+	i.publishers[publisherID] = s
+}
+
+func (i *sessionIndex) RemovePublisher(publisherID string, s *session.Session) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.publishers[publisherID] == s {
+		delete(i.publishers, publisherID)
+	}
+}
+
+func (i *sessionIndex) AddStageInvite(token string, s *session.Session) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.stageInvites == nil {
+		i.stageInvites = make(map[string]*session.Session)
+	}
+	i.stageInvites[token] = s
+}
+
+func (i *sessionIndex) RemoveStageInvite(token string, s *session.Session) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.stageInvites[token] == s {
+		delete(i.stageInvites, token)
+	}
+}
+
+func (i *sessionIndex) getWHEPSession(whepSessionID string) (*session.Session, bool) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	s, ok := i.whepSessions[whepSessionID]
+	return s, ok
+}
+
+func (i *sessionIndex) getPublisher(publisherID string) (*session.Session, bool) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	s, ok := i.publishers[publisherID]
+	return s, ok
+}
+
+func (i *sessionIndex) getStageInvite(token string) (*session.Session, bool) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	s, ok := i.stageInvites[token]
+	return s, ok
+}
@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager() *SessionManager {
+	m := &SessionManager{}
+	m.sessions = make(map[string]*session.Session)
+	m.virtualChannels = make(map[string]*virtualChannel)
+	m.slates = make(map[string]*session.Session)
+	return m
+}
+
+func newTestPeerConnection(t testing.TB) *webrtc.PeerConnection {
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = peerConnection.Close() })
+
+	return peerConnection
+}
+
+func TestSessionIndexConcurrentViewers(t *testing.T) {
+	m := newTestManager()
+
+	var wg sync.WaitGroup
+	for streamIndex := range 4 {
+		s, err := m.GetOrAddSession(authorization.PublicProfile{StreamKey: fmt.Sprintf("stream-%d", streamIndex)}, true)
+		require.NoError(t, err)
+		require.NoError(t, s.AddHost(newTestPeerConnection(t), nil))
+
+		_, isFound := m.GetSessionByHostSessionID(s.Host.Load().ID)
+		assert.True(t, isFound)
+
+		for viewerIndex := range 10 {
+			whepSessionID := fmt.Sprintf("viewer-%d-%d", streamIndex, viewerIndex)
+			peerConnection := newTestPeerConnection(t)
+
+			wg.Go(func() {
+				assert.NoError(t, s.AddWHEP(whepSessionID, peerConnection, nil, nil, nil, nil, nil, func(string) {}))
+
+				foundSession, whepSession, isFound := m.GetSessionAndWHEPByID(whepSessionID)
+				if assert.True(t, isFound) {
+					assert.Equal(t, s, foundSession)
+					assert.Equal(t, whepSessionID, whepSession.SessionID)
+				}
+
+				whepSession.Close()
+				_, _, isFound = m.GetSessionAndWHEPByID(whepSessionID)
+				assert.False(t, isFound)
+			})
+		}
+	}
+	wg.Wait()
+
+	assert.Empty(t, m.index.whepSessions)
+}
+
+func TestSessionIndexPublisherChange(t *testing.T) {
+	m := newTestManager()
+
+	s, err := m.GetOrAddSession(authorization.PublicProfile{
+		StreamKey:       "stream",
+		PublisherPolicy: authorization.PublisherPolicyTakeover,
+	}, true)
+	require.NoError(t, err)
+
+	require.NoError(t, s.AddHost(newTestPeerConnection(t), nil))
+	previous := s.Host.Load()
+
+	// The previous publisher leaves before the new one sent a keyframe, the new one takes over right away
+	require.NoError(t, s.AddHost(newTestPeerConnection(t), nil))
+	s.RemovePublisher(previous.ID)
+	host := s.Host.Load()
+	require.NotEqual(t, previous, host)
+
+	_, isFound := m.GetSessionByHostSessionID(previous.ID)
+	assert.False(t, isFound)
+	assert.NotContains(t, m.index.publishers, previous.ID)
+
+	foundSession, isFound := m.GetSessionByHostSessionID(host.ID)
+	assert.True(t, isFound)
+	assert.Equal(t, s, foundSession)
+
+	s.RemovePublisher(host.ID)
+	assert.Empty(t, m.index.publishers)
+}
+
+func TestSessionIndexStageInvites(t *testing.T) {
+	m := newTestManager()
+
+	s, err := m.GetOrAddSession(authorization.PublicProfile{StreamKey: "stream"}, true)
+	require.NoError(t, err)
+	require.NoError(t, s.AddHost(newTestPeerConnection(t), nil))
+
+	invite, err := m.CreateStageInvite("stream")
+	require.NoError(t, err)
+
+	foundSession, isFound := m.GetSessionByStageInvite(invite.Token)
+	assert.True(t, isFound)
+	assert.Equal(t, s, foundSession)
+
+	// The invite leaves the index once a guest used it
+	_, err = s.AddStageGuest(invite.Token, newTestPeerConnection(t), nil)
+	require.NoError(t, err)
+	_, isFound = m.GetSessionByStageInvite(invite.Token)
+	assert.False(t, isFound)
+	assert.Empty(t, m.index.stageInvites)
+
+	// Open invites leave the index when the stage is cleared
+	_, err = m.CreateStageInvite("stream")
+	require.NoError(t, err)
+	s.RemovePublisher(s.Host.Load().ID)
+	assert.Empty(t, m.index.stageInvites)
+}
+
+// Lookups stay constant time with thousands of viewers spread over many sessions
+func BenchmarkGetSessionAndWHEPByID(b *testing.B) {
+	for _, viewerCount := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("viewers-%d", viewerCount), func(b *testing.B) {
+			m := newTestManager()
+			whepSessionIDs := addBenchmarkViewers(b, m, viewerCount)
+
+			for i := 0; b.Loop(); i++ {
+				if _, _, isFound := m.GetSessionAndWHEPByID(whepSessionIDs[i%len(whepSessionIDs)]); !isFound {
+					b.Fatal("expected WHEP session to be found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetSessionByHostSessionID(b *testing.B) {
+	for _, sessionCount := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("sessions-%d", sessionCount), func(b *testing.B) {
+			m := newTestManager()
+			hostIDs := make([]string, 0, sessionCount)
+			for sessionIndex := range sessionCount {
+				s, err := m.GetOrAddSession(authorization.PublicProfile{StreamKey: fmt.Sprintf("stream-%d", sessionIndex)}, true)
+				require.NoError(b, err)
+				require.NoError(b, s.AddHost(newTestPeerConnection(b), nil))
+				hostIDs = append(hostIDs, s.Host.Load().ID)
+			}
+
+			for i := 0; b.Loop(); i++ {
+				if _, isFound := m.GetSessionByHostSessionID(hostIDs[i%len(hostIDs)]); !isFound {
+					b.Fatal("expected host session to be found")
+				}
+			}
+		})
+	}
+}
+
+// Spread viewers over one session per 50 viewers, without PeerConnections to keep the setup fast
+func addBenchmarkViewers(b *testing.B, m *SessionManager, viewerCount int) []string {
+	whepSessionIDs := make([]string, 0, viewerCount)
+	for sessionIndex := range (viewerCount + 49) / 50 {
+		s, err := m.GetOrAddSession(authorization.PublicProfile{StreamKey: fmt.Sprintf("stream-%d", sessionIndex)}, true)
+		require.NoError(b, err)
+
+		for viewerIndex := range min(50, viewerCount-sessionIndex*50) {
+			whepSessionID := fmt.Sprintf("viewer-%d-%d", sessionIndex, viewerIndex)
+			whepSession := whep.CreateNewWHEP(whepSessionID, s.StreamKey, nil, nil, nil, func(string) {})
+
+			s.WHEPSessions[whepSessionID] = whepSession
+			m.index.AddWHEPSession(whepSessionID, s)
+			whepSessionIDs = append(whepSessionIDs, whepSessionID)
+		}
+	}
+
+	return whepSessionIDs
+}
@@ -3,8 +3,10 @@ package manager
 import (
 	"log/slog"
 	"maps"
+	"os"
 	"time"
 
+	"github.com/glimesh/broadcast-box/internal/environment"
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
@@ -15,6 +17,10 @@ func (m *SessionManager) Setup() {
 	slog.Debug("WHIPSessionManager.Setup")
 
 	m.sessions = make(map[string]*session.Session)
+	m.virtualChannels = make(map[string]*virtualChannel)
+	m.slates = make(map[string]*session.Session)
+
+	go m.runVirtualChannelSchedules()
 }
 
 // Add new session
@@ -30,7 +36,20 @@ func (m *SessionManager) addSession(profile authorization.PublicProfile) (s *ses
 
 		WHEPSessions: map[string]*whep.WHEPSession{},
 		ChatManager:  m.ChatManager,
+
+		FallbackStreamKey: profile.FallbackStreamKey,
+		FallbackMediaPath: profile.FallbackMediaPath,
+		PublisherPolicy:   profile.PublisherPolicy,
+
+		ReconnectGracePeriod: getReconnectGracePeriod(),
+		LayerIdleTimeout:     getLayerIdleTimeout(),
 	}
+	s.IsVirtual.Store(m.IsVirtualChannel(profile.StreamKey))
+	s.SetFallbackResolver(m.resolveFallbackSource)
+	s.SetOnStateChanged(func(string) {
+		m.refreshFallbacks(profile.StreamKey)
+	})
+	s.SetIndex(&m.index)
 	s.SetOnClose(func() {
 		slog.Debug("SessionManager.Session.Done")
 		m.sessionsLock.Lock()
@@ -42,6 +61,8 @@ func (m *SessionManager) addSession(profile authorization.PublicProfile) (s *ses
 	m.sessions[profile.StreamKey] = s
 	m.sessionsLock.Unlock()
 
+	m.attachVirtualChannels(s)
+
 	return s, nil
 }
 
@@ -99,7 +120,11 @@ func (m *SessionManager) GetSessionStates(includePrivateStreams bool) (result []
 
 		s.StatusLock.RUnlock()
 
-		host := s.Host.Load()
+		streamSession.KeyframeRequests, streamSession.KeyframeRequestsSuppressed = s.GetKeyframeRequestCounts()
+		streamSession.HasStandbyPublisher = s.HasStandbyPublisher()
+		streamSession.StageGuests = s.GetStageGuests()
+
+		host := s.ActiveHost()
 		if host != nil {
 			host.TracksLock.RLock()
 
@@ -127,6 +152,7 @@ func (m *SessionManager) GetSessionStates(includePrivateStreams bool) (result []
 						PacketsReceived: videoTrack.PacketsReceived.Load(),
 						PacketsDropped:  videoTrack.PacketsDropped.Load(),
 						LastKeyframe:    lastKeyFrame,
+						PLIsSent:        videoTrack.PLIsSent.Load(),
 					})
 			}
 
@@ -135,9 +161,17 @@ func (m *SessionManager) GetSessionStates(includePrivateStreams bool) (result []
 
 		s.WHEPSessionsLock.RLock()
 		for _, whep := range s.WHEPSessions {
-			if !whep.IsSessionClosed.Load() {
-				streamSession.Sessions = append(streamSession.Sessions, whep.GetWHEPSessionStatus())
+			if whep.IsSessionClosed.Load() {
+				continue
+			}
+
+			whepState := whep.GetWHEPSessionStatus()
+			if whepState.VideoPaused {
+				streamSession.PausedViewers++
+			} else {
+				streamSession.EgressBitrate += whepState.VideoBitrate
 			}
+			streamSession.Sessions = append(streamSession.Sessions, whepState)
 		}
 		s.WHEPSessionsLock.RUnlock()
 
@@ -158,6 +192,9 @@ func (m *SessionManager) UpdateProfile(profile *authorization.PersonalProfile) {
 		whipSession.StatusLock.Lock()
 		whipSession.MOTD = profile.MOTD
 		whipSession.IsPublic = profile.IsPublic
+		whipSession.FallbackStreamKey = profile.FallbackStreamKey
+		whipSession.FallbackMediaPath = profile.FallbackMediaPath
+		whipSession.PublisherPolicy = profile.PublisherPolicy
 		whipSession.StatusLock.Unlock()
 	}
 }
@@ -168,15 +205,15 @@ func (m *SessionManager) GetWHEPSessionByID(sessionID string) (whep *whep.WHEPSe
 	return whepSession, foundSession
 }
 
-func (m *SessionManager) SendPLIByWHEPSessionID(sessionID string) {
+// Request a keyframe of the provided layer for the WHEP session
+func (m *SessionManager) SendPLIByWHEPSessionID(sessionID string, layer string) {
 	streamSession, _, foundSession := m.GetSessionAndWHEPByID(sessionID)
 	if !foundSession {
 		slog.Error("SessionManager.SendPLIByWHEPSessionID: WHEP session not found", "sessionID", sessionID)
 		return
 	}
 
-	host := streamSession.Host.Load()
-	if host == nil {
+	if streamSession.ActiveHost() == nil {
 		slog.Error(
 			"SessionManager.SendPLIByWHEPSessionID: WHIP session not found",
 			"whepSessionID", sessionID,
@@ -185,39 +222,63 @@ func (m *SessionManager) SendPLIByWHEPSessionID(sessionID string) {
 		return
 	}
 
-	host.SendPLI()
+	streamSession.RequestKeyframe(layer)
 }
 
+// Get the WHEP session with the provided id and the session it watches
 func (m *SessionManager) GetSessionAndWHEPByID(sessionID string) (streamSession *session.Session, whepSession *whep.WHEPSession, foundSession bool) {
-	m.sessionsLock.RLock()
-	defer m.sessionsLock.RUnlock()
+	streamSession, foundSession = m.index.getWHEPSession(sessionID)
+	if !foundSession {
+		return nil, nil, false
+	}
 
-	for _, session := range m.sessions {
-		session.WHEPSessionsLock.RLock()
-		whepSession, ok := session.WHEPSessions[sessionID]
-		session.WHEPSessionsLock.RUnlock()
-		if ok {
-			return session, whepSession, true
-		}
+	streamSession.WHEPSessionsLock.RLock()
+	whepSession, foundSession = streamSession.WHEPSessions[sessionID]
+	streamSession.WHEPSessionsLock.RUnlock()
+	if !foundSession {
+		return nil, nil, false
 	}
 
-	return nil, nil, false
+	return streamSession, whepSession, true
 }
 
+// Get the session of the host, standby or stage guest publisher with the provided id
 func (m *SessionManager) GetSessionByHostSessionID(sessionID string) (session *session.Session, foundSession bool) {
-	m.sessionsLock.RLock()
-	defer m.sessionsLock.RUnlock()
+	session, foundSession = m.index.getPublisher(sessionID)
+	if !foundSession || session.GetPublisher(sessionID) == nil {
+		return nil, false
+	}
 
-	for _, session := range m.sessions {
-		host := session.Host.Load()
-		if host == nil {
-			continue
-		}
+	return session, true
+}
 
-		if sessionID == host.ID {
-			return session, true
-		}
+// Get the time a session waits for its publisher to reconnect, disabled by default
+func getReconnectGracePeriod() time.Duration {
+	value := os.Getenv(environment.WHIPReconnectGracePeriod)
+	if value == "" {
+		return 0
+	}
+
+	gracePeriod, err := time.ParseDuration(value)
+	if err != nil || gracePeriod < 0 {
+		slog.Error("SessionManager: Invalid reconnect grace period", "value", value, "err", err)
+		return 0
+	}
+
+	return gracePeriod
+}
+
+func getLayerIdleTimeout() time.Duration {
+	value := os.Getenv(environment.WHIPLayerIdleTimeout)
+	if value == "" {
+		return 0
+	}
+
+	idleTimeout, err := time.ParseDuration(value)
+	if err != nil || idleTimeout < 0 {
+		slog.Error("SessionManager: Invalid layer idle timeout", "value", value, "err", err)
+		return 0
 	}
 
-	return nil, false
+	return idleTimeout
 }
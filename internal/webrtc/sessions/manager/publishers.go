@@ -0,0 +1,14 @@
+package manager
+
+// Update how an active session handles a second publisher
+func (m *SessionManager) UpdateProfilePublisherPolicy(streamKey string, publisherPolicy string) {
+	m.sessionsLock.RLock()
+	s, ok := m.sessions[streamKey]
+	m.sessionsLock.RUnlock()
+
+	if ok {
+		s.StatusLock.Lock()
+		s.PublisherPolicy = publisherPolicy
+		s.StatusLock.Unlock()
+	}
+}
@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"errors"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+)
+
+var ErrStreamNotFound = errors.New("stream not found")
+
+// Create a stage invite for the stream with the provided stream key
+func (m *SessionManager) CreateStageInvite(streamKey string) (session.StageInvite, error) {
+	streamSession, ok := m.GetSessionByID(streamKey)
+	if !ok {
+		return session.StageInvite{}, ErrStreamNotFound
+	}
+
+	return streamSession.CreateStageInvite()
+}
+
+// Get the guests on the stage of the stream with the provided stream key
+func (m *SessionManager) GetStageGuests(streamKey string) ([]session.StageGuest, error) {
+	streamSession, ok := m.GetSessionByID(streamKey)
+	if !ok {
+		return nil, ErrStreamNotFound
+	}
+
+	return streamSession.GetStageGuests(), nil
+}
+
+// Remove a guest from the stage of the stream with the provided stream key
+func (m *SessionManager) RemoveStageGuest(streamKey string, guestID string) error {
+	streamSession, ok := m.GetSessionByID(streamKey)
+	if !ok {
+		return ErrStreamNotFound
+	}
+
+	return streamSession.RemoveStageGuest(guestID)
+}
+
+// Get the session that issued the stage invite token
+func (m *SessionManager) GetSessionByStageInvite(token string) (*session.Session, bool) {
+	streamSession, ok := m.index.getStageInvite(token)
+	if !ok || !streamSession.HasStageInvite(token) {
+		return nil, false
+	}
+
+	return streamSession, true
+}
@@ -2,21 +2,33 @@ package manager
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
-	"github.com/pion/webrtc/v4"
 )
 
 var (
 	SessionsManager *SessionManager
 
-	APIWHIP *webrtc.API
-	APIWHEP *webrtc.API
+	// APIs new PeerConnections are created with, replaced when the public IP changes
+	apiWHIP atomic.Pointer[apiShards]
+	apiWHEP atomic.Pointer[apiShards]
 )
 
 type SessionManager struct {
 	sessionsLock sync.RWMutex
 	sessions     map[string]*session.Session
 	ChatManager  *chat.Manager
+
+	// WHEP and publisher session IDs of all sessions
+	index sessionIndex
+
+	// Protects virtualChannels
+	virtualChannelsLock sync.RWMutex
+	virtualChannels     map[string]*virtualChannel
+
+	// Protects slates, sessions looping fallback media files
+	slatesLock sync.Mutex
+	slates     map[string]*session.Session
 }
@@ -0,0 +1,223 @@
+package manager
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+)
+
+const virtualChannelScheduleInterval = time.Second
+
+var (
+	errVirtualChannelNotFound  = errors.New("virtual channel not found")
+	errVirtualChannelIsSource  = errors.New("virtual channel cannot use a virtual channel as source")
+	errVirtualChannelIsStream  = errors.New("stream key is already used by a live stream")
+	errVirtualChannelSameAsKey = errors.New("virtual channel cannot use itself as source")
+)
+
+type virtualChannel struct {
+	streamKey       string
+	sourceStreamKey string
+	schedule        []VirtualChannelScheduleEntry
+}
+
+type VirtualChannelScheduleEntry struct {
+	SourceStreamKey string    `json:"sourceStreamKey"`
+	At              time.Time `json:"at"`
+}
+
+type VirtualChannelState struct {
+	StreamKey       string                        `json:"streamKey"`
+	SourceStreamKey string                        `json:"sourceStreamKey"`
+	IsSourceLive    bool                          `json:"isSourceLive"`
+	Schedule        []VirtualChannelScheduleEntry `json:"schedule"`
+}
+
+// Returns true if the stream key belongs to a virtual channel
+func (m *SessionManager) IsVirtualChannel(streamKey string) bool {
+	m.virtualChannelsLock.RLock()
+	defer m.virtualChannelsLock.RUnlock()
+
+	_, ok := m.virtualChannels[streamKey]
+	return ok
+}
+
+// Create the virtual channel if it does not exist and switch it to the provided source
+func (m *SessionManager) SetVirtualChannelSource(streamKey string, sourceStreamKey string) error {
+	if streamKey == sourceStreamKey {
+		return errVirtualChannelSameAsKey
+	}
+
+	if m.IsVirtualChannel(sourceStreamKey) {
+		return errVirtualChannelIsSource
+	}
+
+	// Viewers waiting for a stream that is not live stay connected and watch the virtual channel
+	if !m.IsVirtualChannel(streamKey) {
+		if existingSession, ok := m.GetSessionByID(streamKey); ok && !existingSession.IsVirtual.Load() {
+			if existingSession.Host.Load() != nil {
+				return errVirtualChannelIsStream
+			}
+
+			existingSession.IsVirtual.Store(true)
+		}
+	}
+
+	slog.Info("SessionManager.SetVirtualChannelSource", "streamKey", streamKey, "sourceStreamKey", sourceStreamKey)
+
+	m.virtualChannelsLock.Lock()
+	channel, ok := m.virtualChannels[streamKey]
+	if !ok {
+		channel = &virtualChannel{streamKey: streamKey}
+		m.virtualChannels[streamKey] = channel
+	}
+	channel.sourceStreamKey = sourceStreamKey
+	m.virtualChannelsLock.Unlock()
+
+	virtualSession, ok := m.GetSessionByID(streamKey)
+	if !ok {
+		return nil
+	}
+
+	sourceSession, ok := m.GetSessionByID(sourceStreamKey)
+	if !ok {
+		sourceSession = nil
+	}
+
+	return virtualSession.SetSource(sourceSession)
+}
+
+// Schedule a source switch of an existing virtual channel
+func (m *SessionManager) ScheduleVirtualChannelSource(streamKey string, sourceStreamKey string, at time.Time) error {
+	if streamKey == sourceStreamKey {
+		return errVirtualChannelSameAsKey
+	}
+
+	if m.IsVirtualChannel(sourceStreamKey) {
+		return errVirtualChannelIsSource
+	}
+
+	m.virtualChannelsLock.Lock()
+	defer m.virtualChannelsLock.Unlock()
+
+	channel, ok := m.virtualChannels[streamKey]
+	if !ok {
+		return errVirtualChannelNotFound
+	}
+
+	channel.schedule = append(channel.schedule, VirtualChannelScheduleEntry{
+		SourceStreamKey: sourceStreamKey,
+		At:              at,
+	})
+	slices.SortFunc(channel.schedule, func(a, b VirtualChannelScheduleEntry) int {
+		return a.At.Compare(b.At)
+	})
+
+	return nil
+}
+
+// Remove a virtual channel, connected viewers are disconnected
+func (m *SessionManager) RemoveVirtualChannel(streamKey string) error {
+	m.virtualChannelsLock.Lock()
+	_, ok := m.virtualChannels[streamKey]
+	delete(m.virtualChannels, streamKey)
+	m.virtualChannelsLock.Unlock()
+
+	if !ok {
+		return errVirtualChannelNotFound
+	}
+
+	if virtualSession, ok := m.GetSessionByID(streamKey); ok {
+		virtualSession.Close()
+	}
+
+	return nil
+}
+
+// Gets the current state of all virtual channels
+func (m *SessionManager) GetVirtualChannelStates() (result []VirtualChannelState) {
+	m.virtualChannelsLock.RLock()
+	defer m.virtualChannelsLock.RUnlock()
+
+	result = []VirtualChannelState{}
+	for _, channel := range m.virtualChannels {
+		sourceSession, ok := m.GetSessionByID(channel.sourceStreamKey)
+
+		result = append(result, VirtualChannelState{
+			StreamKey:       channel.streamKey,
+			SourceStreamKey: channel.sourceStreamKey,
+			IsSourceLive:    ok && sourceSession.Host.Load() != nil,
+			Schedule:        slices.Clone(channel.schedule),
+		})
+	}
+
+	return result
+}
+
+// Connect a newly created session to the virtual channels it is part of
+func (m *SessionManager) attachVirtualChannels(s *session.Session) {
+	m.virtualChannelsLock.RLock()
+	var relayStreamKeys []string
+	sourceStreamKey := ""
+	for _, channel := range m.virtualChannels {
+		if channel.streamKey == s.StreamKey {
+			sourceStreamKey = channel.sourceStreamKey
+		} else if channel.sourceStreamKey == s.StreamKey {
+			relayStreamKeys = append(relayStreamKeys, channel.streamKey)
+		}
+	}
+	m.virtualChannelsLock.RUnlock()
+
+	if s.IsVirtual.Load() {
+		if sourceSession, ok := m.GetSessionByID(sourceStreamKey); ok {
+			if err := s.SetSource(sourceSession); err != nil {
+				slog.Error("SessionManager.AttachVirtualChannels", "streamKey", s.StreamKey, "err", err)
+			}
+		}
+
+		return
+	}
+
+	for _, relayStreamKey := range relayStreamKeys {
+		if relaySession, ok := m.GetSessionByID(relayStreamKey); ok {
+			if err := relaySession.SetSource(s); err != nil {
+				slog.Error("SessionManager.AttachVirtualChannels", "streamKey", relayStreamKey, "err", err)
+			}
+		}
+	}
+}
+
+func (m *SessionManager) runVirtualChannelSchedules() {
+	ticker := time.NewTicker(virtualChannelScheduleInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for streamKey, sourceStreamKey := range m.popDueVirtualChannelSwitches(now) {
+			if err := m.SetVirtualChannelSource(streamKey, sourceStreamKey); err != nil {
+				slog.Error("SessionManager.VirtualChannelSchedule", "streamKey", streamKey, "sourceStreamKey", sourceStreamKey, "err", err)
+			}
+		}
+	}
+}
+
+// Removes all schedule entries that are due and returns the latest source per virtual channel
+func (m *SessionManager) popDueVirtualChannelSwitches(now time.Time) map[string]string {
+	m.virtualChannelsLock.Lock()
+	defer m.virtualChannelsLock.Unlock()
+
+	switches := map[string]string{}
+	for _, channel := range m.virtualChannels {
+		due := 0
+		for due < len(channel.schedule) && !channel.schedule[due].At.After(now) {
+			switches[channel.streamKey] = channel.schedule[due].SourceStreamKey
+			due++
+		}
+
+		channel.schedule = channel.schedule[due:]
+	}
+
+	return switches
+}
@@ -0,0 +1,31 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualChannelStreamKeyInUse(t *testing.T) {
+	m := newTestManager()
+
+	source, err := m.GetOrAddSession(authorization.PublicProfile{StreamKey: "source"}, true)
+	require.NoError(t, err)
+	require.NoError(t, source.AddHost(newTestPeerConnection(t), nil))
+
+	// A stream with a publisher can not be replaced
+	live, err := m.GetOrAddSession(authorization.PublicProfile{StreamKey: "live"}, true)
+	require.NoError(t, err)
+	require.NoError(t, live.AddHost(newTestPeerConnection(t), nil))
+	assert.ErrorIs(t, m.SetVirtualChannelSource("live", "source"), errVirtualChannelIsStream)
+	assert.False(t, m.IsVirtualChannel("live"))
+
+	// Viewers waiting for a stream without a publisher watch the virtual channel
+	waiting, err := m.GetOrAddSession(authorization.PublicProfile{StreamKey: "waiting"}, false)
+	require.NoError(t, err)
+	require.NoError(t, m.SetVirtualChannelSource("waiting", "source"))
+	assert.True(t, waiting.IsVirtual.Load())
+	assert.Equal(t, source, waiting.GetSource())
+}
@@ -86,6 +86,10 @@ func (s *Session) bindDataChannel(peerID string, dataChannel *webrtc.DataChannel
 			return
 		}
 
+		if msg.IsString && s.handleMediaControlMessage(peerID, msg.Data) {
+			return
+		}
+
 		s.broadcastDataChannelFrom(register(), msg.Data, msg.IsString)
 	})
 	dataChannel.OnClose(func() {
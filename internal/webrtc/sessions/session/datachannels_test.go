@@ -4,6 +4,7 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -89,3 +90,19 @@ func (f *fakeDataChannel) SendText(s string) error {
 	f.textMessages = append(f.textMessages, s)
 	return nil
 }
+
+func TestDataChannelMediaControl(t *testing.T) {
+	viewer := whep.CreateNewWHEP("viewer", "stream-1", nil, nil, nil, func(string) {})
+	s := &Session{StreamKey: "stream-1", WHEPSessions: map[string]*whep.WHEPSession{viewer.SessionID: viewer}}
+
+	assert.True(t, s.handleMediaControlMessage(viewer.SessionID, []byte(`{"type":"media.pause","kind":"audio"}`)))
+	assert.True(t, viewer.IsAudioPaused())
+	assert.False(t, viewer.IsVideoPaused())
+
+	assert.True(t, s.handleMediaControlMessage(viewer.SessionID, []byte(`{"type":"media.resume","kind":"audio"}`)))
+	assert.False(t, viewer.IsAudioPaused())
+
+	// Other payloads are broadcast
+	assert.False(t, s.handleMediaControlMessage(viewer.SessionID, []byte("hello")))
+	assert.False(t, s.handleMediaControlMessage(viewer.SessionID, []byte(`{"type":"chat"}`)))
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+)
+
+// Set the function used to resolve fallback sources by stream key or media path
+func (s *Session) SetFallbackResolver(resolver func(fallbackStreamKey string, fallbackMediaPath string) *Session) {
+	s.fallbackResolver = resolver
+}
+
+// Feed viewers from the configured fallback source while the host is absent
+func (s *Session) startFallback() {
+	s.StatusLock.RLock()
+	fallbackStreamKey := s.FallbackStreamKey
+	fallbackMediaPath := s.FallbackMediaPath
+	s.StatusLock.RUnlock()
+
+	if s.IsVirtual.Load() || s.fallbackResolver == nil || (fallbackStreamKey == "" && fallbackMediaPath == "") {
+		return
+	}
+
+	source := s.fallbackResolver(fallbackStreamKey, fallbackMediaPath)
+	if source == nil {
+		slog.Info("Session.StartFallback: No fallback source available", "streamKey", s.StreamKey)
+		s.stopFallback()
+		return
+	}
+
+	slog.Info("Session.StartFallback", "streamKey", s.StreamKey, "fallbackStreamKey", fallbackStreamKey, "fallbackMediaPath", fallbackMediaPath)
+	if err := s.SetSource(source); err != nil {
+		slog.Error("Session.StartFallback", "streamKey", s.StreamKey, "err", err)
+	}
+}
+
+// Resolve the fallback source again while the publisher is offline, used when the state of a fallback source changed
+func (s *Session) RefreshFallback() {
+	if s.Host.Load() != nil || s.isReconnecting() || s.GetState() != StreamStateOffline {
+		return
+	}
+
+	s.startFallback()
+}
+
+// Hand viewers back to the host of the session
+func (s *Session) stopFallback() {
+	if s.IsVirtual.Load() || s.source.Load() == nil {
+		return
+	}
+
+	slog.Info("Session.StopFallback", "streamKey", s.StreamKey)
+	if err := s.SetSource(nil); err != nil {
+		slog.Error("Session.StopFallback", "streamKey", s.StreamKey, "err", err)
+	}
+}
+
+// Add a host publishing a looping media file, used for offline slates
+func (s *Session) AddFileHost(host *whip.WHIPSession, mediaPath string) error {
+	if !s.Host.CompareAndSwap(nil, host) {
+		return fmt.Errorf("session already has a host")
+	}
+
+	host.SetOnClosed(func() {
+		s.handleHostClosed(false)
+	})
+	s.updateHostWHEPSessionsSnapshot()
+	s.HasHost.Store(true)
+	s.setState(StreamStateLive)
+
+	host.StartFilePlayback(mediaPath, s.StreamKey)
+	return nil
+}
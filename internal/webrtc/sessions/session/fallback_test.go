@@ -0,0 +1,75 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionFallbackOnHostClosed(t *testing.T) {
+	fallback := newTestSessionWithHost("brb")
+	s := newTestSessionWithHost("main")
+	s.FallbackStreamKey = fallback.StreamKey
+	s.SetFallbackResolver(func(fallbackStreamKey string, _ string) *Session {
+		assert.Equal(t, fallback.StreamKey, fallbackStreamKey)
+		return fallback
+	})
+	s.setState(StreamStateLive)
+
+	viewer := whep.CreateNewWHEP("viewer", s.StreamKey, nil, nil, nil, func(string) {})
+	s.WHEPSessions[viewer.SessionID] = viewer
+	s.updateHostWHEPSessionsSnapshot()
+
+	// Publisher drops, viewer is fed by the fallback
+	stateChanged := s.StateChanged()
+	s.handleHostClosed(false)
+	assert.Equal(t, StreamStateOffline, s.GetState())
+	assert.Equal(t, fallback, s.GetSource())
+	assert.Contains(t, hostSnapshot(fallback), viewer.SessionID)
+	select {
+	case <-stateChanged:
+	default:
+		t.Fatal("expected state change to be signalled")
+	}
+
+	// Publisher reconnects, viewer is handed back
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer func() { _ = peerConnection.Close() }()
+
+	require.NoError(t, s.AddHost(peerConnection, nil))
+	assert.Equal(t, StreamStateLive, s.GetState())
+	assert.Nil(t, s.GetSource())
+	assert.NotContains(t, hostSnapshot(fallback), viewer.SessionID)
+	assert.Contains(t, hostSnapshot(s), viewer.SessionID)
+}
+
+func TestSessionFallbackRefreshedWhenFallbackGoesOffline(t *testing.T) {
+	fallback := newTestSessionWithHost("brb")
+	slate := newTestSessionWithHost("slate.ivf")
+	s := newTestSessionWithHost("main")
+	s.FallbackStreamKey = fallback.StreamKey
+	s.FallbackMediaPath = slate.StreamKey
+	s.SetFallbackResolver(func(string, string) *Session {
+		if fallback.Host.Load() != nil {
+			return fallback
+		}
+		return slate
+	})
+	fallback.SetOnStateChanged(func(string) { s.RefreshFallback() })
+
+	viewer := whep.CreateNewWHEP("viewer", s.StreamKey, nil, nil, nil, func(string) {})
+	s.WHEPSessions[viewer.SessionID] = viewer
+
+	s.handleHostClosed(false)
+	assert.Equal(t, fallback, s.GetSource())
+
+	// The fallback stream drops while it feeds the viewers, they move on to the slate
+	fallback.setState(StreamStateLive)
+	fallback.handleHostClosed(false)
+	assert.Equal(t, slate, s.GetSource())
+	assert.Contains(t, hostSnapshot(slate), viewer.SessionID)
+}
@@ -0,0 +1,57 @@
+package session
+
+import "github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+
+// Lookup of WHEP and publisher session IDs and stage invite tokens to the session they belong to, kept up to date by the session
+type Index interface {
+	AddWHEPSession(whepSessionID string, s *Session)
+	RemoveWHEPSession(whepSessionID string, s *Session)
+	AddPublisher(publisherID string, s *Session)
+	RemovePublisher(publisherID string, s *Session)
+	AddStageInvite(token string, s *Session)
+	RemoveStageInvite(token string, s *Session)
+}
+
+func (s *Session) SetIndex(index Index) {
+	s.index = index
+}
+
+func (s *Session) indexWHEPSession(whepSessionID string) {
+	if s.index != nil {
+		s.index.AddWHEPSession(whepSessionID, s)
+	}
+}
+
+func (s *Session) unindexWHEPSession(whepSessionID string) {
+	if s.index != nil {
+		s.index.RemoveWHEPSession(whepSessionID, s)
+	}
+}
+
+func (s *Session) indexPublisher(publisher *whip.WHIPSession) {
+	if s.index != nil {
+		s.index.AddPublisher(publisher.ID, s)
+	}
+}
+
+// Disconnect a publisher that left the session and remove it from the index
+func (s *Session) releasePublisher(publisher *whip.WHIPSession) {
+	publisher.RemovePeerConnection()
+	publisher.RemoveTracks()
+
+	if s.index != nil {
+		s.index.RemovePublisher(publisher.ID, s)
+	}
+}
+
+func (s *Session) indexStageInvite(token string) {
+	if s.index != nil {
+		s.index.AddStageInvite(token, s)
+	}
+}
+
+func (s *Session) unindexStageInvite(token string) {
+	if s.index != nil {
+		s.index.RemoveStageInvite(token, s)
+	}
+}
@@ -0,0 +1,73 @@
+package session
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Minimum time between two keyframe requests for the same layer of a host
+const keyframeRequestInterval = 500 * time.Millisecond
+
+// Aggregates keyframe requests of all viewers so the publisher receives
+// at most one PLI per simulcast layer per interval
+type keyframeCoordinator struct {
+	// Protects hostID, lastSent
+	lock     sync.Mutex
+	hostID   string
+	lastSent map[string]time.Time
+
+	requested  atomic.Uint64
+	suppressed atomic.Uint64
+}
+
+// Request a keyframe of the provided simulcast layer, or all layers when empty, from the host
+// feeding this session. Requests within the minimum interval of a previous one are dropped.
+func (s *Session) RequestKeyframe(layer string) {
+	host := s.Host.Load()
+	if host == nil {
+		if source := s.source.Load(); source != nil {
+			source.RequestKeyframe(layer)
+		}
+		return
+	}
+
+	s.keyframes.requested.Add(1)
+	if !s.keyframes.allow(host.ID, layer, time.Now()) {
+		s.keyframes.suppressed.Add(1)
+		return
+	}
+
+	if !host.SendPLIForLayer(layer) {
+		slog.Debug("Session.RequestKeyframe: No video track to request keyframe from", "streamKey", s.StreamKey, "layer", layer)
+	}
+}
+
+// Returns the number of keyframe requests received and how many of them were suppressed
+func (s *Session) GetKeyframeRequestCounts() (requested uint64, suppressed uint64) {
+	return s.keyframes.requested.Load(), s.keyframes.suppressed.Load()
+}
+
+func (c *keyframeCoordinator) allow(hostID string, layer string, now time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// A new host has not been asked for anything yet
+	if c.lastSent == nil || c.hostID != hostID {
+		c.hostID = hostID
+		c.lastSent = map[string]time.Time{}
+	}
+
+	if lastSent, ok := c.lastSent[layer]; ok && now.Sub(lastSent) < keyframeRequestInterval {
+		return false
+	}
+
+	// A request for all layers covers every single layer
+	if allLayers, ok := c.lastSent[""]; ok && now.Sub(allLayers) < keyframeRequestInterval {
+		return false
+	}
+
+	c.lastSent[layer] = now
+	return true
+}
@@ -0,0 +1,25 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyframeCoordinatorThrottlesPerLayer(t *testing.T) {
+	var c keyframeCoordinator
+	now := time.Now()
+
+	assert.True(t, c.allow("host", "high", now))
+	assert.False(t, c.allow("host", "high", now.Add(keyframeRequestInterval/2)))
+	assert.True(t, c.allow("host", "low", now.Add(keyframeRequestInterval/2)))
+	assert.True(t, c.allow("host", "high", now.Add(keyframeRequestInterval)))
+
+	// Requests for all layers suppress single layer requests
+	assert.True(t, c.allow("host", "", now.Add(2*keyframeRequestInterval)))
+	assert.False(t, c.allow("host", "low", now.Add(2*keyframeRequestInterval)))
+
+	// A new host is asked right away
+	assert.True(t, c.allow("other", "low", now.Add(2*keyframeRequestInterval)))
+}
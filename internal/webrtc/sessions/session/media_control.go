@@ -0,0 +1,49 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+)
+
+const (
+	mediaControlPause  = "media.pause"
+	mediaControlResume = "media.resume"
+)
+
+// Control message a viewer sends on the data channel to pause or resume its media
+type mediaControlMessage struct {
+	Type string `json:"type"`
+	Kind string `json:"kind"`
+}
+
+// Handle a media control message from a viewer on the data channel.
+// Returns false if the payload is not a control message, those are broadcast as usual.
+func (s *Session) handleMediaControlMessage(peerID string, payload []byte) bool {
+	if !bytes.HasPrefix(bytes.TrimSpace(payload), []byte("{")) {
+		return false
+	}
+
+	var message mediaControlMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		return false
+	}
+	if message.Type != mediaControlPause && message.Type != mediaControlResume {
+		return false
+	}
+
+	s.WHEPSessionsLock.RLock()
+	whepSession, ok := s.WHEPSessions[peerID]
+	s.WHEPSessionsLock.RUnlock()
+
+	if !ok {
+		slog.Warn("DataDC.MediaControl: sender is not a viewer", "streamKey", s.StreamKey, "peerID", peerID)
+		return true
+	}
+
+	if err := whepSession.SetMediaPaused(message.Kind, message.Type == mediaControlPause); err != nil {
+		slog.Warn("DataDC.MediaControl: invalid message", "streamKey", s.StreamKey, "peerID", peerID, "err", err)
+	}
+
+	return true
+}
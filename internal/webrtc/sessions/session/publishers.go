@@ -0,0 +1,235 @@
+package session
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// Time without packets from the primary publisher before a standby publisher takes over
+	publisherStallTimeout = 3 * time.Second
+
+	// Time a publisher taking over waits for its first keyframe before it replaces the host without one
+	takeoverKeyframeTimeout = 10 * time.Second
+	takeoverPollInterval    = 100 * time.Millisecond
+)
+
+// Store a new publisher as host or standby. A publisher taking over waits as standby until its first keyframe.
+// Returns the host or standby it replaced, and if the publisher is waiting as standby.
+func (s *Session) setPublisher(host *whip.WHIPSession, publisherPolicy string) (replaced *whip.WHIPSession, isStandby bool, err error) {
+	s.publishersLock.Lock()
+	defer s.publishersLock.Unlock()
+
+	current := s.Host.Load()
+	if current == nil || isPublisherClosed(current) {
+		s.Host.Store(host)
+		return current, false, nil
+	}
+
+	switch publisherPolicy {
+	case authorization.PublisherPolicyTakeover:
+		return s.standby.Swap(host), true, nil
+
+	case authorization.PublisherPolicyStandby:
+		if s.standby.Load() != nil {
+			return nil, false, fmt.Errorf("session already has a standby host")
+		}
+
+		s.standby.Store(host)
+		return nil, true, nil
+
+	default:
+		return nil, false, fmt.Errorf("session already has a host")
+	}
+}
+
+// Get the host, standby or stage guest publisher with the provided id
+func (s *Session) GetPublisher(id string) *whip.WHIPSession {
+	if host := s.Host.Load(); host != nil && host.ID == id {
+		return host
+	}
+
+	if standby := s.standby.Load(); standby != nil && standby.ID == id {
+		return standby
+	}
+
+	return s.getStageGuest(id)
+}
+
+// Returns true if a standby publisher is waiting to take over
+func (s *Session) HasStandbyPublisher() bool {
+	return s.standby.Load() != nil
+}
+
+// Remove the host, standby or stage guest publisher with the provided id
+func (s *Session) RemovePublisher(id string) {
+	if guest := s.getStageGuest(id); guest != nil {
+		s.removeStageGuest(guest)
+		return
+	}
+
+	if standby := s.standby.Load(); standby != nil && standby.ID == id {
+		s.removeStandby(standby)
+		return
+	}
+
+	if host := s.Host.Load(); host != nil && host.ID == id {
+		s.handlePublisherClosed(host, true)
+	}
+}
+
+// Handle a publisher that disconnected, or was removed by its owner when isRemoved is set
+func (s *Session) handlePublisherClosed(host *whip.WHIPSession, isRemoved bool) {
+	if s.removeStandby(host) {
+		return
+	}
+
+	// The publisher was already replaced by a takeover or a promoted standby
+	if s.Host.Load() != host {
+		return
+	}
+
+	if s.promoteStandby(host) {
+		return
+	}
+
+	s.handleHostClosed(isRemoved)
+}
+
+func (s *Session) removeStandby(standby *whip.WHIPSession) bool {
+	if !s.standby.CompareAndSwap(standby, nil) {
+		return false
+	}
+
+	slog.Info("Session.RemoveStandby", "streamKey", s.StreamKey, "id", standby.ID)
+	s.releasePublisher(standby)
+	return true
+}
+
+// Make the standby publisher the host in place of the provided host, viewers switch on the next keyframe.
+// The standby receives the viewers before it becomes the host, so none of its packets go to an empty snapshot.
+func (s *Session) promoteStandby(previous *whip.WHIPSession) bool {
+	s.publishersLock.Lock()
+	standby := s.standby.Load()
+	if standby == nil || s.Host.Load() != previous {
+		s.publishersLock.Unlock()
+		return false
+	}
+
+	previous.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
+	s.resetWHEPSessionsForNewHost()
+	standby.WHEPSessionsSnapshot.Store(s.getWHEPSessionsSnapshot())
+
+	s.Host.Store(standby)
+	s.standby.Store(nil)
+	s.publishersLock.Unlock()
+
+	slog.Info("Session.PromoteStandby", "streamKey", s.StreamKey, "previous", previous.ID, "id", standby.ID)
+	s.releasePublisher(previous)
+
+	// Viewers that joined during the switch were added to the snapshot of the previous host
+	s.updateHostWHEPSessionsSnapshot()
+	s.RequestKeyframe("")
+	return true
+}
+
+// Promote the standby publisher once the primary stops sending packets
+func (s *Session) watchPrimaryPublisher(standby *whip.WHIPSession) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var primary *whip.WHIPSession
+	var lastPacketsReceived uint64
+	lastProgress := time.Now()
+
+	for now := range ticker.C {
+		if s.standby.Load() != standby {
+			return
+		}
+
+		host := s.Host.Load()
+		packetsReceived := getPacketsReceived(host)
+		if host != primary || packetsReceived != lastPacketsReceived {
+			primary = host
+			lastPacketsReceived = packetsReceived
+			lastProgress = now
+			continue
+		}
+
+		if now.Sub(lastProgress) >= publisherStallTimeout {
+			slog.Info("Session.WatchPrimaryPublisher: Primary publisher stalled", "streamKey", s.StreamKey)
+			if host == nil || !s.promoteStandby(host) {
+				continue
+			}
+
+			return
+		}
+	}
+}
+
+// Promote the publisher taking over once its video sent a keyframe, the current host feeds viewers until then
+func (s *Session) watchTakeoverPublisher(incoming *whip.WHIPSession) {
+	ticker := time.NewTicker(takeoverPollInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for now := range ticker.C {
+		if s.standby.Load() != incoming {
+			return
+		}
+
+		if !hasReceivedKeyframe(incoming) && now.Sub(start) < takeoverKeyframeTimeout {
+			continue
+		}
+
+		if host := s.Host.Load(); host == nil || s.promoteStandby(host) {
+			return
+		}
+	}
+}
+
+// Returns true once a video track of the publisher received a keyframe
+func hasReceivedKeyframe(host *whip.WHIPSession) bool {
+	host.TracksLock.RLock()
+	defer host.TracksLock.RUnlock()
+
+	for _, track := range host.VideoTracks {
+		if track.LastKeyFrame.Load() != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if the publisher no longer has an open PeerConnection
+func isPublisherClosed(host *whip.WHIPSession) bool {
+	host.PeerConnectionLock.RLock()
+	defer host.PeerConnectionLock.RUnlock()
+
+	return host.PeerConnection == nil || host.PeerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed
+}
+
+func getPacketsReceived(host *whip.WHIPSession) (packetsReceived uint64) {
+	if host == nil {
+		return 0
+	}
+
+	host.TracksLock.RLock()
+	defer host.TracksLock.RUnlock()
+
+	for _, track := range host.AudioTracks {
+		packetsReceived += track.PacketsReceived.Load()
+	}
+	for _, track := range host.VideoTracks {
+		packetsReceived += track.PacketsReceived.Load()
+	}
+
+	return packetsReceived
+}
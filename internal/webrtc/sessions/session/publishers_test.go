@@ -0,0 +1,118 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPublisher(t *testing.T) *webrtc.PeerConnection {
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = peerConnection.Close() })
+
+	return peerConnection
+}
+
+// Index that reports released publishers
+type publisherReleaseIndex struct {
+	released chan string
+}
+
+func (i *publisherReleaseIndex) AddWHEPSession(string, *Session)    {}
+func (i *publisherReleaseIndex) RemoveWHEPSession(string, *Session) {}
+func (i *publisherReleaseIndex) AddPublisher(string, *Session)      {}
+func (i *publisherReleaseIndex) AddStageInvite(string, *Session)    {}
+func (i *publisherReleaseIndex) RemoveStageInvite(string, *Session) {}
+func (i *publisherReleaseIndex) RemovePublisher(publisherID string, _ *Session) {
+	i.released <- publisherID
+}
+
+func TestSessionPublisherPolicyReject(t *testing.T) {
+	s := &Session{StreamKey: "main", WHEPSessions: map[string]*whep.WHEPSession{}}
+
+	require.NoError(t, s.AddHost(newTestPublisher(t), nil))
+	host := s.Host.Load()
+
+	assert.Error(t, s.AddHost(newTestPublisher(t), nil))
+	assert.Equal(t, host, s.Host.Load())
+}
+
+func TestSessionPublisherPolicyTakeover(t *testing.T) {
+	index := &publisherReleaseIndex{released: make(chan string, 1)}
+	s := &Session{StreamKey: "main", WHEPSessions: map[string]*whep.WHEPSession{}, PublisherPolicy: authorization.PublisherPolicyTakeover, index: index}
+
+	require.NoError(t, s.AddHost(newTestPublisher(t), nil))
+	previous := s.Host.Load()
+
+	viewer := whep.CreateNewWHEP("viewer", s.StreamKey, nil, nil, nil, func(string) {})
+	s.WHEPSessions[viewer.SessionID] = viewer
+	s.updateHostWHEPSessionsSnapshot()
+
+	// The previous publisher feeds viewers until the new publisher sent a keyframe
+	require.NoError(t, s.AddHost(newTestPublisher(t), nil))
+	host := s.standby.Load()
+	require.NotNil(t, host)
+	time.Sleep(2 * takeoverPollInterval)
+	assert.Equal(t, previous, s.Host.Load())
+	assert.Contains(t, hostSnapshot(s), viewer.SessionID)
+
+	videoTrack := &whip.VideoTrack{Rid: "q"}
+	videoTrack.LastKeyFrame.Store(time.Now())
+	host.TracksLock.Lock()
+	host.VideoTracks[videoTrack.Rid] = videoTrack
+	host.TracksLock.Unlock()
+
+	// The previous publisher is released once the new publisher is the host with the viewers attached
+	select {
+	case id := <-index.released:
+		require.Equal(t, previous.ID, id)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "previous publisher was not released")
+	}
+	assert.Equal(t, host, s.Host.Load())
+	assert.Contains(t, hostSnapshot(s), viewer.SessionID)
+	assert.Nil(t, s.GetPublisher(previous.ID))
+
+	// The replaced publisher closing does not affect the session
+	s.handlePublisherClosed(previous, false)
+	assert.Equal(t, host, s.Host.Load())
+	assert.Equal(t, StreamStateLive, s.GetState())
+}
+
+func TestSessionPublisherPolicyStandby(t *testing.T) {
+	s := &Session{StreamKey: "main", WHEPSessions: map[string]*whep.WHEPSession{}, PublisherPolicy: authorization.PublisherPolicyStandby}
+
+	require.NoError(t, s.AddHost(newTestPublisher(t), nil))
+	primary := s.Host.Load()
+
+	viewer := whep.CreateNewWHEP("viewer", s.StreamKey, nil, nil, nil, func(string) {})
+	s.WHEPSessions[viewer.SessionID] = viewer
+	s.updateHostWHEPSessionsSnapshot()
+
+	// Second publisher waits without receiving viewers
+	require.NoError(t, s.AddHost(newTestPublisher(t), nil))
+	standby := s.standby.Load()
+	require.NotNil(t, standby)
+	assert.True(t, s.HasStandbyPublisher())
+	assert.Equal(t, primary, s.Host.Load())
+	assert.Equal(t, standby, s.GetPublisher(standby.ID))
+	standbySnapshot, _ := standby.WHEPSessionsSnapshot.Load().(map[string]*whep.WHEPSession)
+	assert.Empty(t, standbySnapshot)
+
+	// Only one standby is kept
+	assert.Error(t, s.AddHost(newTestPublisher(t), nil))
+
+	// Primary drops, the standby takes over and receives the viewers
+	s.handlePublisherClosed(primary, false)
+	assert.Equal(t, standby, s.Host.Load())
+	assert.False(t, s.HasStandbyPublisher())
+	assert.Contains(t, hostSnapshot(s), viewer.SessionID)
+	assert.Equal(t, StreamStateLive, s.GetState())
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Hold the session open for a returning publisher, viewers stay attached while reconnecting.
+// Returns false if no grace period is configured.
+func (s *Session) startReconnectGracePeriod() bool {
+	if s.IsVirtual.Load() || s.ReconnectGracePeriod <= 0 {
+		return false
+	}
+
+	s.reconnectLock.Lock()
+	defer s.reconnectLock.Unlock()
+
+	if s.reconnectTimer != nil {
+		s.reconnectTimer.Stop()
+	}
+
+	slog.Info("Session.StartReconnectGracePeriod", "streamKey", s.StreamKey, "gracePeriod", s.ReconnectGracePeriod)
+	s.setState(StreamStateReconnecting)
+
+	s.reconnectGeneration++
+	generation := s.reconnectGeneration
+	s.reconnectTimer = time.AfterFunc(s.ReconnectGracePeriod, func() {
+		s.handleReconnectTimeout(generation)
+	})
+
+	return true
+}
+
+// Stop waiting for the publisher, returns true if the session was reconnecting
+func (s *Session) stopReconnectGracePeriod() bool {
+	s.reconnectLock.Lock()
+	defer s.reconnectLock.Unlock()
+
+	if s.reconnectTimer == nil {
+		return false
+	}
+
+	s.reconnectTimer.Stop()
+	s.reconnectTimer = nil
+	return true
+}
+
+// Returns true while the session waits for its publisher to return
+func (s *Session) isReconnecting() bool {
+	s.reconnectLock.Lock()
+	defer s.reconnectLock.Unlock()
+
+	return s.reconnectTimer != nil
+}
+
+func (s *Session) handleReconnectTimeout(generation uint64) {
+	s.reconnectLock.Lock()
+	if s.reconnectTimer == nil || s.reconnectGeneration != generation {
+		s.reconnectLock.Unlock()
+		return
+	}
+	s.reconnectTimer = nil
+	s.reconnectLock.Unlock()
+
+	if s.Host.Load() != nil {
+		return
+	}
+
+	slog.Info("Session.ReconnectGracePeriod: Publisher did not return", "streamKey", s.StreamKey)
+	s.setState(StreamStateOffline)
+
+	if s.isEmpty() {
+		s.close()
+		return
+	}
+
+	s.startFallback()
+}
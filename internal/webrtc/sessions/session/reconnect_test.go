@@ -0,0 +1,71 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionReconnectWithinGracePeriod(t *testing.T) {
+	s := newTestSessionWithHost("main")
+	s.ReconnectGracePeriod = time.Minute
+	s.StreamStart = time.Now().Add(-time.Hour)
+	streamStart := s.StreamStart
+
+	closed := false
+	s.SetOnClose(func() { closed = true })
+	s.setState(StreamStateLive)
+
+	// Publisher drops, the session is held open without viewers
+	s.handleHostClosed(false)
+	assert.Equal(t, StreamStateReconnecting, s.GetState())
+	assert.False(t, closed)
+	assert.False(t, s.isEmpty())
+
+	// Publisher returns with the same stream key and resumes the session
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer func() { _ = peerConnection.Close() }()
+
+	require.NoError(t, s.AddHost(peerConnection, nil))
+	assert.Equal(t, StreamStateLive, s.GetState())
+	assert.False(t, s.isReconnecting())
+	assert.Equal(t, streamStart, s.StreamStart)
+}
+
+func TestSessionClosesAfterGracePeriod(t *testing.T) {
+	s := newTestSessionWithHost("main")
+	s.ReconnectGracePeriod = 10 * time.Millisecond
+
+	closed := make(chan struct{})
+	s.SetOnClose(func() { close(closed) })
+	s.setState(StreamStateLive)
+
+	s.handleHostClosed(false)
+	assert.Equal(t, StreamStateReconnecting, s.GetState())
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected session to close after the grace period")
+	}
+	assert.Equal(t, StreamStateOffline, s.GetState())
+}
+
+func TestSessionRemovedPublisherSkipsGracePeriod(t *testing.T) {
+	s := newTestSessionWithHost("main")
+	s.ReconnectGracePeriod = time.Minute
+
+	closed := false
+	s.SetOnClose(func() { closed = true })
+	s.setState(StreamStateLive)
+
+	// The publisher ends the stream with a WHIP DELETE
+	s.RemovePublisher(s.Host.Load().ID)
+	assert.Equal(t, StreamStateOffline, s.GetState())
+	assert.False(t, s.isReconnecting())
+	assert.True(t, closed)
+}
@@ -1,13 +1,13 @@
 package session
 
 import (
-	"fmt"
 	"log/slog"
 
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v4"
 )
@@ -17,6 +17,9 @@ func (s *Session) UpdateStreamStatus(profile authorization.PublicProfile) {
 
 	s.MOTD = profile.MOTD
 	s.IsPublic = profile.IsPublic
+	s.FallbackStreamKey = profile.FallbackStreamKey
+	s.FallbackMediaPath = profile.FallbackMediaPath
+	s.PublisherPolicy = profile.PublisherPolicy
 
 	s.StatusLock.Unlock()
 }
@@ -26,7 +29,7 @@ func (session *Session) SetOnClose(onClose func()) {
 }
 
 // Add WHEP viewer session
-func (s *Session) AddWHEP(whepSessionID string, peerConnection *webrtc.PeerConnection, audioTrack *codecs.TrackMultiCodec, videoTrack *codecs.TrackMultiCodec, videoRTCPSender *webrtc.RTPSender, pliSender func()) (err error) {
+func (s *Session) AddWHEP(whepSessionID string, peerConnection *webrtc.PeerConnection, candidates *utils.CandidateCollector, audioTrack *codecs.TrackMultiCodec, videoTrack *codecs.TrackMultiCodec, videoRTCPSender *webrtc.RTPSender, stageTracks []*whep.StageTrack, pliSender func(layer string)) (err error) {
 	slog.Debug("WHIPSessionManager.WHIPSession.AddWHEPSession")
 
 	whepSession := whep.CreateNewWHEP(
@@ -38,56 +41,113 @@ func (s *Session) AddWHEP(whepSessionID string, peerConnection *webrtc.PeerConne
 		pliSender,
 	)
 
+	whepSession.Candidates = candidates
+	whepSession.SetStageTracks(stageTracks, s.requestStageKeyframe)
 	whepSession.SetOnClose(s.handleWHEPClose)
 
 	s.WHEPSessionsLock.Lock()
 	s.WHEPSessions[whepSessionID] = whepSession
+	s.indexWHEPSession(whepSessionID)
 	s.WHEPSessionsLock.Unlock()
 	s.updateHostWHEPSessionsSnapshot()
 	whepSession.RegisterWHEPHandlers(peerConnection)
 	s.registerDataChannelHandlers(peerConnection, whepSessionID)
-	go s.handleWHEPVideoRTCPSender(whepSession, videoRTCPSender)
+	if videoRTCPSender != nil {
+		go s.handleWHEPVideoRTCPSender(whepSession, videoRTCPSender)
+	}
+	for index, stageTrack := range stageTracks {
+		if stageTrack.VideoRTCPSender != nil {
+			go s.handleWHEPStageRTCPSender(index+1, stageTrack.VideoRTCPSender)
+		}
+	}
 
 	return nil
 }
 
-// Add host
-func (s *Session) AddHost(peerConnection *webrtc.PeerConnection) (err error) {
-	slog.Debug("Session.AddHost")
+// Add a viewer without a PeerConnection, such as a WebSocket or WebTransport viewer. Its tracks write to a sink.
+func (s *Session) AddSinkViewer(whepSessionID string, transport string, audioTrack *codecs.TrackMultiCodec, videoTrack *codecs.TrackMultiCodec, pliSender func(layer string)) *whep.WHEPSession {
+	slog.Debug("Session.AddSinkViewer", "transport", transport)
 
-	for {
-		host := s.Host.Load()
-		if host == nil {
-			break
-		}
+	whepSession := whep.CreateNewWHEP(
+		whepSessionID,
+		s.StreamKey,
+		audioTrack,
+		videoTrack,
+		nil,
+		pliSender,
+	)
 
-		if host.PeerConnection.ConnectionState() != webrtc.PeerConnectionStateClosed {
-			return fmt.Errorf("session already has a host")
-		}
+	whepSession.Transport = transport
+	whepSession.SetOnClose(s.handleWHEPClose)
 
-		if s.Host.CompareAndSwap(host, nil) {
-			break
-		}
-	}
+	s.WHEPSessionsLock.Lock()
+	s.WHEPSessions[whepSessionID] = whepSession
+	s.indexWHEPSession(whepSessionID)
+	s.WHEPSessionsLock.Unlock()
+	s.updateHostWHEPSessionsSnapshot()
+
+	return whepSession
+}
+
+// Add host, a second publisher is rejected, takes over or waits as standby depending on the publisher policy
+func (s *Session) AddHost(peerConnection *webrtc.PeerConnection, candidates *utils.CandidateCollector) (err error) {
+	slog.Debug("Session.AddHost")
+
+	s.StatusLock.RLock()
+	publisherPolicy := s.PublisherPolicy
+	s.StatusLock.RUnlock()
 
 	host := &whip.WHIPSession{
 		ID:          uuid.New().String(),
 		AudioTracks: make(map[string]*whip.AudioTrack),
 		VideoTracks: make(map[string]*whip.VideoTrack),
+		Candidates:  candidates,
 	}
-	host.SetOnClosed(s.handleHostClosed)
+	host.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
+	host.SetOnClosed(func() {
+		s.handlePublisherClosed(host, false)
+	})
+	host.StartLayerDemandWatch(s.LayerIdleTimeout)
 
 	host.AddPeerConnection(peerConnection, s.StreamKey)
 	s.registerDataChannelHandlers(peerConnection, host.ID)
-	if !s.Host.CompareAndSwap(nil, host) {
-		host.RemovePeerConnection()
-		host.RemoveTracks()
-		return fmt.Errorf("session already has a host")
+	s.indexPublisher(host)
+
+	replaced, isStandby, err := s.setPublisher(host, publisherPolicy)
+	if err != nil {
+		s.releasePublisher(host)
+		return err
+	}
+
+	if isStandby && publisherPolicy == authorization.PublisherPolicyTakeover {
+		// A publisher that was still waiting to take over is replaced by the newer one
+		if replaced != nil {
+			s.releasePublisher(replaced)
+		}
+
+		slog.Info("Session.AddHost: Publisher taking over on its first keyframe", "streamKey", s.StreamKey, "id", host.ID)
+		go s.watchTakeoverPublisher(host)
+		return nil
+	} else if isStandby {
+		slog.Info("Session.AddHost: Standby publisher connected", "streamKey", s.StreamKey, "id", host.ID)
+		go s.watchPrimaryPublisher(host)
+		return nil
+	}
+
+	if replaced != nil {
+		slog.Info("Session.AddHost: Closed publisher replaced", "streamKey", s.StreamKey, "previous", replaced.ID, "id", host.ID)
+		replaced.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
+		s.releasePublisher(replaced)
 	}
+
+	if s.stopReconnectGracePeriod() {
+		slog.Info("Session.AddHost: Publisher reconnected", "streamKey", s.StreamKey)
+	}
+	s.stopFallback()
 	s.resetWHEPSessionsForNewHost()
-	host.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
 	s.updateHostWHEPSessionsSnapshot()
 	s.HasHost.Store(true)
+	s.setState(StreamStateLive)
 
 	return nil
 }
@@ -104,8 +164,7 @@ func (s *Session) RemoveHost() {
 	s.HasHost.Store(false)
 
 	host.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
-	host.RemovePeerConnection()
-	host.RemoveTracks()
+	s.releasePublisher(host)
 }
 
 func (s *Session) handleWHEPClose(whepSessionID string) {
@@ -115,6 +174,7 @@ func (s *Session) handleWHEPClose(whepSessionID string) {
 	_, ok := s.WHEPSessions[whepSessionID]
 	if ok {
 		delete(s.WHEPSessions, whepSessionID)
+		s.unindexWHEPSession(whepSessionID)
 	}
 	s.WHEPSessionsLock.Unlock()
 
@@ -129,21 +189,34 @@ func (s *Session) handleWHEPClose(whepSessionID string) {
 	}
 }
 
-func (s *Session) handleHostClosed() {
+// Only a host that disconnected is waited for, a host removed by its owner ends the stream right away
+func (s *Session) handleHostClosed(isRemoved bool) {
 	s.RemoveHost()
 
+	if !isRemoved && s.startReconnectGracePeriod() {
+		return
+	}
+
+	s.setState(StreamStateOffline)
+
 	if s.isEmpty() {
 		s.close()
+		return
 	}
+
+	s.startFallback()
 }
 
 // Remove all Hosts and clients before closing down session
 func (s *Session) close() {
 	s.closeOnce.Do(func() {
+		s.stopReconnectGracePeriod()
+
 		s.WHEPSessionsLock.Lock()
 		whepSessions := make([]*whep.WHEPSession, 0, len(s.WHEPSessions))
-		for _, whepSession := range s.WHEPSessions {
+		for whepSessionID, whepSession := range s.WHEPSessions {
 			whepSessions = append(whepSessions, whepSession)
+			s.unindexWHEPSession(whepSessionID)
 		}
 		s.WHEPSessions = make(map[string]*whep.WHEPSession)
 		s.WHEPSessionsLock.Unlock()
@@ -153,7 +226,15 @@ func (s *Session) close() {
 		}
 		s.updateHostWHEPSessionsSnapshot()
 
+		if standby := s.standby.Load(); standby != nil {
+			s.removeStandby(standby)
+		}
+		s.removeAllStageGuests()
 		s.RemoveHost()
+		s.detachRelays()
+		if err := s.SetSource(nil); err != nil {
+			slog.Error("Session.Close.SetSource", "streamKey", s.StreamKey, "err", err)
+		}
 
 		if s.onClose != nil {
 			s.onClose()
@@ -168,6 +249,11 @@ func (s *Session) Close() {
 
 // Returns true is no WHIP tracks are present, and no WHEP sessions are waiting for incoming streams
 func (s *Session) isEmpty() bool {
+	if s.isReconnecting() {
+		slog.Debug("Session.IsEmpty.IsReconnecting (false)", "streamKey", s.StreamKey)
+		return false
+	}
+
 	if s.hasWHEPSessions() {
 		slog.Debug("Session.IsEmpty.HasWHEPSessions (false)", "streamKey", s.StreamKey)
 		return false
@@ -221,11 +307,28 @@ func (s *Session) hasWHEPSessions() bool {
 }
 
 func (s *Session) updateHostWHEPSessionsSnapshot() {
+	// Viewers of a relaying session are part of the snapshot of the source host
+	if source := s.source.Load(); source != nil {
+		source.updateHostWHEPSessionsSnapshot()
+	}
+
 	host := s.Host.Load()
-	if host == nil {
+	guests := s.getStageGuestHosts()
+	if host == nil && len(guests) == 0 {
 		return
 	}
 
+	snapshot := s.getWHEPSessionsSnapshot()
+	if host != nil {
+		host.WHEPSessionsSnapshot.Store(snapshot)
+	}
+	for _, guest := range guests {
+		guest.WHEPSessionsSnapshot.Store(snapshot)
+	}
+}
+
+// Get the open WHEP sessions of this session and its relays
+func (s *Session) getWHEPSessionsSnapshot() map[string]*whep.WHEPSession {
 	s.WHEPSessionsLock.RLock()
 	snapshot := make(map[string]*whep.WHEPSession, len(s.WHEPSessions))
 	for _, whepSession := range s.WHEPSessions {
@@ -235,7 +338,8 @@ func (s *Session) updateHostWHEPSessionsSnapshot() {
 	}
 	s.WHEPSessionsLock.RUnlock()
 
-	host.WHEPSessionsSnapshot.Store(snapshot)
+	s.appendRelayWHEPSessions(snapshot)
+	return snapshot
 }
 
 func (s *Session) resetWHEPSessionsForNewHost() {
@@ -248,22 +352,42 @@ func (s *Session) resetWHEPSessionsForNewHost() {
 		whepSession.ResetForNewPublisher()
 	}
 	s.WHEPSessionsLock.RUnlock()
+
+	s.relaysLock.RLock()
+	for _, relay := range s.relays {
+		if relay.Host.Load() == nil {
+			relay.resetWHEPSessionsForNewHost()
+		}
+	}
+	s.relaysLock.RUnlock()
 }
 
 // Get the status of the current session
 func (s *Session) GetStreamStatus() (status whipSessionStatus) {
 	s.WHEPSessionsLock.RLock()
 	whepSessionsCount := len(s.WHEPSessions)
+	webSocketViewerCount, webTransportViewerCount := 0, 0
+	for _, whepSession := range s.WHEPSessions {
+		switch whepSession.Transport {
+		case whep.TransportWebSocket:
+			webSocketViewerCount++
+		case whep.TransportWebTransport:
+			webTransportViewerCount++
+		}
+	}
 	s.WHEPSessionsLock.RUnlock()
 
 	s.StatusLock.RLock()
 
 	status = whipSessionStatus{
-		StreamKey:   s.StreamKey,
-		MOTD:        s.MOTD,
-		ViewerCount: whepSessionsCount,
-		IsOnline:    s.HasHost.Load(),
-		StreamStart: s.StreamStart,
+		StreamKey:               s.StreamKey,
+		MOTD:                    s.MOTD,
+		ViewerCount:             whepSessionsCount,
+		WebSocketViewerCount:    webSocketViewerCount,
+		WebTransportViewerCount: webTransportViewerCount,
+		IsOnline:                s.ActiveHost() != nil,
+		State:                   s.GetState(),
+		StreamStart:             s.StreamStart,
 	}
 
 	s.StatusLock.RUnlock()
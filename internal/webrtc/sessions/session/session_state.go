@@ -11,7 +11,13 @@ type whipSessionStatus struct {
 	MOTD        string    `json:"motd"`
 	ViewerCount int       `json:"viewers"`
 	IsOnline    bool      `json:"isOnline"`
+	State       string    `json:"state"`
 	StreamStart time.Time `json:"streamStart"`
+
+	// Viewers included in ViewerCount that receive fragmented MP4 over a WebSocket
+	// or MoQ tracks over WebTransport
+	WebSocketViewerCount    int `json:"webSocketViewers"`
+	WebTransportViewerCount int `json:"webTransportViewers"`
 }
 
 // Information for a whip session
@@ -21,6 +27,16 @@ type StreamSessionState struct {
 	MOTD        string    `json:"motd"`
 	StreamStart time.Time `json:"streamStart"`
 
+	KeyframeRequests           uint64 `json:"keyframeRequests"`
+	KeyframeRequestsSuppressed uint64 `json:"keyframeRequestsSuppressed"`
+
+	HasStandbyPublisher bool         `json:"hasStandbyPublisher"`
+	StageGuests         []StageGuest `json:"stageGuests"`
+
+	// Video bitrate sent to viewers that are not paused
+	EgressBitrate uint64 `json:"egressBitrate"`
+	PausedViewers int    `json:"pausedViewers"`
+
 	AudioTracks []AudioTrackState `json:"audioTracks"`
 	VideoTracks []VideoTrackState `json:"videoTracks"`
 
@@ -39,4 +55,5 @@ type VideoTrackState struct {
 	PacketsReceived uint64    `json:"packetsReceived"`
 	PacketsDropped  uint64    `json:"packetsDropped"`
 	LastKeyframe    time.Time `json:"lastKeyframe"`
+	PLIsSent        uint64    `json:"plisSent"`
 }
@@ -0,0 +1,308 @@
+package session
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
+	"github.com/google/uuid"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// Guests that can publish next to the host
+	MaxStageGuests = 3
+
+	stageInviteTTL = 10 * time.Minute
+)
+
+var (
+	ErrStageFull          = errors.New("stage is full")
+	ErrStageOffline       = errors.New("stream is offline")
+	ErrStageInviteInvalid = errors.New("stage invite is invalid or expired")
+	ErrStageGuestNotFound = errors.New("stage guest not found")
+)
+
+type StageInvite struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type StageGuest struct {
+	ID   string `json:"id"`
+	Slot int    `json:"slot"`
+}
+
+type stageEvent struct {
+	Guests []StageGuest `json:"guests"`
+}
+
+type stageGuest struct {
+	host                *whip.WHIPSession
+	lastKeyframeRequest time.Time
+}
+
+// Guests publishing next to the host, viewers receive them as additional tracks
+type stage struct {
+	// Protects invites, guests, changed
+	lock    sync.Mutex
+	invites map[string]time.Time
+	guests  map[int]*stageGuest
+	changed chan struct{}
+}
+
+// Create a single use token a guest publishes to the stage with
+func (s *Session) CreateStageInvite() (invite StageInvite, err error) {
+	if s.Host.Load() == nil {
+		return invite, ErrStageOffline
+	}
+
+	s.stage.lock.Lock()
+	defer s.stage.lock.Unlock()
+
+	now := time.Now()
+	for token, expiresAt := range s.stage.invites {
+		if now.After(expiresAt) {
+			delete(s.stage.invites, token)
+			s.unindexStageInvite(token)
+		}
+	}
+
+	if len(s.stage.guests)+len(s.stage.invites) >= MaxStageGuests {
+		return invite, ErrStageFull
+	}
+
+	if s.stage.invites == nil {
+		s.stage.invites = make(map[string]time.Time)
+	}
+
+	invite = StageInvite{
+		Token:     uuid.New().String(),
+		ExpiresAt: now.Add(stageInviteTTL),
+	}
+	s.stage.invites[invite.Token] = invite.ExpiresAt
+	s.indexStageInvite(invite.Token)
+
+	slog.Info("Session.CreateStageInvite", "streamKey", s.StreamKey, "expiresAt", invite.ExpiresAt)
+	return invite, nil
+}
+
+// Returns true if the token is an open stage invite of the session
+func (s *Session) HasStageInvite(token string) bool {
+	s.stage.lock.Lock()
+	defer s.stage.lock.Unlock()
+
+	expiresAt, ok := s.stage.invites[token]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// Add a guest publishing with the provided invite token
+func (s *Session) AddStageGuest(token string, peerConnection *webrtc.PeerConnection, candidates *utils.CandidateCollector) (*whip.WHIPSession, error) {
+	s.stage.lock.Lock()
+	expiresAt, ok := s.stage.invites[token]
+	if !ok || time.Now().After(expiresAt) {
+		delete(s.stage.invites, token)
+		s.unindexStageInvite(token)
+		s.stage.lock.Unlock()
+		return nil, ErrStageInviteInvalid
+	}
+
+	// The invite is kept while the stage is full, so the guest can try again once a slot is free
+	slot := 1
+	for ; slot <= MaxStageGuests; slot++ {
+		if _, used := s.stage.guests[slot]; !used {
+			break
+		}
+	}
+	if slot > MaxStageGuests {
+		s.stage.lock.Unlock()
+		return nil, ErrStageFull
+	}
+	delete(s.stage.invites, token)
+	s.unindexStageInvite(token)
+
+	guest := &whip.WHIPSession{
+		ID:          uuid.New().String(),
+		StageSlot:   slot,
+		AudioTracks: make(map[string]*whip.AudioTrack),
+		VideoTracks: make(map[string]*whip.VideoTrack),
+		Candidates:  candidates,
+	}
+	guest.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
+	guest.SetOnClosed(func() {
+		s.removeStageGuest(guest)
+	})
+
+	if s.stage.guests == nil {
+		s.stage.guests = make(map[int]*stageGuest)
+	}
+	s.indexPublisher(guest)
+	s.stage.guests[slot] = &stageGuest{host: guest}
+	s.signalStageChangedLocked()
+	s.stage.lock.Unlock()
+
+	slog.Info("Session.AddStageGuest", "streamKey", s.StreamKey, "id", guest.ID, "slot", slot)
+	guest.AddPeerConnection(peerConnection, s.StreamKey)
+	s.registerDataChannelHandlers(peerConnection, guest.ID)
+
+	s.WHEPSessionsLock.RLock()
+	for _, whepSession := range s.WHEPSessions {
+		whepSession.ResetStageSlot(slot)
+	}
+	s.WHEPSessionsLock.RUnlock()
+	s.updateHostWHEPSessionsSnapshot()
+
+	return guest, nil
+}
+
+// Remove the stage guest with the provided id
+func (s *Session) RemoveStageGuest(id string) error {
+	guest := s.getStageGuest(id)
+	if guest == nil {
+		return ErrStageGuestNotFound
+	}
+
+	s.removeStageGuest(guest)
+	return nil
+}
+
+// Get the guests currently on stage ordered by slot
+func (s *Session) GetStageGuests() []StageGuest {
+	s.stage.lock.Lock()
+	defer s.stage.lock.Unlock()
+
+	guests := make([]StageGuest, 0, len(s.stage.guests))
+	for slot, guest := range s.stage.guests {
+		guests = append(guests, StageGuest{ID: guest.host.ID, Slot: slot})
+	}
+	slices.SortFunc(guests, func(a, b StageGuest) int { return a.Slot - b.Slot })
+
+	return guests
+}
+
+// Returns a channel that is closed on the next change of the stage guests
+func (s *Session) StageChanged() <-chan struct{} {
+	s.stage.lock.Lock()
+	defer s.stage.lock.Unlock()
+
+	if s.stage.changed == nil {
+		s.stage.changed = make(chan struct{})
+	}
+
+	return s.stage.changed
+}
+
+// Get SSE String with the guests currently on stage
+func (s *Session) GetStageEvent() string {
+	guests, err := utils.ToJSONString(stageEvent{Guests: s.GetStageGuests()})
+	if err != nil {
+		slog.Error("GetStageEvent Error", "err", err)
+		return ""
+	}
+
+	return "event: stage\ndata: " + guests + "\n\n"
+}
+
+func (s *Session) getStageGuest(id string) *whip.WHIPSession {
+	s.stage.lock.Lock()
+	defer s.stage.lock.Unlock()
+
+	for _, guest := range s.stage.guests {
+		if guest.host.ID == id {
+			return guest.host
+		}
+	}
+
+	return nil
+}
+
+func (s *Session) getStageGuestHosts() []*whip.WHIPSession {
+	s.stage.lock.Lock()
+	defer s.stage.lock.Unlock()
+
+	hosts := make([]*whip.WHIPSession, 0, len(s.stage.guests))
+	for _, guest := range s.stage.guests {
+		hosts = append(hosts, guest.host)
+	}
+
+	return hosts
+}
+
+func (s *Session) removeStageGuest(guest *whip.WHIPSession) bool {
+	s.stage.lock.Lock()
+	current, ok := s.stage.guests[guest.StageSlot]
+	if !ok || current.host != guest {
+		s.stage.lock.Unlock()
+		return false
+	}
+	delete(s.stage.guests, guest.StageSlot)
+	s.signalStageChangedLocked()
+	s.stage.lock.Unlock()
+
+	slog.Info("Session.RemoveStageGuest", "streamKey", s.StreamKey, "id", guest.ID, "slot", guest.StageSlot)
+	guest.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
+	s.releasePublisher(guest)
+	return true
+}
+
+func (s *Session) removeAllStageGuests() {
+	for _, guest := range s.getStageGuestHosts() {
+		s.removeStageGuest(guest)
+	}
+
+	s.stage.lock.Lock()
+	for token := range s.stage.invites {
+		s.unindexStageInvite(token)
+	}
+	s.stage.invites = nil
+	s.stage.lock.Unlock()
+}
+
+// Request a keyframe from the guest in the slot, throttled like the host's keyframe requests
+func (s *Session) requestStageKeyframe(slot int) {
+	s.stage.lock.Lock()
+	guest, ok := s.stage.guests[slot]
+	if !ok {
+		s.stage.lock.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(guest.lastKeyframeRequest) < keyframeRequestInterval {
+		s.stage.lock.Unlock()
+		return
+	}
+	guest.lastKeyframeRequest = now
+	s.stage.lock.Unlock()
+
+	guest.host.SendPLI()
+}
+
+func (s *Session) signalStageChangedLocked() {
+	if s.stage.changed != nil {
+		close(s.stage.changed)
+	}
+	s.stage.changed = make(chan struct{})
+}
+
+// Forward keyframe requests of a viewer for a stage guest
+func (s *Session) handleWHEPStageRTCPSender(slot int, rtcpSender *webrtc.RTPSender) {
+	for {
+		rtcpPackets, _, rtcpErr := rtcpSender.ReadRTCP()
+		if rtcpErr != nil {
+			return
+		}
+
+		for _, packet := range rtcpPackets {
+			if _, isPLI := packet.(*rtcp.PictureLossIndication); isPLI {
+				s.requestStageKeyframe(slot)
+			}
+		}
+	}
+}
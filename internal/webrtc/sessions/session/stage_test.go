@@ -0,0 +1,107 @@
+package session
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStageInviteRequiresHost(t *testing.T) {
+	s := &Session{StreamKey: "main", WHEPSessions: map[string]*whep.WHEPSession{}}
+
+	_, err := s.CreateStageInvite()
+	assert.ErrorIs(t, err, ErrStageOffline)
+}
+
+func TestSessionStageGuest(t *testing.T) {
+	s := newTestSessionWithHost("main")
+
+	viewer := whep.CreateNewWHEP("viewer", s.StreamKey, nil, nil, nil, func(string) {})
+	s.WHEPSessions[viewer.SessionID] = viewer
+	s.updateHostWHEPSessionsSnapshot()
+
+	invite, err := s.CreateStageInvite()
+	require.NoError(t, err)
+	assert.True(t, s.HasStageInvite(invite.Token))
+
+	stageChanged := s.StageChanged()
+	guest, err := s.AddStageGuest(invite.Token, newTestPublisher(t), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, guest.StageSlot)
+	assert.Equal(t, []StageGuest{{ID: guest.ID, Slot: 1}}, s.GetStageGuests())
+	assert.Equal(t, guest, s.GetPublisher(guest.ID))
+	assert.Contains(t, guest.WHEPSessionsSnapshot.Load(), viewer.SessionID)
+	select {
+	case <-stageChanged:
+	default:
+		t.Fatal("expected stage change to be signalled")
+	}
+
+	// Invites are single use
+	assert.False(t, s.HasStageInvite(invite.Token))
+	_, err = s.AddStageGuest(invite.Token, newTestPublisher(t), nil)
+	assert.ErrorIs(t, err, ErrStageInviteInvalid)
+
+	// The host removes the guest, the host keeps publishing
+	require.NoError(t, s.RemoveStageGuest(guest.ID))
+	assert.Empty(t, s.GetStageGuests())
+	assert.Nil(t, s.GetPublisher(guest.ID))
+	assert.NotNil(t, s.Host.Load())
+	assert.ErrorIs(t, s.RemoveStageGuest(guest.ID), ErrStageGuestNotFound)
+}
+
+func TestSessionStageFull(t *testing.T) {
+	s := newTestSessionWithHost("main")
+
+	for range MaxStageGuests {
+		_, err := s.CreateStageInvite()
+		require.NoError(t, err)
+	}
+
+	_, err := s.CreateStageInvite()
+	assert.ErrorIs(t, err, ErrStageFull)
+}
+
+func TestSessionStageInviteKeptWhileStageFull(t *testing.T) {
+	s := newTestSessionWithHost("main")
+
+	invite, err := s.CreateStageInvite()
+	require.NoError(t, err)
+
+	s.stage.guests = map[int]*stageGuest{}
+	for slot := 1; slot <= MaxStageGuests; slot++ {
+		s.stage.guests[slot] = &stageGuest{host: &whip.WHIPSession{ID: fmt.Sprint("guest", slot)}}
+	}
+
+	_, err = s.AddStageGuest(invite.Token, newTestPublisher(t), nil)
+	assert.ErrorIs(t, err, ErrStageFull)
+	assert.True(t, s.HasStageInvite(invite.Token))
+
+	// A slot is freed, the invite is used and can not be used again
+	delete(s.stage.guests, 2)
+	guest, err := s.AddStageGuest(invite.Token, newTestPublisher(t), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, guest.StageSlot)
+
+	delete(s.stage.guests, 3)
+	_, err = s.AddStageGuest(invite.Token, newTestPublisher(t), nil)
+	assert.ErrorIs(t, err, ErrStageInviteInvalid)
+}
+
+func TestSessionStageInviteExpires(t *testing.T) {
+	s := newTestSessionWithHost("main")
+
+	invite, err := s.CreateStageInvite()
+	require.NoError(t, err)
+	s.stage.invites[invite.Token] = time.Now().Add(-time.Second)
+
+	assert.False(t, s.HasStageInvite(invite.Token))
+	_, err = s.AddStageGuest(invite.Token, newTestPublisher(t), nil)
+	assert.ErrorIs(t, err, ErrStageInviteInvalid)
+	assert.NotContains(t, s.stage.invites, invite.Token)
+}
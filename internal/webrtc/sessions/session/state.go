@@ -0,0 +1,79 @@
+package session
+
+import (
+	"log/slog"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
+)
+
+const (
+	StreamStateLive         = "live"
+	StreamStateOffline      = "offline"
+	StreamStateReconnecting = "reconnecting"
+)
+
+type streamStateEvent struct {
+	State string `json:"state"`
+}
+
+// Returns the current publishing state of the session
+func (s *Session) GetState() string {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	if s.state == "" {
+		return StreamStateOffline
+	}
+
+	return s.state
+}
+
+// Returns a channel that is closed on the next state change
+func (s *Session) StateChanged() <-chan struct{} {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	if s.stateChanged == nil {
+		s.stateChanged = make(chan struct{})
+	}
+
+	return s.stateChanged
+}
+
+// Set the function called after every state change
+func (s *Session) SetOnStateChanged(onStateChanged func(state string)) {
+	s.onStateChanged = onStateChanged
+}
+
+func (s *Session) setState(state string) {
+	s.stateLock.Lock()
+
+	if s.state == state {
+		s.stateLock.Unlock()
+		return
+	}
+
+	slog.Info("Session.SetState", "streamKey", s.StreamKey, "from", s.state, "to", state)
+	s.state = state
+
+	if s.stateChanged != nil {
+		close(s.stateChanged)
+	}
+	s.stateChanged = make(chan struct{})
+	s.stateLock.Unlock()
+
+	if s.onStateChanged != nil {
+		s.onStateChanged(state)
+	}
+}
+
+// Get SSE String with the current publishing state of the session
+func (s *Session) GetStreamStateEvent() string {
+	state, err := utils.ToJSONString(streamStateEvent{State: s.GetState()})
+	if err != nil {
+		slog.Error("GetStreamStateEvent Error", "err", err)
+		return ""
+	}
+
+	return "event: state\ndata: " + state + "\n\n"
+}
@@ -21,10 +21,49 @@ type Session struct {
 	IsPublic    bool
 	StreamStart time.Time
 
-	Host atomic.Pointer[whip.WHIPSession]
+	Host      atomic.Pointer[whip.WHIPSession]
+	keyframes keyframeCoordinator
+
+	// Virtual sessions have no host of their own, viewers are fed by the host of the source session
+	IsVirtual atomic.Bool
+	source    atomic.Pointer[Session]
+
+	// Protects relays
+	relaysLock sync.RWMutex
+	relays     map[string]*Session
+
+	// Resolves the source feeding viewers while the host is absent, protected by StatusLock
+	FallbackStreamKey string
+	FallbackMediaPath string
+	fallbackResolver  func(fallbackStreamKey string, fallbackMediaPath string) *Session
+
+	// Time the session is held open for a returning publisher
+	ReconnectGracePeriod time.Duration
+	reconnectLock        sync.Mutex
+	reconnectTimer       *time.Timer
+	reconnectGeneration  uint64
+
+	// Time a simulcast layer may go without viewers before the publisher is asked to pause it
+	LayerIdleTimeout time.Duration
+
+	// Handling of a second publisher, protected by StatusLock
+	PublisherPolicy string
+
+	// Protects swapping Host and standby, a standby publisher only feeds viewers once promoted
+	publishersLock sync.Mutex
+	standby        atomic.Pointer[whip.WHIPSession]
+
+	stage stage
+
+	// Protects state, stateChanged
+	stateLock      sync.Mutex
+	state          string
+	stateChanged   chan struct{}
+	onStateChanged func(state string)
 
 	closeOnce sync.Once
 	onClose   func()
+	index     Index
 
 	// Protects WHEPSessions
 	WHEPSessionsLock sync.RWMutex
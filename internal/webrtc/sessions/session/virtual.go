@@ -0,0 +1,132 @@
+package session
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+)
+
+var (
+	errSourceIsSelf    = errors.New("session cannot use itself as source")
+	errSourceIsVirtual = errors.New("virtual session cannot be used as source")
+)
+
+// Set the session that feeds the viewers of this session.
+// Viewers stay connected, wait for a keyframe from the new source and continue with
+// rewritten sequence numbers and timestamps. Passing nil detaches the current source.
+func (s *Session) SetSource(source *Session) error {
+	if source == s {
+		return errSourceIsSelf
+	}
+
+	if source != nil && source.IsVirtual.Load() {
+		return errSourceIsVirtual
+	}
+
+	previous := s.source.Swap(source)
+	if previous == source {
+		return nil
+	}
+
+	slog.Info("Session.SetSource", "streamKey", s.StreamKey, "from", sourceStreamKey(previous), "to", sourceStreamKey(source))
+
+	if previous != nil {
+		previous.removeRelay(s)
+		previous.updateHostWHEPSessionsSnapshot()
+	}
+
+	s.resetWHEPSessionsForNewHost()
+
+	if source != nil {
+		source.addRelay(s)
+		source.updateHostWHEPSessionsSnapshot()
+
+		source.RequestKeyframe("")
+	}
+
+	return nil
+}
+
+// Returns the session currently feeding the viewers of this session
+func (s *Session) GetSource() *Session {
+	return s.source.Load()
+}
+
+// Returns the host of the session, or the host of the source when the session has none
+func (s *Session) ActiveHost() *whip.WHIPSession {
+	if host := s.Host.Load(); host != nil {
+		return host
+	}
+
+	if source := s.source.Load(); source != nil {
+		return source.Host.Load()
+	}
+
+	return nil
+}
+
+func (s *Session) addRelay(relay *Session) {
+	s.relaysLock.Lock()
+	defer s.relaysLock.Unlock()
+
+	if s.relays == nil {
+		s.relays = map[string]*Session{}
+	}
+
+	s.relays[relay.StreamKey] = relay
+}
+
+func (s *Session) removeRelay(relay *Session) {
+	s.relaysLock.Lock()
+	defer s.relaysLock.Unlock()
+
+	if s.relays[relay.StreamKey] == relay {
+		delete(s.relays, relay.StreamKey)
+	}
+}
+
+// Detach all sessions relaying this session, used when the session closes
+func (s *Session) detachRelays() {
+	s.relaysLock.Lock()
+	relays := make([]*Session, 0, len(s.relays))
+	for _, relay := range s.relays {
+		relays = append(relays, relay)
+	}
+	s.relays = nil
+	s.relaysLock.Unlock()
+
+	for _, relay := range relays {
+		relay.source.CompareAndSwap(s, nil)
+	}
+}
+
+// Adds open WHEP sessions of all relaying sessions to the provided snapshot
+func (s *Session) appendRelayWHEPSessions(snapshot map[string]*whep.WHEPSession) {
+	s.relaysLock.RLock()
+	defer s.relaysLock.RUnlock()
+
+	for _, relay := range s.relays {
+		// A relay with its own host is fed by that host
+		if relay.Host.Load() != nil {
+			continue
+		}
+
+		relay.WHEPSessionsLock.RLock()
+		for _, whepSession := range relay.WHEPSessions {
+			if !whepSession.IsSessionClosed.Load() {
+				snapshot[whepSession.SessionID] = whepSession
+			}
+		}
+		relay.WHEPSessionsLock.RUnlock()
+	}
+}
+
+func sourceStreamKey(source *Session) string {
+	if source == nil {
+		return ""
+	}
+
+	return source.StreamKey
+}
@@ -0,0 +1,57 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVirtualSessionSourceSwitch(t *testing.T) {
+	first := newTestSessionWithHost("first")
+	second := newTestSessionWithHost("second")
+	virtual := &Session{StreamKey: "virtual", WHEPSessions: map[string]*whep.WHEPSession{}}
+	virtual.IsVirtual.Store(true)
+
+	viewer := whep.CreateNewWHEP("viewer", virtual.StreamKey, nil, nil, nil, func(string) {})
+	virtual.WHEPSessions[viewer.SessionID] = viewer
+
+	// Attach to first source
+	assert.NoError(t, virtual.SetSource(first))
+	assert.Contains(t, hostSnapshot(first), viewer.SessionID)
+	assert.Equal(t, first.Host.Load(), virtual.ActiveHost())
+	assert.True(t, virtual.GetStreamStatus().IsOnline)
+
+	// Switch to second source, viewer waits for keyframe
+	viewer.IsWaitingForKeyframe.Store(false)
+	assert.NoError(t, virtual.SetSource(second))
+	assert.NotContains(t, hostSnapshot(first), viewer.SessionID)
+	assert.Contains(t, hostSnapshot(second), viewer.SessionID)
+	assert.True(t, viewer.IsWaitingForKeyframe.Load())
+
+	// Virtual sessions and itself are rejected as source
+	assert.ErrorIs(t, second.SetSource(virtual), errSourceIsVirtual)
+	assert.ErrorIs(t, virtual.SetSource(virtual), errSourceIsSelf)
+
+	// Closing the source detaches the virtual session
+	second.Close()
+	assert.Nil(t, virtual.GetSource())
+	assert.False(t, virtual.GetStreamStatus().IsOnline)
+}
+
+func newTestSessionWithHost(streamKey string) *Session {
+	s := &Session{StreamKey: streamKey, WHEPSessions: map[string]*whep.WHEPSession{}}
+	s.Host.Store(&whip.WHIPSession{
+		ID:          streamKey + "-host",
+		AudioTracks: map[string]*whip.AudioTrack{},
+		VideoTracks: map[string]*whip.VideoTrack{},
+	})
+	s.updateHostWHEPSessionsSnapshot()
+	return s
+}
+
+func hostSnapshot(s *Session) map[string]*whep.WHEPSession {
+	snapshot, _ := s.Host.Load().WHEPSessionsSnapshot.Load().(map[string]*whep.WHEPSession)
+	return snapshot
+}
@@ -0,0 +1,180 @@
+package whep
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type benchmarkTrackContext struct {
+	writer benchmarkTrackWriter
+}
+
+func (c *benchmarkTrackContext) CodecParameters() []webrtc.RTPCodecParameters {
+	return []webrtc.RTPCodecParameters{{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000},
+		PayloadType:        96,
+	}}
+}
+func (c *benchmarkTrackContext) HeaderExtensions() []webrtc.RTPHeaderExtensionParameter { return nil }
+func (c *benchmarkTrackContext) SSRC() webrtc.SSRC                                      { return 1234 }
+func (c *benchmarkTrackContext) SSRCRetransmission() webrtc.SSRC                        { return 0 }
+func (c *benchmarkTrackContext) SSRCForwardErrorCorrection() webrtc.SSRC                { return 0 }
+func (c *benchmarkTrackContext) WriteStream() webrtc.TrackLocalWriter                   { return &c.writer }
+func (c *benchmarkTrackContext) ID() string                                             { return "benchmark" }
+func (c *benchmarkTrackContext) RTCPReader() interceptor.RTCPReader                     { return nil }
+
+// Marshals the header like the SRTP writer would, without encrypting or sending
+type benchmarkTrackWriter struct {
+	buf [1500]byte
+}
+
+func (w *benchmarkTrackWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	n, err := header.MarshalTo(w.buf[:])
+	if err != nil {
+		return 0, err
+	}
+
+	return n + copy(w.buf[n:], payload), nil
+}
+
+func (w *benchmarkTrackWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+func newBenchmarkWHEPSession(tb testing.TB, id string) *WHEPSession {
+	videoTrack := codecs.CreateTrackMultiCodec("video-"+id, "", "stream", webrtc.RTPCodecTypeVideo, codecs.VideoTrackCodecH264)
+	_, err := videoTrack.Bind(&benchmarkTrackContext{})
+	require.NoError(tb, err)
+
+	w := &WHEPSession{
+		SessionID:  id,
+		VideoTrack: videoTrack,
+		pliSender:  func(string) {},
+	}
+	w.VideoLayerCurrent.Store("")
+	w.AudioLayerCurrent.Store("")
+	return w
+}
+
+// Measures delivery of a single publisher packet to every viewer, as done by the send queue goroutines
+func BenchmarkVideoFanOut(b *testing.B) {
+	for _, viewerCount := range []int{1, 100, 1000} {
+		b.Run(fmt.Sprintf("viewers=%d", viewerCount), func(b *testing.B) {
+			viewers := make([]*WHEPSession, viewerCount)
+			for i := range viewers {
+				viewers[i] = newBenchmarkWHEPSession(b, fmt.Sprint(i))
+			}
+
+			packet := codecs.TrackPacket{
+				Layer:        codecs.VideoTrackLabelDefault,
+				Packet:       &rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1}, Payload: make([]byte, 1100)},
+				Codec:        codecs.VideoTrackCodecH264,
+				IsKeyframe:   true,
+				TimeDiff:     3000,
+				SequenceDiff: 1,
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for b.Loop() {
+				for _, viewer := range viewers {
+					if viewer.GetVideoLayerOrDefault(packet.Layer, 1) != packet.Layer {
+						continue
+					}
+
+					viewer.writeVideoPacket(packet)
+				}
+			}
+
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*viewerCount), "ns/viewer")
+		})
+	}
+}
+
+// Measures a publisher packet read into a pooled buffer, queued for every viewer and written by their send queue goroutines
+func BenchmarkVideoSendQueue(b *testing.B) {
+	rawPacket, err := (&rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1}, Payload: make([]byte, 1100)}).Marshal()
+	require.NoError(b, err)
+
+	for _, viewerCount := range []int{1, 100, 1000} {
+		b.Run(fmt.Sprintf("viewers=%d", viewerCount), func(b *testing.B) {
+			viewers := make([]*WHEPSession, viewerCount)
+			for i := range viewers {
+				viewers[i] = newBenchmarkWHEPSession(b, fmt.Sprint(i))
+				viewers[i].sendQueue = make(chan queuedPacket, DefaultSendQueueSize)
+				viewers[i].sendQueueDone = make(chan struct{})
+				go viewers[i].drainSendQueue()
+			}
+			b.Cleanup(func() {
+				for _, viewer := range viewers {
+					close(viewer.sendQueueDone)
+				}
+			})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			packets := uint64(0)
+			for b.Loop() {
+				buffer := codecs.GetPacketBuffer()
+				copy(buffer.Data(), rawPacket)
+				require.NoError(b, buffer.Unmarshal(len(rawPacket)))
+
+				packet := codecs.TrackPacket{
+					Layer:        codecs.VideoTrackLabelDefault,
+					Packet:       &buffer.Packet,
+					Codec:        codecs.VideoTrackCodecH264,
+					IsKeyframe:   true,
+					TimeDiff:     3000,
+					SequenceDiff: 1,
+					Buffer:       buffer,
+				}
+				for _, viewer := range viewers {
+					viewer.SendVideoPacket(packet)
+				}
+				packet.Release()
+				packets++
+			}
+
+			// Wait for the queues to be drained, packets of a full queue are dropped
+			for _, viewer := range viewers {
+				for {
+					viewer.VideoLock.Lock()
+					delivered := viewer.VideoPacketsWritten + viewer.QueueDropped.Load()
+					viewer.VideoLock.Unlock()
+
+					if delivered >= packets {
+						break
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*viewerCount), "ns/viewer")
+		})
+	}
+}
+
+func TestVideoFanOutDoesNotModifySharedPacket(t *testing.T) {
+	packet := codecs.TrackPacket{
+		Layer:        codecs.VideoTrackLabelDefault,
+		Packet:       &rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1, SequenceNumber: 10, Timestamp: 20}, Payload: []byte{1, 2, 3}},
+		Codec:        codecs.VideoTrackCodecH264,
+		IsKeyframe:   true,
+		SequenceDiff: 1,
+	}
+	shared := packet.Packet.Clone()
+
+	for i := range 2 {
+		viewer := newBenchmarkWHEPSession(t, fmt.Sprint(i))
+		viewer.writeVideoPacket(packet)
+		require.Equal(t, uint32(1234), viewer.videoPacket.SSRC)
+	}
+
+	require.Equal(t, shared, packet.Packet)
+}
@@ -9,8 +9,25 @@ import (
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 )
 
-// Sends provided audio packet to the WHEP session
+// Queues provided audio packet for the WHEP session
 func (w *WHEPSession) SendAudioPacket(packet codecs.TrackPacket) {
+	if w.audioPaused.Load() {
+		return
+	}
+
+	w.enqueue(queuedPacket{packet: packet})
+}
+
+// Queues provided video packet for the WHEP session
+func (w *WHEPSession) SendVideoPacket(packet codecs.TrackPacket) {
+	if w.videoPaused.Load() {
+		return
+	}
+
+	w.enqueue(queuedPacket{packet: packet, isVideo: true})
+}
+
+func (w *WHEPSession) writeAudioPacket(packet codecs.TrackPacket) {
 	if w.IsSessionClosed.Load() {
 		return
 	}
@@ -22,11 +39,20 @@ func (w *WHEPSession) SendAudioPacket(packet codecs.TrackPacket) {
 	}
 
 	w.AudioPacketsWritten += 1
+	w.AudioSequenceNumber = uint16(w.AudioSequenceNumber) + uint16(packet.SequenceDiff)
 	w.AudioTimestamp = uint32(int64(w.AudioTimestamp) + packet.TimeDiff)
+	audioSequenceNumber := w.AudioSequenceNumber
+	audioTimestamp := w.AudioTimestamp
 	audioTrack := w.AudioTrack
 	w.AudioLock.Unlock()
 
-	if err := audioTrack.WriteRTP(packet.Packet, packet.Codec); err != nil {
+	// The payload is shared between viewers, the header is written to this session's own packet
+	w.audioPacket = *packet.Packet
+	w.audioExtensions = append(w.audioExtensions[:0], packet.Packet.Extensions...)
+	w.audioPacket.Extensions = w.audioExtensions
+	w.audioPacket.SequenceNumber = audioSequenceNumber
+	w.audioPacket.Timestamp = audioTimestamp
+	if err := audioTrack.WriteRTP(&w.audioPacket, packet.Codec); err != nil {
 		if errors.Is(err, io.ErrClosedPipe) {
 			slog.Info("WHEPSession.SendAudioPacket.ConnectionDropped")
 			w.Close()
@@ -36,15 +62,20 @@ func (w *WHEPSession) SendAudioPacket(packet codecs.TrackPacket) {
 	}
 }
 
-// Sends provided video packet to the WHEP session
-func (w *WHEPSession) SendVideoPacket(packet codecs.TrackPacket) {
+func (w *WHEPSession) writeVideoPacket(packet codecs.TrackPacket) {
 	if w.IsSessionClosed.Load() {
 		return
 	}
 
 	if w.IsWaitingForKeyframe.Load() {
 		if !packet.IsKeyframe {
-			w.SendPLI()
+			// Skipped packets still advance the counters, so timestamps keep up with the publisher
+			w.VideoLock.Lock()
+			w.VideoSequenceNumber = uint16(w.VideoSequenceNumber) + uint16(packet.SequenceDiff)
+			w.VideoTimestamp = uint32(int64(w.VideoTimestamp) + packet.TimeDiff)
+			w.VideoLock.Unlock()
+
+			w.sendPLIForLayer(packet.Layer)
 			return
 		}
 
@@ -66,10 +97,11 @@ func (w *WHEPSession) SendVideoPacket(packet codecs.TrackPacket) {
 		return
 	}
 
-	packet.Packet.SequenceNumber = videoSequenceNumber
-	packet.Packet.Timestamp = videoTimestamp
+	w.videoPacket = *packet.Packet
+	w.videoPacket.SequenceNumber = videoSequenceNumber
+	w.videoPacket.Timestamp = videoTimestamp
 
-	if err := videoTrack.WriteRTP(packet.Packet, packet.Codec); err != nil {
+	if err := videoTrack.WriteRTP(&w.videoPacket, packet.Codec); err != nil {
 		w.VideoPacketsDropped.Add(1)
 
 		if errors.Is(err, io.ErrClosedPipe) {
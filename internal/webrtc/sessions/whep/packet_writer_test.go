@@ -0,0 +1,61 @@
+package whep
+
+import (
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	headers []rtp.Header
+}
+
+func (s *recordingSink) WritePacket(_ webrtc.RTPCodecType, packet *rtp.Packet, _ codecs.TrackCodeType) error {
+	s.headers = append(s.headers, packet.Header)
+	return nil
+}
+
+func TestAudioContinuesAcrossSourceSwitch(t *testing.T) {
+	sink := &recordingSink{}
+	audioTrack := codecs.CreateTrackMultiCodecSink("audio", "pion", "stream", webrtc.RTPCodecTypeAudio, sink)
+	w := CreateNewWHEP("viewer", "stream", audioTrack, nil, nil, func(string) {})
+
+	// The differences are relative to the previous packet of the same source
+	packets := []codecs.TrackPacket{
+		{Packet: &rtp.Packet{Header: rtp.Header{SequenceNumber: 100, Timestamp: 9600}}},
+		{Packet: &rtp.Packet{Header: rtp.Header{SequenceNumber: 101, Timestamp: 10560}}, TimeDiff: 960, SequenceDiff: 1},
+		{Packet: &rtp.Packet{Header: rtp.Header{SequenceNumber: 40000, Timestamp: 123456}}, TimeDiff: 960, SequenceDiff: 1},
+		{Packet: &rtp.Packet{Header: rtp.Header{SequenceNumber: 40001, Timestamp: 124416}}, TimeDiff: 960, SequenceDiff: 1},
+	}
+	for _, packet := range packets {
+		packet.Packet.Payload = []byte{0xfc}
+		w.writeAudioPacket(packet)
+	}
+
+	if assert.Len(t, sink.headers, len(packets)) {
+		for i, header := range sink.headers {
+			assert.Equal(t, uint16(i), header.SequenceNumber)
+			assert.Equal(t, uint32(5000+960*i), header.Timestamp)
+		}
+	}
+
+	// The source's packets are shared with other viewers and are not modified
+	assert.Equal(t, uint16(40000), packets[2].Packet.SequenceNumber)
+}
+
+func TestAudioPacketCopiesExtensions(t *testing.T) {
+	audioTrack := codecs.CreateTrackMultiCodecSink("audio", "pion", "stream", webrtc.RTPCodecTypeAudio, &recordingSink{})
+	w := CreateNewWHEP("viewer", "stream", audioTrack, nil, nil, func(string) {})
+
+	packet := codecs.TrackPacket{Packet: &rtp.Packet{Payload: []byte{0xfc}}}
+	require.NoError(t, packet.Packet.SetExtension(1, []byte{0x80}))
+	w.writeAudioPacket(packet)
+
+	// The shared packet's extensions are reused by the next packet read into its pooled buffer
+	packet.Packet.Extensions[0] = rtp.Extension{}
+	assert.Equal(t, []byte{0x80}, w.audioPacket.GetExtension(1))
+}
@@ -0,0 +1,61 @@
+package whep
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	MediaKindAudio = "audio"
+	MediaKindVideo = "video"
+)
+
+// Pause or resume forwarding of a kind of media to the viewer, both kinds when kind is empty.
+// Video resumes on the next keyframe.
+func (w *WHEPSession) SetMediaPaused(kind string, paused bool) error {
+	switch kind {
+	case "":
+		w.audioPaused.Store(paused)
+		w.setVideoPaused(paused)
+	case MediaKindAudio:
+		w.audioPaused.Store(paused)
+	case MediaKindVideo:
+		w.setVideoPaused(paused)
+	default:
+		return fmt.Errorf("unknown media kind %q", kind)
+	}
+
+	slog.Info("WHEPSession.SetMediaPaused", "id", w.SessionID, "kind", kind, "paused", paused)
+	return nil
+}
+
+func (w *WHEPSession) IsAudioPaused() bool {
+	return w.audioPaused.Load()
+}
+
+func (w *WHEPSession) IsVideoPaused() bool {
+	return w.videoPaused.Load()
+}
+
+func (w *WHEPSession) setVideoPaused(paused bool) {
+	if w.videoPaused.Swap(paused) == paused {
+		return
+	}
+
+	// A paused viewer does not count towards egress bandwidth
+	if paused {
+		w.VideoLock.Lock()
+		w.VideoBitrate.Store(0)
+		w.videoBitrateWindowStart = time.Now()
+		w.videoBitrateWindowBytes = w.VideoBytesWritten
+		w.VideoLock.Unlock()
+		return
+	}
+
+	w.IsWaitingForKeyframe.Store(true)
+	for slot := 1; slot <= len(w.stageTracks); slot++ {
+		w.ResetStageSlot(slot)
+	}
+	w.SendPLI()
+}
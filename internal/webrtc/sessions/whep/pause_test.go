@@ -0,0 +1,36 @@
+package whep
+
+import (
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWHEPSessionMediaPaused(t *testing.T) {
+	audioTrack, videoTrack := codecs.GetDefaultTracks("stream")
+
+	keyframeRequests := 0
+	w := CreateNewWHEP("viewer", "stream", audioTrack, videoTrack, newTestPeerConnection(t), func(string) { keyframeRequests++ })
+	defer w.Close()
+	w.IsWaitingForKeyframe.Store(false)
+
+	assert.NoError(t, w.SetMediaPaused(MediaKindVideo, true))
+	assert.True(t, w.IsVideoPaused())
+	assert.False(t, w.IsAudioPaused())
+	assert.Zero(t, w.GetWHEPSessionStatus().VideoBitrate)
+
+	w.SendVideoPacket(codecs.TrackPacket{IsKeyframe: true})
+	assert.Empty(t, w.sendQueue)
+
+	// Video resumes on a keyframe
+	assert.NoError(t, w.SetMediaPaused(MediaKindVideo, false))
+	assert.True(t, w.IsWaitingForKeyframe.Load())
+	assert.Equal(t, 1, keyframeRequests)
+
+	assert.NoError(t, w.SetMediaPaused("", true))
+	assert.True(t, w.GetWHEPSessionStatus().AudioPaused)
+	assert.True(t, w.GetWHEPSessionStatus().VideoPaused)
+
+	assert.Error(t, w.SetMediaPaused("data", true))
+}
@@ -0,0 +1,158 @@
+package whep
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+)
+
+const (
+	DefaultSendQueueSize = 512
+
+	// Drop packets until the next keyframe
+	SlowConsumerPolicyDrop = "drop"
+	// Drop packets until the next keyframe and move the viewer to a lower simulcast layer
+	SlowConsumerPolicyDowngrade = "downgrade"
+	// Close the viewer session
+	SlowConsumerPolicyDisconnect = "disconnect"
+)
+
+type queuedPacket struct {
+	packet  codecs.TrackPacket
+	isVideo bool
+
+	// Stage guest the packet belongs to, 0 for the host
+	stageSlot int
+}
+
+// Track of the session a dropped packet belonged to
+type droppedTrack struct {
+	isVideo   bool
+	stageSlot int
+}
+
+// Summed differences of packets dropped from a track
+type droppedDiff struct {
+	timeDiff     int64
+	sequenceDiff int
+}
+
+func getSendQueueSize() int {
+	if val := os.Getenv(environment.WHEPSendQueueSize); val != "" {
+		if size, err := strconv.Atoi(val); err == nil && size > 0 {
+			return size
+		}
+	}
+
+	return DefaultSendQueueSize
+}
+
+func getSlowConsumerPolicy() string {
+	switch policy := strings.ToLower(os.Getenv(environment.WHEPSlowConsumerPolicy)); policy {
+	case SlowConsumerPolicyDowngrade, SlowConsumerPolicyDisconnect:
+		return policy
+	default:
+		return SlowConsumerPolicyDrop
+	}
+}
+
+// Queue a packet for delivery, applying the slow consumer policy when the queue is full.
+// The pooled buffer of a queued packet is held until the packet was written.
+func (w *WHEPSession) enqueue(packet queuedPacket) {
+	if w.IsSessionClosed.Load() {
+		return
+	}
+
+	if w.hasDroppedDiffs.Load() {
+		w.takeDroppedDiffs(&packet)
+	}
+
+	packet.packet.Retain()
+	select {
+	case w.sendQueue <- packet:
+	default:
+		packet.packet.Release()
+		w.addDroppedDiffs(packet)
+		w.handleSlowConsumer(packet)
+	}
+}
+
+// Keep the differences of a dropped packet, so the viewer's timestamps and sequence numbers stay continuous
+func (w *WHEPSession) addDroppedDiffs(packet queuedPacket) {
+	w.droppedDiffsLock.Lock()
+	defer w.droppedDiffsLock.Unlock()
+
+	if w.droppedDiffs == nil {
+		w.droppedDiffs = map[droppedTrack]droppedDiff{}
+	}
+
+	track := droppedTrack{isVideo: packet.isVideo, stageSlot: packet.stageSlot}
+	diff := w.droppedDiffs[track]
+	diff.timeDiff += packet.packet.TimeDiff
+	diff.sequenceDiff += packet.packet.SequenceDiff
+	w.droppedDiffs[track] = diff
+	w.hasDroppedDiffs.Store(true)
+}
+
+// Add the differences of packets dropped before this packet of the same track
+func (w *WHEPSession) takeDroppedDiffs(packet *queuedPacket) {
+	w.droppedDiffsLock.Lock()
+	defer w.droppedDiffsLock.Unlock()
+
+	track := droppedTrack{isVideo: packet.isVideo, stageSlot: packet.stageSlot}
+	diff, ok := w.droppedDiffs[track]
+	if !ok {
+		return
+	}
+
+	delete(w.droppedDiffs, track)
+	w.hasDroppedDiffs.Store(len(w.droppedDiffs) != 0)
+
+	packet.packet.TimeDiff += diff.timeDiff
+	packet.packet.SequenceDiff += diff.sequenceDiff
+}
+
+func (w *WHEPSession) handleSlowConsumer(packet queuedPacket) {
+	if w.QueueDropped.Add(1) == 1 {
+		slog.Warn("WHEPSession.SendQueue: Queue is full, applying slow consumer policy", "id", w.SessionID, "policy", w.slowConsumerPolicy)
+	}
+
+	switch w.slowConsumerPolicy {
+	case SlowConsumerPolicyDisconnect:
+		slog.Info("WHEPSession.SendQueue: Disconnecting slow consumer", "id", w.SessionID)
+		go w.Close()
+		return
+	case SlowConsumerPolicyDowngrade:
+		w.downgradeVideoLayer()
+	}
+
+	if packet.isVideo && packet.stageSlot != 0 {
+		w.ResetStageSlot(packet.stageSlot)
+	} else if packet.isVideo {
+		w.IsWaitingForKeyframe.Store(true)
+	}
+}
+
+// Writes queued packets to the viewer until the session is closed.
+// Packets still queued when the session closes are left to the garbage collector.
+func (w *WHEPSession) drainSendQueue() {
+	for {
+		select {
+		case <-w.sendQueueDone:
+			return
+		case queued := <-w.sendQueue:
+			if queued.stageSlot != 0 {
+				w.writeStagePacket(queued.stageSlot, queued.packet, queued.isVideo)
+			} else if queued.isVideo {
+				w.writeVideoPacket(queued.packet)
+			} else {
+				w.writeAudioPacket(queued.packet)
+			}
+			queued.packet.Release()
+		}
+	}
+}
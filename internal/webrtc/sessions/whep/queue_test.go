@@ -0,0 +1,120 @@
+package whep
+
+import (
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowConsumerDowngradesVideoLayer(t *testing.T) {
+	t.Setenv(environment.WHEPSlowConsumerPolicy, SlowConsumerPolicyDowngrade)
+
+	w := CreateNewWHEP("viewer", "stream", nil, nil, newTestPeerConnection(t), func(string) {})
+	defer w.Close()
+
+	assert.Equal(t, "high", w.GetVideoLayerOrDefault("high", 1))
+	w.handleSlowConsumer(queuedPacket{packet: codecs.TrackPacket{Layer: "high", Packet: &rtp.Packet{}}, isVideo: true})
+
+	assert.EqualValues(t, 1, w.QueueDropped.Load())
+	assert.True(t, w.IsWaitingForKeyframe.Load())
+
+	// Current layer is kept until a lower layer shows up, better layers are no longer picked
+	assert.Equal(t, "high", w.GetVideoLayerOrDefault("high", 1))
+	assert.Equal(t, "low", w.GetVideoLayerOrDefault("low", 2))
+	assert.Equal(t, "low", w.GetVideoLayerOrDefault("high", 1))
+
+	// Explicit layer selection lifts the downgrade
+	w.SetVideoLayer("high")
+	assert.Equal(t, "high", w.GetVideoLayerOrDefault("low", 2))
+}
+
+func TestSlowConsumerDisconnects(t *testing.T) {
+	t.Setenv(environment.WHEPSlowConsumerPolicy, SlowConsumerPolicyDisconnect)
+
+	closed := make(chan string, 1)
+	w := CreateNewWHEP("viewer", "stream", nil, nil, newTestPeerConnection(t), func(string) {})
+	w.SetOnClose(func(id string) { closed <- id })
+
+	w.handleSlowConsumer(queuedPacket{isVideo: true})
+	assert.Equal(t, "viewer", <-closed)
+	assert.True(t, w.IsSessionClosed.Load())
+}
+
+func newTestPeerConnection(t *testing.T) *webrtc.PeerConnection {
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	return peerConnection
+}
+
+func TestWHEPSessionMode(t *testing.T) {
+	audioTrack, videoTrack := codecs.GetDefaultTracks("stream")
+
+	w := CreateNewWHEP("viewer", "stream", audioTrack, nil, newTestPeerConnection(t), func(string) {})
+	defer w.Close()
+
+	assert.Equal(t, ModeAudioOnly, w.GetWHEPSessionStatus().Mode)
+	assert.True(t, w.ReceivesAudio())
+	assert.False(t, w.ReceivesVideo())
+
+	w = CreateNewWHEP("viewer", "stream", audioTrack, videoTrack, newTestPeerConnection(t), func(string) {})
+	defer w.Close()
+
+	assert.Equal(t, ModeAudioVideo, w.GetWHEPSessionStatus().Mode)
+	assert.True(t, w.ReceivesVideo())
+}
+
+func TestQueueOverflowKeepsTimestampsContinuous(t *testing.T) {
+	audioSink, videoSink := &recordingSink{}, &recordingSink{}
+	w := &WHEPSession{
+		AudioTrack:         codecs.CreateTrackMultiCodecSink("audio", "pion", "stream", webrtc.RTPCodecTypeAudio, audioSink),
+		VideoTrack:         codecs.CreateTrackMultiCodecSink("video", "pion", "stream", webrtc.RTPCodecTypeVideo, videoSink),
+		AudioTimestamp:     5000,
+		VideoTimestamp:     5000,
+		pliSender:          func(string) {},
+		sendQueue:          make(chan queuedPacket, 1),
+		slowConsumerPolicy: SlowConsumerPolicyDrop,
+	}
+	w.VideoLayerCurrent.Store("")
+
+	drain := func() {
+		queued := <-w.sendQueue
+		if queued.isVideo {
+			w.writeVideoPacket(queued.packet)
+		} else {
+			w.writeAudioPacket(queued.packet)
+		}
+	}
+
+	// Audio packets dropped from the full queue still advance the viewer's timestamps
+	for range 3 {
+		w.SendAudioPacket(codecs.TrackPacket{Packet: &rtp.Packet{Payload: []byte{0xfc}}, TimeDiff: 960, SequenceDiff: 1})
+	}
+	drain()
+	w.SendAudioPacket(codecs.TrackPacket{Packet: &rtp.Packet{Payload: []byte{0xfc}}, TimeDiff: 960, SequenceDiff: 1})
+	drain()
+
+	require.Len(t, audioSink.headers, 2)
+	assert.Equal(t, uint32(5000+960), audioSink.headers[0].Timestamp)
+	assert.Equal(t, uint32(5000+4*960), audioSink.headers[1].Timestamp)
+	assert.Equal(t, uint16(4), audioSink.headers[1].SequenceNumber)
+
+	// Video packets dropped, and skipped while waiting for the next keyframe, advance them as well
+	for range 2 {
+		w.SendVideoPacket(codecs.TrackPacket{Packet: &rtp.Packet{Payload: []byte{1}}, TimeDiff: 3000, SequenceDiff: 1})
+	}
+	assert.True(t, w.IsWaitingForKeyframe.Load())
+	drain()
+	w.SendVideoPacket(codecs.TrackPacket{Packet: &rtp.Packet{Payload: []byte{1}}, TimeDiff: 3000, SequenceDiff: 1})
+	drain()
+	w.SendVideoPacket(codecs.TrackPacket{Packet: &rtp.Packet{Payload: []byte{1}}, IsKeyframe: true, TimeDiff: 3000, SequenceDiff: 1})
+	drain()
+
+	require.Len(t, videoSink.headers, 1)
+	assert.Equal(t, uint32(5000+4*3000), videoSink.headers[0].Timestamp)
+	assert.Equal(t, uint16(4), videoSink.headers[0].SequenceNumber)
+}
@@ -1,7 +1,24 @@
 package whep
 
+const (
+	ModeAudioVideo = "audio-video"
+	ModeAudioOnly  = "audio-only"
+	ModeVideoOnly  = "video-only"
+
+	TransportWebRTC = "webrtc"
+	// Fragmented MP4 over a WebSocket, the session has no PeerConnection
+	TransportWebSocket = "websocket"
+	// MoQ tracks over WebTransport, the session has no PeerConnection
+	TransportWebTransport = "webtransport"
+)
+
 type SessionState struct {
-	ID string `json:"id"`
+	ID        string `json:"id"`
+	Mode      string `json:"mode"`
+	Transport string `json:"transport"`
+
+	AudioPaused bool `json:"audioPaused"`
+	VideoPaused bool `json:"videoPaused"`
 
 	AudioLayerCurrent   string `json:"audioLayerCurrent"`
 	AudioTimestamp      uint32 `json:"audioTimestamp"`
@@ -14,4 +31,10 @@ type SessionState struct {
 	VideoPacketsDropped uint64 `json:"videoPacketsDropped"`
 	VideoPacketsWritten uint64 `json:"videoPacketsWritten"`
 	VideoSequenceNumber uint64 `json:"videoSequenceNumber"`
+
+	KeyframeRequests uint64 `json:"keyframeRequests"`
+
+	QueueDepth    int    `json:"queueDepth"`
+	QueueCapacity int    `json:"queueCapacity"`
+	QueueDropped  uint64 `json:"queueDropped"`
 }
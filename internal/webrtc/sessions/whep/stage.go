@@ -0,0 +1,124 @@
+package whep
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+// Tracks carrying a stage guest to the viewer, the first guest uses slot 1
+type StageTrack struct {
+	AudioTrack      *codecs.TrackMultiCodec
+	VideoTrack      *codecs.TrackMultiCodec
+	VideoRTCPSender *webrtc.RTPSender
+
+	isWaitingForKeyframe atomic.Bool
+
+	// Owned by the send queue goroutine
+	audioSequenceNumber uint16
+	audioTimestamp      uint32
+	videoSequenceNumber uint16
+	videoTimestamp      uint32
+}
+
+// Set the tracks negotiated for stage guests, must be called before packets are sent
+func (w *WHEPSession) SetStageTracks(stageTracks []*StageTrack, pliSender func(slot int)) {
+	for _, stageTrack := range stageTracks {
+		stageTrack.audioTimestamp = 5000
+		stageTrack.videoTimestamp = 5000
+		stageTrack.isWaitingForKeyframe.Store(true)
+	}
+
+	w.stageTracks = stageTracks
+	w.stagePLISender = pliSender
+}
+
+// Returns the number of stage guests the viewer can receive
+func (w *WHEPSession) GetStageSlotCount() int {
+	return len(w.stageTracks)
+}
+
+// Wait for a keyframe of the guest now publishing in the slot
+func (w *WHEPSession) ResetStageSlot(slot int) {
+	if stageTrack := w.getStageTrack(slot); stageTrack != nil {
+		stageTrack.isWaitingForKeyframe.Store(true)
+	}
+}
+
+// Queues provided audio packet of the stage guest in the slot
+func (w *WHEPSession) SendStageAudioPacket(slot int, packet codecs.TrackPacket) {
+	if w.audioPaused.Load() || w.getStageTrack(slot) == nil {
+		return
+	}
+
+	w.enqueue(queuedPacket{packet: packet, stageSlot: slot})
+}
+
+// Queues provided video packet of the stage guest in the slot
+func (w *WHEPSession) SendStageVideoPacket(slot int, packet codecs.TrackPacket) {
+	if w.videoPaused.Load() || w.getStageTrack(slot) == nil {
+		return
+	}
+
+	w.enqueue(queuedPacket{packet: packet, isVideo: true, stageSlot: slot})
+}
+
+func (w *WHEPSession) getStageTrack(slot int) *StageTrack {
+	if slot < 1 || slot > len(w.stageTracks) {
+		return nil
+	}
+
+	return w.stageTracks[slot-1]
+}
+
+func (w *WHEPSession) writeStagePacket(slot int, packet codecs.TrackPacket, isVideo bool) {
+	stageTrack := w.getStageTrack(slot)
+	if stageTrack == nil || w.IsSessionClosed.Load() {
+		return
+	}
+
+	w.stagePacket = *packet.Packet
+	w.stageExtensions = append(w.stageExtensions[:0], packet.Packet.Extensions...)
+	w.stagePacket.Extensions = w.stageExtensions
+
+	track := stageTrack.AudioTrack
+	if isVideo {
+		if stageTrack.isWaitingForKeyframe.Load() {
+			if !packet.IsKeyframe {
+				stageTrack.videoSequenceNumber += uint16(packet.SequenceDiff)
+				stageTrack.videoTimestamp = uint32(int64(stageTrack.videoTimestamp) + packet.TimeDiff)
+
+				if w.stagePLISender != nil {
+					w.stagePLISender(slot)
+				}
+				return
+			}
+
+			stageTrack.isWaitingForKeyframe.Store(false)
+		}
+
+		stageTrack.videoSequenceNumber += uint16(packet.SequenceDiff)
+		stageTrack.videoTimestamp = uint32(int64(stageTrack.videoTimestamp) + packet.TimeDiff)
+		w.stagePacket.SequenceNumber = stageTrack.videoSequenceNumber
+		w.stagePacket.Timestamp = stageTrack.videoTimestamp
+		track = stageTrack.VideoTrack
+	} else {
+		stageTrack.audioSequenceNumber += uint16(packet.SequenceDiff)
+		stageTrack.audioTimestamp = uint32(int64(stageTrack.audioTimestamp) + packet.TimeDiff)
+		w.stagePacket.SequenceNumber = stageTrack.audioSequenceNumber
+		w.stagePacket.Timestamp = stageTrack.audioTimestamp
+	}
+
+	if err := track.WriteRTP(&w.stagePacket, packet.Codec); err != nil {
+		if errors.Is(err, io.ErrClosedPipe) {
+			slog.Info("WHEPSession.SendStagePacket.ConnectionDropped")
+			w.Close()
+		} else {
+			slog.Error("WHEPSession.SendStagePacket.Error", "err", err)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -13,16 +15,51 @@ type (
 	WHEPSession struct {
 		SessionID            string
 		StreamKey            string
+		Mode                 string
+		Transport            string
 		IsWaitingForKeyframe atomic.Bool
 		IsSessionClosed      atomic.Bool
 
+		// Set by the viewer while it is not watching, paused media is not forwarded
+		audioPaused atomic.Bool
+		videoPaused atomic.Bool
+
 		SessionClose sync.Once
 		onClose      func(string)
-		pliSender    func()
+		pliSender    func(layer string)
+
+		// Packets waiting to be written by the session's own goroutine
+		sendQueue          chan queuedPacket
+		sendQueueDone      chan struct{}
+		slowConsumerPolicy string
+		QueueDropped       atomic.Uint64
+
+		// Differences of packets dropped from the full queue, carried by the next queued packet of their track
+		droppedDiffsLock sync.Mutex
+		droppedDiffs     map[droppedTrack]droppedDiff
+		hasDroppedDiffs  atomic.Bool
+
+		// Owned by the send queue goroutine, carry this session's header over the shared payload.
+		// Header extensions are copied, the shared packet's extensions belong to a pooled buffer.
+		videoPacket     rtp.Packet
+		audioPacket     rtp.Packet
+		stagePacket     rtp.Packet
+		audioExtensions []rtp.Extension
+		stageExtensions []rtp.Extension
+
+		// Tracks of stage guests, set before the session receives packets
+		stageTracks    []*StageTrack
+		stagePLISender func(slot int)
+
+		// Number of keyframes this session asked the publisher for
+		KeyframeRequests atomic.Uint64
 
 		PeerConnectionLock sync.RWMutex
 		PeerConnection     *webrtc.PeerConnection
 
+		// Server candidates for clients that trickle
+		Candidates *utils.CandidateCollector
+
 		// Protects VideoTrack, VideoTimestamp, VideoPacketsWritten, VideoSequenceNumber,
 		// and auto video layer selection state.
 		VideoLock               sync.RWMutex
@@ -38,6 +75,7 @@ type (
 		VideoLayerCurrent       atomic.Value
 		videoLayerPriority      int
 		videoLayerExplicit      bool
+		videoLayerFloor         int
 
 		// Protects AudioTrack, AudioTimestamp, AudioPacketsWritten, AudioSequenceNumber
 		AudioLock           sync.RWMutex
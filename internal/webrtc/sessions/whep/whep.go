@@ -15,13 +15,15 @@ func CreateNewWHEP(
 	audioTrack *codecs.TrackMultiCodec,
 	videoTrack *codecs.TrackMultiCodec,
 	peerConnection *webrtc.PeerConnection,
-	pliSender func(),
+	pliSender func(layer string),
 ) (w *WHEPSession) {
 	slog.Debug("WHEPSession.CreateNewWHEP", "whepSessionID", whepSessionID)
 
 	w = &WHEPSession{
 		SessionID:               whepSessionID,
 		StreamKey:               streamKey,
+		Mode:                    getMode(audioTrack, videoTrack),
+		Transport:               TransportWebRTC,
 		AudioTrack:              audioTrack,
 		VideoTrack:              videoTrack,
 		AudioTimestamp:          5000,
@@ -29,29 +31,58 @@ func CreateNewWHEP(
 		PeerConnection:          peerConnection,
 		pliSender:               pliSender,
 		videoBitrateWindowStart: time.Now(),
+		sendQueue:               make(chan queuedPacket, getSendQueueSize()),
+		sendQueueDone:           make(chan struct{}),
+		slowConsumerPolicy:      getSlowConsumerPolicy(),
 	}
 
 	w.AudioLayerCurrent.Store("")
 	w.VideoLayerCurrent.Store("")
 	w.IsWaitingForKeyframe.Store(true)
 	w.IsSessionClosed.Store(false)
+
+	go w.drainSendQueue()
 	return w
 }
 
+// Returns true if the viewer negotiated an audio track
+func (w *WHEPSession) ReceivesAudio() bool {
+	return w.Mode != ModeVideoOnly
+}
+
+// Returns true if the viewer negotiated a video track
+func (w *WHEPSession) ReceivesVideo() bool {
+	return w.Mode != ModeAudioOnly
+}
+
+func getMode(audioTrack *codecs.TrackMultiCodec, videoTrack *codecs.TrackMultiCodec) string {
+	switch {
+	case audioTrack != nil && videoTrack == nil:
+		return ModeAudioOnly
+	case audioTrack == nil && videoTrack != nil:
+		return ModeVideoOnly
+	default:
+		return ModeAudioVideo
+	}
+}
+
 // Closes down the WHEP session completely
 func (w *WHEPSession) Close() {
 	// Close WHEP channels
 	w.SessionClose.Do(func() {
 		slog.Debug("WHEPSession.Close")
 		w.IsSessionClosed.Store(true)
-
-		// Close PeerConnection
-		slog.Debug("WHEPSession.Close.PeerConnection.GracefulClose")
-		err := w.PeerConnection.Close()
-		if err != nil {
-			slog.Error("WHEPSession.Close.PeerConnection.Error", "err", err)
+		close(w.sendQueueDone)
+
+		// Close PeerConnection, viewers over a WebSocket or WebTransport have none
+		if w.PeerConnection != nil {
+			slog.Debug("WHEPSession.Close.PeerConnection.GracefulClose")
+			err := w.PeerConnection.Close()
+			if err != nil {
+				slog.Error("WHEPSession.Close.PeerConnection.Error", "err", err)
+			}
+			slog.Debug("WHEPSession.Close.PeerConnection.GracefulClose.Completed")
 		}
-		slog.Debug("WHEPSession.Close.PeerConnection.GracefulClose.Completed")
 
 		// Empty tracks
 		w.AudioLock.Lock()
@@ -69,6 +100,11 @@ func (w *WHEPSession) Close() {
 	})
 }
 
+// Closed once the session is closed
+func (w *WHEPSession) Done() <-chan struct{} {
+	return w.sendQueueDone
+}
+
 func (w *WHEPSession) SetOnClose(onClose func(string)) {
 	w.onClose = onClose
 }
@@ -83,7 +119,12 @@ func (w *WHEPSession) GetWHEPSessionStatus() (state SessionState) {
 	currentVideoLayer := w.VideoLayerCurrent.Load().(string)
 
 	state = SessionState{
-		ID: w.SessionID,
+		ID:        w.SessionID,
+		Mode:      w.Mode,
+		Transport: w.Transport,
+
+		AudioPaused: w.audioPaused.Load(),
+		VideoPaused: w.videoPaused.Load(),
 
 		AudioLayerCurrent:   currentAudioLayer,
 		AudioTimestamp:      w.AudioTimestamp,
@@ -96,6 +137,12 @@ func (w *WHEPSession) GetWHEPSessionStatus() (state SessionState) {
 		VideoPacketsWritten: w.VideoPacketsWritten,
 		VideoPacketsDropped: w.VideoPacketsDropped.Load(),
 		VideoSequenceNumber: uint64(w.VideoSequenceNumber),
+
+		KeyframeRequests: w.KeyframeRequests.Load(),
+
+		QueueDepth:    len(w.sendQueue),
+		QueueCapacity: cap(w.sendQueue),
+		QueueDropped:  w.QueueDropped.Load(),
 	}
 
 	w.VideoLock.Unlock()
@@ -120,18 +167,26 @@ func (w *WHEPSession) SetVideoLayer(encodingID string) {
 	w.VideoLayerCurrent.Store(encodingID)
 	w.videoLayerPriority = 0
 	w.videoLayerExplicit = encodingID != ""
+	w.videoLayerFloor = 0
 	w.VideoLock.Unlock()
 
 	w.IsWaitingForKeyframe.Store(true)
 	w.SendPLI()
 }
 
+// Request a keyframe of the current video layer
 func (w *WHEPSession) SendPLI() {
+	currentLayer, _ := w.VideoLayerCurrent.Load().(string)
+	w.sendPLIForLayer(currentLayer)
+}
+
+func (w *WHEPSession) sendPLIForLayer(layer string) {
 	if w.IsSessionClosed.Load() {
 		return
 	}
 
-	w.pliSender()
+	w.KeyframeRequests.Add(1)
+	w.pliSender(layer)
 }
 
 // Reset per-publisher delivery state when a new WHIP publisher connects.
@@ -143,6 +198,7 @@ func (w *WHEPSession) ResetForNewPublisher() {
 	w.VideoLayerCurrent.Store("")
 	w.videoLayerPriority = 0
 	w.videoLayerExplicit = false
+	w.videoLayerFloor = 0
 	w.IsWaitingForKeyframe.Store(true)
 }
 
@@ -185,6 +241,19 @@ func (w *WHEPSession) GetVideoLayerOrDefault(defaultLayer string, defaultPriorit
 		return currentLayer
 	}
 
+	// Layers above the floor set by a downgrade are skipped, the current layer is
+	// kept until a layer below the floor is available.
+	if defaultPriority < w.videoLayerFloor {
+		return currentLayer
+	}
+
+	if w.videoLayerPriority < w.videoLayerFloor {
+		w.VideoLayerCurrent.Store(defaultLayer)
+		w.videoLayerPriority = defaultPriority
+		w.IsWaitingForKeyframe.Store(true)
+		return defaultLayer
+	}
+
 	// Lower numeric priority value means a better simulcast layer.
 	if w.videoLayerPriority == 0 || defaultPriority < w.videoLayerPriority {
 		w.VideoLayerCurrent.Store(defaultLayer)
@@ -195,3 +264,50 @@ func (w *WHEPSession) GetVideoLayerOrDefault(defaultLayer string, defaultPriorit
 
 	return currentLayer
 }
+
+// Prevents automatic layer selection from using the current layer or any better one
+func (w *WHEPSession) downgradeVideoLayer() {
+	w.VideoLock.Lock()
+	defer w.VideoLock.Unlock()
+
+	if w.videoLayerExplicit || w.videoLayerPriority == 0 || w.videoLayerFloor > w.videoLayerPriority {
+		return
+	}
+
+	w.videoLayerFloor = w.videoLayerPriority + 1
+	slog.Info("WHEPSession.DowngradeVideoLayer", "id", w.SessionID, "layer", w.VideoLayerCurrent.Load(), "floor", w.videoLayerFloor)
+}
+
+// Returns the video layer the viewer wants out of the provided layers and their priorities, empty if it wants no video.
+// Viewers selecting layers automatically want the best layer not excluded by a downgrade.
+func (w *WHEPSession) GetDemandedVideoLayer(layers map[string]int) string {
+	if !w.ReceivesVideo() || w.videoPaused.Load() {
+		return ""
+	}
+
+	w.VideoLock.Lock()
+	defer w.VideoLock.Unlock()
+
+	currentLayer, _ := w.VideoLayerCurrent.Load().(string)
+	if w.videoLayerExplicit {
+		return currentLayer
+	}
+
+	demandedLayer, demandedPriority := "", 0
+	for layer, priority := range layers {
+		if priority < w.videoLayerFloor {
+			continue
+		}
+
+		if demandedLayer == "" || priority < demandedPriority {
+			demandedLayer, demandedPriority = layer, priority
+		}
+	}
+
+	// The current layer is kept while no layer below the floor is available
+	if demandedLayer == "" {
+		return currentLayer
+	}
+
+	return demandedLayer
+}
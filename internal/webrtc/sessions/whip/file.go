@@ -0,0 +1,467 @@
+package whip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/h264reader"
+	"github.com/pion/webrtc/v4/pkg/media/ivfreader"
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+
+	pionCodecs "github.com/pion/rtp/codecs"
+)
+
+const (
+	fileH264FrameDuration = time.Second / 30
+	fileIdleTimeout       = 30 * time.Second
+	filePacketMTU         = 1200
+	fileVideoClockRate    = 90000
+	fileAudioClockRate    = 48000
+)
+
+const (
+	oggPageSignature        = "OggS"
+	oggPageHeaderSize       = 27
+	oggPageHeaderTypeOffset = 5
+	oggPageSegmentsOffset   = 26
+	oggPageContinued        = 0x01
+)
+
+var (
+	errUnsupportedMediaFile = errors.New("unsupported media file, expected .ivf or .h264")
+	errUnsupportedAudioFile = errors.New("unsupported audio file, expected Ogg/Opus")
+	errInvalidOggPage       = errors.New("invalid Ogg page")
+)
+
+type fileFrameReader interface {
+	// Returns the next frame and how long it should be displayed. Zero duration frames share
+	// the timestamp of the following frame.
+	nextFrame() (frame []byte, duration time.Duration, err error)
+}
+
+// Create a host that publishes a looping pre-encoded media file instead of a WebRTC publisher.
+// Video is read from an .ivf (VP8, VP9, AV1) or Annex-B .h264 file, audio from an Ogg/Opus
+// file next to it with the same name and an .ogg extension.
+func CreateFileSession(mediaPath string) (*WHIPSession, error) {
+	if _, err := getVideoFileCodec(mediaPath); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(mediaPath); err != nil {
+		return nil, err
+	}
+
+	w := &WHIPSession{
+		ID:          uuid.New().String(),
+		AudioTracks: make(map[string]*AudioTrack),
+		VideoTracks: make(map[string]*VideoTrack),
+	}
+	w.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
+
+	return w, nil
+}
+
+// Start looping the media file. Playback stops when the host is removed, or after it has had no viewers for a while.
+func (w *WHIPSession) StartFilePlayback(mediaPath string, streamKey string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancelFilePlayback = cancel
+
+	go w.fileVideoWriter(ctx, mediaPath, streamKey)
+
+	audioPath := strings.TrimSuffix(mediaPath, filepath.Ext(mediaPath)) + ".ogg"
+	if _, err := os.Stat(audioPath); err == nil {
+		go w.fileAudioWriter(ctx, audioPath, streamKey)
+	}
+
+	go w.fileIdleWatcher(ctx)
+}
+
+func (w *WHIPSession) stopFilePlayback() {
+	if w.cancelFilePlayback != nil {
+		w.cancelFilePlayback()
+	}
+}
+
+func (w *WHIPSession) fileIdleWatcher(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastViewer := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if len(w.getWHEPSessionsSnapshot()) != 0 {
+				lastViewer = now
+			} else if now.Sub(lastViewer) > fileIdleTimeout {
+				slog.Info("WHIPSession.FilePlayback: No viewers, stopping", "id", w.ID)
+				w.stopFilePlayback()
+				w.notifyClosed()
+				return
+			}
+		}
+	}
+}
+
+func (w *WHIPSession) fileVideoWriter(ctx context.Context, mediaPath string, streamKey string) {
+	codec, _ := getVideoFileCodec(mediaPath)
+	track, err := w.addVideoTrack(codecs.VideoTrackLabelDefault, streamKey, codec)
+	if err != nil {
+		slog.Error("WHIPSession.FileVideoWriter.AddTrack.Error", "err", err)
+		return
+	}
+	track.Priority = 1
+
+	var (
+		payloader    rtp.Payloader
+		depacketizer rtp.Depacketizer
+	)
+	switch codec {
+	case codecs.VideoTrackCodecH264:
+		payloader, depacketizer = &pionCodecs.H264Payloader{}, &pionCodecs.H264Packet{}
+	case codecs.VideoTrackCodecVP8:
+		payloader = &pionCodecs.VP8Payloader{}
+	case codecs.VideoTrackCodecVP9:
+		payloader = &pionCodecs.VP9Payloader{}
+	case codecs.VideoTrackCodecAV1:
+		payloader = &pionCodecs.AV1Payloader{}
+	}
+
+	packetizer := rtp.NewPacketizer(filePacketMTU, 0, 0, payloader, rtp.NewRandomSequencer(), fileVideoClockRate)
+
+	// Packets of a frame share its timestamp, the frame duration is sent with the first packet of the next frame
+	var differ packetDiffer
+	w.loopMediaFile(ctx, mediaPath, openVideoFile, func(frame []byte, duration time.Duration) {
+		samples := uint32(duration.Seconds() * fileVideoClockRate)
+		for _, packet := range packetizer.Packetize(frame, samples) {
+			timeDiff, sequenceDiff := differ.next(packet)
+			isKeyframe := isPacketKeyframe(packet, codec, depacketizer)
+			if isKeyframe {
+				track.LastKeyFrame.Store(time.Now())
+			}
+
+			track.PacketsReceived.Add(1)
+			track.LastReceived.Store(time.Now())
+
+			for _, whepSession := range w.getWHEPSessionsSnapshot() {
+				if !whepSession.ReceivesVideo() || whepSession.GetVideoLayerOrDefault(track.Rid, track.Priority) != track.Rid {
+					continue
+				}
+
+				whepSession.SendVideoPacket(codecs.TrackPacket{
+					Layer:        track.Rid,
+					Packet:       packet,
+					Codec:        codec,
+					IsKeyframe:   isKeyframe,
+					TimeDiff:     timeDiff,
+					SequenceDiff: sequenceDiff,
+				})
+			}
+		}
+	})
+}
+
+func (w *WHIPSession) fileAudioWriter(ctx context.Context, mediaPath string, streamKey string) {
+	codec := codecs.GetAudioTrackCodec(webrtc.MimeTypeOpus)
+	track, err := w.addAudioTrack(codecs.AudioTrackLabelDefault, streamKey, codec)
+	if err != nil {
+		slog.Error("WHIPSession.FileAudioWriter.AddTrack.Error", "err", err)
+		return
+	}
+
+	packetizer := rtp.NewPacketizer(filePacketMTU, 0, 0, &pionCodecs.OpusPayloader{}, rtp.NewRandomSequencer(), fileAudioClockRate)
+
+	var differ packetDiffer
+	w.loopMediaFile(ctx, mediaPath, openAudioFile, func(frame []byte, duration time.Duration) {
+		samples := uint32(duration.Seconds() * fileAudioClockRate)
+		for _, packet := range packetizer.Packetize(frame, samples) {
+			timeDiff, sequenceDiff := differ.next(packet)
+			track.PacketsReceived.Add(1)
+			track.LastReceived.Store(time.Now())
+
+			for _, whepSession := range w.getWHEPSessionsSnapshot() {
+				if !whepSession.ReceivesAudio() {
+					continue
+				}
+
+				whepSession.SendAudioPacket(codecs.TrackPacket{
+					Layer:        track.Rid,
+					Packet:       packet,
+					Codec:        codec,
+					TimeDiff:     timeDiff,
+					SequenceDiff: sequenceDiff,
+				})
+			}
+		}
+	})
+}
+
+// Reads the media file frame by frame in real time, and starts over when reaching the end
+func (w *WHIPSession) loopMediaFile(
+	ctx context.Context,
+	mediaPath string,
+	open func(io.Reader, string) (fileFrameReader, error),
+	writeFrame func(frame []byte, duration time.Duration),
+) {
+	for ctx.Err() == nil {
+		file, err := os.Open(mediaPath)
+		if err != nil {
+			slog.Error("WHIPSession.LoopMediaFile.Open", "mediaPath", mediaPath, "err", err)
+			return
+		}
+
+		reader, err := open(file, mediaPath)
+		if err != nil {
+			slog.Error("WHIPSession.LoopMediaFile.Reader", "mediaPath", mediaPath, "err", err)
+			_ = file.Close()
+			return
+		}
+
+		framesRead := 0
+		nextFrameAt := time.Now()
+		for ctx.Err() == nil {
+			frame, duration, err := reader.nextFrame()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					slog.Error("WHIPSession.LoopMediaFile.Read", "mediaPath", mediaPath, "err", err)
+				}
+				break
+			}
+
+			framesRead++
+			writeFrame(frame, duration)
+
+			if duration != 0 {
+				nextFrameAt = nextFrameAt.Add(duration)
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Until(nextFrameAt)):
+				}
+			}
+		}
+
+		if err := file.Close(); err != nil {
+			slog.Error("WHIPSession.LoopMediaFile.Close", "mediaPath", mediaPath, "err", err)
+		}
+
+		if framesRead == 0 {
+			slog.Error("WHIPSession.LoopMediaFile: No frames found", "mediaPath", mediaPath)
+			return
+		}
+	}
+}
+
+func getVideoFileCodec(mediaPath string) (codecs.TrackCodeType, error) {
+	switch strings.ToLower(filepath.Ext(mediaPath)) {
+	case ".h264":
+		return codecs.VideoTrackCodecH264, nil
+	case ".ivf":
+		file, err := os.Open(mediaPath)
+		if err != nil {
+			return 0, err
+		}
+		defer func() { _ = file.Close() }()
+
+		_, header, err := ivfreader.NewWith(file)
+		if err != nil {
+			return 0, err
+		}
+
+		switch header.FourCC {
+		case "VP80":
+			return codecs.VideoTrackCodecVP8, nil
+		case "VP90":
+			return codecs.VideoTrackCodecVP9, nil
+		case "AV01":
+			return codecs.VideoTrackCodecAV1, nil
+		}
+
+		return 0, fmt.Errorf("unsupported ivf codec %s", header.FourCC)
+	}
+
+	return 0, errUnsupportedMediaFile
+}
+
+type ivfFrameReader struct {
+	reader        *ivfreader.IVFReader
+	frameDuration time.Duration
+}
+
+type h264FrameReader struct {
+	reader *h264reader.H264Reader
+}
+
+// Reads the Opus packets of an Ogg file. A page holds several packets, and a packet may continue on the next page.
+type oggFrameReader struct {
+	reader  io.Reader
+	packets [][]byte
+
+	// Packet continued on the next page
+	partial []byte
+}
+
+func openVideoFile(file io.Reader, mediaPath string) (fileFrameReader, error) {
+	if strings.EqualFold(filepath.Ext(mediaPath), ".h264") {
+		reader, err := h264reader.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+
+		return &h264FrameReader{reader: reader}, nil
+	}
+
+	reader, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ivfFrameReader{
+		reader:        reader,
+		frameDuration: time.Second * time.Duration(header.TimebaseNumerator) / time.Duration(max(header.TimebaseDenominator, 1)),
+	}, nil
+}
+
+func openAudioFile(file io.Reader, _ string) (fileFrameReader, error) {
+	reader := &oggFrameReader{reader: bufio.NewReader(file)}
+	if err := reader.readPage(); err != nil {
+		return nil, err
+	}
+
+	// The first packet identifies the stream, the OpusTags packet that follows it is skipped when read
+	if len(reader.packets) == 0 || !bytes.HasPrefix(reader.packets[0], []byte(oggreader.HeaderOpusID)) {
+		return nil, errUnsupportedAudioFile
+	}
+	reader.packets = reader.packets[1:]
+
+	return reader, nil
+}
+
+func (r *ivfFrameReader) nextFrame() ([]byte, time.Duration, error) {
+	frame, _, err := r.reader.ParseNextFrame()
+	return frame, r.frameDuration, err
+}
+
+func (r *h264FrameReader) nextFrame() ([]byte, time.Duration, error) {
+	nal, err := r.reader.NextNAL()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Parameter sets and SEI share the timestamp of the picture that follows them
+	if nal.UnitType != h264reader.NalUnitTypeCodedSliceNonIdr && nal.UnitType != h264reader.NalUnitTypeCodedSliceIdr {
+		return nal.Data, 0, nil
+	}
+
+	return nal.Data, fileH264FrameDuration, nil
+}
+
+func (r *oggFrameReader) nextFrame() ([]byte, time.Duration, error) {
+	for {
+		for len(r.packets) == 0 {
+			if err := r.readPage(); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		packet := r.packets[0]
+		r.packets = r.packets[1:]
+
+		if len(packet) == 0 || bytes.HasPrefix(packet, []byte(oggreader.HeaderOpusTags)) {
+			continue
+		}
+
+		return packet, getOpusPacketDuration(packet), nil
+	}
+}
+
+// Read the next page and split its payload into packets by the lacing values of its segment table
+func (r *oggFrameReader) readPage() error {
+	header := make([]byte, oggPageHeaderSize)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		return err
+	}
+
+	if string(header[:4]) != oggPageSignature {
+		return errInvalidOggPage
+	}
+
+	lacingValues := make([]byte, header[oggPageSegmentsOffset])
+	if _, err := io.ReadFull(r.reader, lacingValues); err != nil {
+		return err
+	}
+
+	payloadSize := 0
+	for _, lacingValue := range lacingValues {
+		payloadSize += int(lacingValue)
+	}
+
+	payload := make([]byte, payloadSize)
+	if _, err := io.ReadFull(r.reader, payload); err != nil {
+		return err
+	}
+
+	// A packet left over from a page that is not continued here is incomplete
+	if header[oggPageHeaderTypeOffset]&oggPageContinued == 0 {
+		r.partial = nil
+	}
+
+	// A packet ends with a lacing value below 255, one ending the page with 255 continues on the next page
+	offset := 0
+	for _, lacingValue := range lacingValues {
+		r.partial = append(r.partial, payload[offset:offset+int(lacingValue)]...)
+		offset += int(lacingValue)
+
+		if lacingValue < 255 {
+			r.packets = append(r.packets, r.partial)
+			r.partial = nil
+		}
+	}
+
+	return nil
+}
+
+// Get the duration of an Opus packet from its TOC byte, see RFC 6716 section 3.1
+func getOpusPacketDuration(packet []byte) time.Duration {
+	config := packet[0] >> 3
+
+	var frameDuration time.Duration
+	switch {
+	case config < 12:
+		// SILK
+		frameDuration = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16:
+		// Hybrid
+		frameDuration = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default:
+		// CELT
+		frameDuration = []time.Duration{2500, 5000, 10000, 20000}[config%4] * time.Microsecond
+	}
+
+	frameCount := 1
+	switch packet[0] & 0x3 {
+	case 1, 2:
+		frameCount = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0
+		}
+		frameCount = int(packet[1] & 0x3f)
+	}
+
+	return frameDuration * time.Duration(frameCount)
+}
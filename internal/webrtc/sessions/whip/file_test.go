@@ -0,0 +1,85 @@
+package whip
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	pionCodecs "github.com/pion/rtp/codecs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFramePacketsShareTimestamp(t *testing.T) {
+	packetizer := rtp.NewPacketizer(filePacketMTU, 0, 0, &pionCodecs.VP8Payloader{}, rtp.NewFixedSequencer(0), fileVideoClockRate)
+	frame := make([]byte, filePacketMTU*2)
+
+	var differ packetDiffer
+	timeDiffs, sequenceDiffs := []int64{}, []int{}
+	for range 2 {
+		for _, packet := range packetizer.Packetize(frame, 3000) {
+			timeDiff, sequenceDiff := differ.next(packet)
+			timeDiffs = append(timeDiffs, timeDiff)
+			sequenceDiffs = append(sequenceDiffs, sequenceDiff)
+		}
+	}
+
+	// The frame duration is only added by the first packet of the next frame
+	assert.Equal(t, []int64{0, 0, 0, 3000, 0, 0}, timeDiffs)
+	assert.Equal(t, []int{0, 1, 1, 1, 1, 1}, sequenceDiffs)
+}
+
+// Build an Ogg page with a lacing value per segment size
+func newOggPage(headerType byte, segments []int, payload []byte) []byte {
+	page := append([]byte(oggPageSignature), 0, headerType)
+	page = append(page, make([]byte, oggPageHeaderSize-len(page)-1)...)
+	page = append(page, byte(len(segments)))
+	for _, segment := range segments {
+		page = append(page, byte(segment))
+	}
+
+	return append(page, payload...)
+}
+
+// Build an Opus packet of 20ms CELT frames with the provided size
+func newOpusPacket(size int, fill byte) []byte {
+	packet := bytes.Repeat([]byte{fill}, size)
+	packet[0] = 0xfc
+	return packet
+}
+
+func TestOggFrameReaderSplitsPages(t *testing.T) {
+	opusHead := append([]byte("OpusHead"), make([]byte, 11)...)
+	opusTags := append([]byte("OpusTags"), make([]byte, 8)...)
+	first, second, third := newOpusPacket(10, 1), newOpusPacket(300, 2), newOpusPacket(260, 3)
+
+	// The third packet starts on the page with the first two and continues on the next page
+	file := newOggPage(0x02, []int{len(opusHead)}, opusHead)
+	file = append(file, newOggPage(0, []int{len(opusTags)}, opusTags)...)
+	file = append(file, newOggPage(0, []int{10, 255, 45, 255}, slices.Concat(first, second, third[:255]))...)
+	file = append(file, newOggPage(oggPageContinued, []int{5}, third[255:])...)
+
+	reader, err := openAudioFile(bytes.NewReader(file), "slate.ogg")
+	require.NoError(t, err)
+
+	for _, expected := range [][]byte{first, second, third} {
+		frame, duration, err := reader.nextFrame()
+		require.NoError(t, err)
+		assert.Equal(t, expected, frame)
+		assert.Equal(t, 20*time.Millisecond, duration)
+	}
+
+	_, _, err = reader.nextFrame()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestOpusPacketDuration(t *testing.T) {
+	// SILK 60ms, hybrid 10ms, two CELT 2.5ms frames, and three CELT 20ms frames
+	assert.Equal(t, 60*time.Millisecond, getOpusPacketDuration([]byte{3 << 3}))
+	assert.Equal(t, 10*time.Millisecond, getOpusPacketDuration([]byte{12 << 3}))
+	assert.Equal(t, 5*time.Millisecond, getOpusPacketDuration([]byte{16<<3 | 1}))
+	assert.Equal(t, 60*time.Millisecond, getOpusPacketDuration([]byte{31<<3 | 3, 3}))
+}
@@ -0,0 +1,131 @@
+package whip
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type (
+	layerDemand struct {
+		// Protects changed
+		lock    sync.Mutex
+		changed chan struct{}
+
+		cancel context.CancelFunc
+	}
+
+	layerDemandResponse struct {
+		Layers []simulcastLayerResponse `json:"layers"`
+	}
+)
+
+// Track which video layers have viewers. A layer without viewers for idleTimeout is marked paused, so the
+// publisher can stop encoding it, and resumed as soon as a viewer wants it again.
+func (w *WHIPSession) StartLayerDemandWatch(idleTimeout time.Duration) {
+	if idleTimeout <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.layerDemand.cancel = cancel
+
+	go w.watchLayerDemand(ctx, idleTimeout)
+}
+
+func (w *WHIPSession) stopLayerDemandWatch() {
+	if w.layerDemand.cancel != nil {
+		w.layerDemand.cancel()
+	}
+}
+
+// Returns a channel that is closed on the next change of a layer's paused state
+func (w *WHIPSession) LayerDemandChanged() <-chan struct{} {
+	w.layerDemand.lock.Lock()
+	defer w.layerDemand.lock.Unlock()
+
+	if w.layerDemand.changed == nil {
+		w.layerDemand.changed = make(chan struct{})
+	}
+
+	return w.layerDemand.changed
+}
+
+// Get SSE String with the viewers of each video layer and if the publisher may pause it, empty if demand is not watched
+func (w *WHIPSession) GetLayerDemandEvent() string {
+	if w.layerDemand.cancel == nil {
+		return ""
+	}
+
+	jsonResult, err := json.Marshal(layerDemandResponse{Layers: w.getVideoLayerResponses()})
+	if err != nil {
+		slog.Error("WHIPSession.GetLayerDemandEvent Error", "err", err)
+		return ""
+	}
+
+	return "event: layerDemand\ndata: " + string(jsonResult) + "\n\n"
+}
+
+func (w *WHIPSession) watchLayerDemand(ctx context.Context, idleTimeout time.Duration) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastDemanded := map[string]time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if w.updateLayerDemand(now, idleTimeout, lastDemanded) {
+				w.notifyLayerDemandChanged()
+			}
+		}
+	}
+}
+
+// Count the viewers of each video layer and pause or resume layers.
+// Returns true if a layer was paused or resumed.
+func (w *WHIPSession) updateLayerDemand(now time.Time, idleTimeout time.Duration, lastDemanded map[string]time.Time) (isChanged bool) {
+	w.TracksLock.RLock()
+	defer w.TracksLock.RUnlock()
+
+	layers := make(map[string]int, len(w.VideoTracks))
+	for rid, track := range w.VideoTracks {
+		layers[rid] = track.Priority
+	}
+
+	viewers := make(map[string]int32, len(w.VideoTracks))
+	for _, whepSession := range w.getWHEPSessionsSnapshot() {
+		if layer := whepSession.GetDemandedVideoLayer(layers); layer != "" {
+			viewers[layer]++
+		}
+	}
+
+	for rid, track := range w.VideoTracks {
+		track.Viewers.Store(viewers[rid])
+
+		if _, ok := lastDemanded[rid]; !ok || viewers[rid] > 0 {
+			lastDemanded[rid] = now
+		}
+
+		isPaused := now.Sub(lastDemanded[rid]) >= idleTimeout
+		if track.IsPaused.Swap(isPaused) != isPaused {
+			slog.Info("WHIPSession.LayerDemand", "id", w.ID, "layer", rid, "paused", isPaused)
+			isChanged = true
+		}
+	}
+
+	return isChanged
+}
+
+func (w *WHIPSession) notifyLayerDemandChanged() {
+	w.layerDemand.lock.Lock()
+	defer w.layerDemand.lock.Unlock()
+
+	if w.layerDemand.changed != nil {
+		close(w.layerDemand.changed)
+	}
+	w.layerDemand.changed = make(chan struct{})
+}
@@ -0,0 +1,40 @@
+package whip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayerDemand(t *testing.T) {
+	audioTrack, videoTrack := codecs.GetDefaultTracks("stream")
+	viewer := whep.CreateNewWHEP("viewer", "stream", audioTrack, videoTrack, nil, func(string) {})
+
+	w := &WHIPSession{
+		VideoTracks: map[string]*VideoTrack{
+			"high": {Rid: "high", Priority: 1},
+			"low":  {Rid: "low", Priority: 2},
+		},
+	}
+	w.WHEPSessionsSnapshot.Store(map[string]*whep.WHEPSession{viewer.SessionID: viewer})
+
+	start := time.Now()
+	lastDemanded := map[string]time.Time{}
+	assert.False(t, w.updateLayerDemand(start, 10*time.Second, lastDemanded))
+	assert.Equal(t, int32(1), w.VideoTracks["high"].Viewers.Load())
+	assert.Equal(t, int32(0), w.VideoTracks["low"].Viewers.Load())
+
+	// Unused layers are paused after the idle timeout
+	assert.True(t, w.updateLayerDemand(start.Add(10*time.Second), 10*time.Second, lastDemanded))
+	assert.False(t, w.VideoTracks["high"].IsPaused.Load())
+	assert.True(t, w.VideoTracks["low"].IsPaused.Load())
+
+	// And resumed once a viewer selects them
+	viewer.SetVideoLayer("low")
+	assert.True(t, w.updateLayerDemand(start.Add(11*time.Second), 10*time.Second, lastDemanded))
+	assert.False(t, w.VideoTracks["low"].IsPaused.Load())
+	assert.Equal(t, int32(0), w.VideoTracks["high"].Viewers.Load())
+}
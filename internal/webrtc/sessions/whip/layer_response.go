@@ -3,5 +3,9 @@ package whip
 type (
 	simulcastLayerResponse struct {
 		EncodingID string `json:"encodingId"`
+
+		// Only set for video layers of publishers that track layer demand
+		Viewers  *int32 `json:"viewers,omitempty"`
+		IsPaused *bool  `json:"isPaused,omitempty"`
 	}
 )
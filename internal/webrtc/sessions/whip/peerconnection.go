@@ -39,6 +39,8 @@ func (w *WHIPSession) AddPeerConnection(peerConnection *webrtc.PeerConnection, s
 
 func (w *WHIPSession) RemovePeerConnection() {
 	slog.Info("WHIPSession.RemovePeerConnection", "id", w.ID)
+	w.stopFilePlayback()
+	w.stopLayerDemandWatch()
 
 	w.PeerConnectionLock.Lock()
 	peerConnection := w.PeerConnection
@@ -56,36 +58,56 @@ func (w *WHIPSession) RemovePeerConnection() {
 	slog.Info("WHIPSession.RemovePeerConnection.Completed", "id", w.ID)
 }
 
+// Request a keyframe on all video layers
 func (w *WHIPSession) SendPLI() {
+	w.SendPLIForLayer("")
+}
+
+// Request a keyframe on the video layer with the provided rid, or all layers when empty.
+// Returns true if a PLI was written to the publisher.
+func (w *WHIPSession) SendPLIForLayer(rid string) bool {
 	w.PeerConnectionLock.RLock()
 	peerConnection := w.PeerConnection
 	w.PeerConnectionLock.RUnlock()
 	if peerConnection == nil {
-		return
+		return false
 	}
 
-	packets := w.getPLIPackets()
+	packets := w.getPLIPackets(rid)
 	if len(packets) == 0 {
-		return
+		return false
 	}
 
 	if err := peerConnection.WriteRTCP(packets); err != nil {
 		slog.Error("WHIPSession.SendPLI.WriteRTCP.Error", "err", err)
+		return false
 	}
+
+	return true
 }
 
-func (w *WHIPSession) getPLIPackets() []rtcp.Packet {
+func (w *WHIPSession) getPLIPackets(rid string) []rtcp.Packet {
 	w.TracksLock.RLock()
 	defer w.TracksLock.RUnlock()
 
+	if track, ok := w.VideoTracks[rid]; ok {
+		return track.getPLIPackets()
+	}
+
 	packets := make([]rtcp.Packet, 0, len(w.VideoTracks))
 	for _, track := range w.VideoTracks {
-		if mediaSSRC := track.MediaSSRC.Load(); mediaSSRC != 0 {
-			packets = append(packets, &rtcp.PictureLossIndication{
-				MediaSSRC: mediaSSRC,
-			})
-		}
+		packets = append(packets, track.getPLIPackets()...)
 	}
 
 	return packets
 }
+
+func (t *VideoTrack) getPLIPackets() []rtcp.Packet {
+	mediaSSRC := t.MediaSSRC.Load()
+	if mediaSSRC == 0 {
+		return nil
+	}
+
+	t.PLIsSent.Add(1)
+	return []rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: mediaSSRC}}
+}
@@ -7,18 +7,11 @@ import (
 
 // Returns all available Video and Audio layers of the provided stream key
 func (w *WHIPSession) GetAvailableLayersEvent() string {
-	videoLayers := []simulcastLayerResponse{}
+	videoLayers := w.getVideoLayerResponses()
 	audioLayers := []simulcastLayerResponse{}
 
 	w.TracksLock.RLock()
 
-	// Add available video layers
-	for track := range w.VideoTracks {
-		videoLayers = append(videoLayers, simulcastLayerResponse{
-			EncodingID: w.VideoTracks[track].Rid,
-		})
-	}
-
 	// Add available audio layers
 	for track := range w.AudioTracks {
 		audioLayers = append(audioLayers, simulcastLayerResponse{
@@ -44,3 +37,23 @@ func (w *WHIPSession) GetAvailableLayersEvent() string {
 
 	return "event: layers\ndata: " + string(jsonResult) + "\n\n"
 }
+
+func (w *WHIPSession) getVideoLayerResponses() []simulcastLayerResponse {
+	w.TracksLock.RLock()
+	defer w.TracksLock.RUnlock()
+
+	isDemandWatched := w.layerDemand.cancel != nil
+	videoLayers := make([]simulcastLayerResponse, 0, len(w.VideoTracks))
+	for _, track := range w.VideoTracks {
+		layer := simulcastLayerResponse{EncodingID: track.Rid}
+		if isDemandWatched {
+			viewers := track.Viewers.Load()
+			isPaused := track.IsPaused.Load()
+			layer.Viewers, layer.IsPaused = &viewers, &isPaused
+		}
+
+		videoLayers = append(videoLayers, layer)
+	}
+
+	return videoLayers
+}
@@ -1,10 +1,12 @@
 package whip
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -16,13 +18,24 @@ type (
 		onClosed           func()
 		PeerConnectionLock sync.RWMutex
 
+		// Server candidates for clients that trickle, nil for hosts without a PeerConnection
+		Candidates *utils.CandidateCollector
+
 		// Protects AudioTrack, VideoTracks
 		TracksLock  sync.RWMutex
 		VideoTracks map[string]*VideoTrack
 		AudioTracks map[string]*AudioTrack
 
+		// Set for stage guests, their media is sent to the viewers' stage tracks of the slot
+		StageSlot int
+
 		// TODO: WHEPSessionsSnapshot should contain serializable state, not runtime references.
 		WHEPSessionsSnapshot atomic.Value
+
+		// Set for hosts publishing a media file instead of a PeerConnection
+		cancelFilePlayback context.CancelFunc
+
+		layerDemand layerDemand
 	}
 
 	VideoTrack struct {
@@ -34,7 +47,12 @@ type (
 		LastReceived    atomic.Value
 		LastKeyFrame    atomic.Value
 		MediaSSRC       atomic.Uint32
+		PLIsSent        atomic.Uint64
 		Track           *codecs.TrackMultiCodec
+
+		// Viewers of the layer and if it had none for the idle timeout, set while layer demand is watched
+		Viewers  atomic.Int32
+		IsPaused atomic.Bool
 	}
 	AudioTrack struct {
 		Rid             string
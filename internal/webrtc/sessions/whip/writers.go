@@ -31,13 +31,22 @@ func (w *WHIPSession) audioWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 		return
 	}
 
-	rtpPkt := &rtp.Packet{}
-	rtpBuf := make([]byte, 1500)
+	var differ packetDiffer
 	for {
-		rtpRead, _, err := remoteTrack.Read(rtpBuf)
+		// Viewers write asynchronously, each packet is read into a pooled buffer they hold until written
+		buffer := codecs.GetPacketBuffer()
+		packet := codecs.TrackPacket{
+			Layer:  id,
+			Packet: &buffer.Packet,
+			Codec:  codec,
+			Buffer: buffer,
+		}
+
+		rtpRead, _, err := remoteTrack.Read(buffer.Data())
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				slog.Info("WHIPSession.AudioWriter.RtpPkt.EndOfStream")
+				packet.Release()
 				return
 			} else {
 				slog.Error("WHIPSession.AudioWriter.RtpPkt.Err", "err", err)
@@ -46,26 +55,28 @@ func (w *WHIPSession) audioWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 
 		track.PacketsReceived.Add(1)
 
-		err = rtpPkt.Unmarshal(rtpBuf[:rtpRead])
+		err = buffer.Unmarshal(rtpRead)
 		if err != nil {
 			slog.Error("WHIPSession.AudioWriter.RtpPkt.Error", "err", err)
+			packet.Release()
 			continue
 		}
 
-		var sessions map[string]*whep.WHEPSession
-		if sessionsAny := w.WHEPSessionsSnapshot.Load(); sessionsAny != nil {
-			sessions = sessionsAny.(map[string]*whep.WHEPSession)
-		}
+		packet.TimeDiff, packet.SequenceDiff = differ.next(packet.Packet)
 
-		packet := codecs.TrackPacket{
-			Layer:  id,
-			Packet: rtpPkt,
-			Codec:  codec,
-		}
+		for _, whepSession := range w.getWHEPSessionsSnapshot() {
+			if !whepSession.ReceivesAudio() {
+				continue
+			}
 
-		for _, whepSession := range sessions {
-			whepSession.SendAudioPacket(packet)
+			if w.StageSlot != 0 {
+				whepSession.SendStageAudioPacket(w.StageSlot, packet)
+			} else {
+				whepSession.SendAudioPacket(packet)
+			}
 		}
+
+		packet.Release()
 	}
 }
 
@@ -103,22 +114,26 @@ func (w *WHIPSession) videoWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 		slog.Error("WHIPSession.VideoWriter.Depacketizer: No depacketizer was found for codec", "codec", codec)
 	}
 
-	lastTimestamp := uint32(0)
-	lastTimestampSet := false
-
-	lastSequenceNumber := uint16(0)
-	lastSequenceNumberSet := false
+	var differ packetDiffer
 
 	bitrateWindowStart := time.Now()
 	bitrateWindowBytes := uint64(0)
 
-	rtpPkt := &rtp.Packet{}
-	pktBuf := make([]byte, 1500)
 	for {
-		rtpRead, _, err := remoteTrack.Read(pktBuf)
+		// Viewers write asynchronously, each packet is read into a pooled buffer they hold until written
+		buffer := codecs.GetPacketBuffer()
+		packet := codecs.TrackPacket{
+			Layer:  id,
+			Packet: &buffer.Packet,
+			Codec:  codec,
+			Buffer: buffer,
+		}
+
+		rtpRead, _, err := remoteTrack.Read(buffer.Data())
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				slog.Info("WHIPSession.VideoWriter.RtpPkt.EndOfStream")
+				packet.Release()
 				w.notifyClosed()
 				return
 			} else {
@@ -127,23 +142,25 @@ func (w *WHIPSession) videoWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 		}
 
 		if rtpRead == 0 {
+			packet.Release()
 			continue
 		}
 
-		err = rtpPkt.Unmarshal(pktBuf[:rtpRead])
+		err = buffer.Unmarshal(rtpRead)
 		if err != nil {
 			slog.Error("WHIPSession.VideoWriter.RtpPkt.Unmarshal", "err", err)
+			packet.Release()
 			continue
 		}
 
-		rtpPkt.Extension = false
-		rtpPkt.Extensions = nil
+		packet.Packet.Extension = false
+		packet.Packet.Extensions = nil
 
 		track.PacketsReceived.Add(1)
 		bitrateWindowBytes += uint64(rtpRead)
 
-		isKeyframe := isPacketKeyframe(rtpPkt, codec, depacketizer)
-		if isKeyframe {
+		packet.IsKeyframe = isPacketKeyframe(packet.Packet, codec, depacketizer)
+		if packet.IsKeyframe {
 			track.LastKeyFrame.Store(time.Now())
 		}
 
@@ -154,49 +171,75 @@ func (w *WHIPSession) videoWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 			bitrateWindowBytes = 0
 		}
 
-		timeDiff := int64(rtpPkt.Timestamp) - int64(lastTimestamp)
-		switch {
-		case !lastTimestampSet:
-			timeDiff = 0
-			lastTimestampSet = true
-		case timeDiff < -(math.MaxUint32 / 10):
-			timeDiff += (math.MaxUint32 + 1)
-		}
+		packet.TimeDiff, packet.SequenceDiff = differ.next(packet.Packet)
 
-		sequenceDiff := int(rtpPkt.SequenceNumber) - int(lastSequenceNumber)
-		switch {
-		case !lastSequenceNumberSet:
-			lastSequenceNumberSet = true
-			sequenceDiff = 0
-		case sequenceDiff < -(math.MaxUint16 / 10):
-			sequenceDiff += (math.MaxUint16 + 1)
-		}
+		w.sendVideoPacket(packet, track)
+		packet.Release()
+	}
+}
 
-		lastTimestamp = rtpPkt.Timestamp
-		lastSequenceNumber = rtpPkt.SequenceNumber
+// Send a video packet to the viewers watching its layer
+func (w *WHIPSession) sendVideoPacket(packet codecs.TrackPacket, track *VideoTrack) {
+	sessions := w.getWHEPSessionsSnapshot()
 
-		var sessions map[string]*whep.WHEPSession
-		if sessionsAny := w.WHEPSessionsSnapshot.Load(); sessionsAny != nil {
-			sessions = sessionsAny.(map[string]*whep.WHEPSession)
+	// Stage guests are sent to viewers without layer selection, only their best layer is used
+	if w.StageSlot != 0 {
+		if packet.Layer != codecs.VideoTrackLabelDefault && track.Priority != 1 {
+			return
 		}
 
 		for _, whepSession := range sessions {
-			if whepSession.GetVideoLayerOrDefault(id, track.Priority) != id {
-				continue
-			}
+			whepSession.SendStageVideoPacket(w.StageSlot, packet)
+		}
+		return
+	}
 
-			whepSession.SendVideoPacket(codecs.TrackPacket{
-				Layer:        id,
-				Packet:       rtpPkt,
-				Codec:        codec,
-				IsKeyframe:   isKeyframe,
-				TimeDiff:     timeDiff,
-				SequenceDiff: sequenceDiff,
-			})
+	for _, whepSession := range sessions {
+		if !whepSession.ReceivesVideo() || whepSession.GetVideoLayerOrDefault(packet.Layer, track.Priority) != packet.Layer {
+			continue
 		}
+
+		whepSession.SendVideoPacket(packet)
 	}
 }
 
+// Tracks the timestamp and sequence number of a track's last packet. Viewers continue their own
+// timestamps and sequence numbers with the differences, so they stay continuous when switching sources.
+type packetDiffer struct {
+	lastTimestamp      uint32
+	lastSequenceNumber uint16
+	isSet              bool
+}
+
+// Get the differences to the previous packet, zero for the first packet
+func (d *packetDiffer) next(packet *rtp.Packet) (timeDiff int64, sequenceDiff int) {
+	if d.isSet {
+		timeDiff = int64(packet.Timestamp) - int64(d.lastTimestamp)
+		if timeDiff < -(math.MaxUint32 / 10) {
+			timeDiff += (math.MaxUint32 + 1)
+		}
+
+		sequenceDiff = int(packet.SequenceNumber) - int(d.lastSequenceNumber)
+		if sequenceDiff < -(math.MaxUint16 / 10) {
+			sequenceDiff += (math.MaxUint16 + 1)
+		}
+	}
+
+	d.lastTimestamp = packet.Timestamp
+	d.lastSequenceNumber = packet.SequenceNumber
+	d.isSet = true
+
+	return timeDiff, sequenceDiff
+}
+
+func (w *WHIPSession) getWHEPSessionsSnapshot() map[string]*whep.WHEPSession {
+	if sessionsAny := w.WHEPSessionsSnapshot.Load(); sessionsAny != nil {
+		return sessionsAny.(map[string]*whep.WHEPSession)
+	}
+
+	return nil
+}
+
 const (
 	naluTypeBitmask = 0x1f
 
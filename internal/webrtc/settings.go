@@ -1,6 +1,7 @@
 package webrtc
 
 import (
+	"fmt"
 	"net"
 	"strings"
 
@@ -13,7 +14,6 @@ import (
 	"strconv"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
-	"github.com/glimesh/broadcast-box/internal/ip"
 )
 
 // This is the maximum inbound message size for every data channel on a peer connection.
@@ -21,15 +21,19 @@ import (
 // Source: https://webrtc.googlesource.com/src/+/refs/heads/main/api/sctp_transport_interface.h#156
 const maxDataChannelMessageBytes uint32 = 256 * 1024 + 1
 
-func getSettingEngine(isWHIP bool, tcpMuxCache map[string]ice.TCPMux, udpMuxCache map[int]*ice.MultiUDPMuxDefault) (settingEngine webrtc.SettingEngine) {
+// Get the setting engine of a WHIP or WHEP API, using the UDP mux of shard when UDP traffic is multiplexed.
+// Only the NAT rewrite rules depend on the discovered public IP, their errors are returned.
+func getSettingEngine(isWHIP bool, shard int, tcpMuxCache map[string]ice.TCPMux, udpMuxCache map[int]*udpMuxShard) (settingEngine webrtc.SettingEngine, err error) {
 	var (
 		udpMuxOpts []ice.UDPMuxFromPortOption
 	)
 
 	setupNetworkTypes()
-	setupNAT(&settingEngine)
-	setupInterfaceFilter(&settingEngine, &udpMuxOpts)
-	setupUDPMux(&settingEngine, isWHIP, udpMuxCache, udpMuxOpts)
+	if err = setupNAT(&settingEngine); err != nil {
+		return settingEngine, err
+	}
+	setupCandidatePolicy(&settingEngine, &udpMuxOpts)
+	setupUDPMux(&settingEngine, isWHIP, shard, udpMuxCache, udpMuxOpts)
 	setupTCPMux(&settingEngine, tcpMuxCache)
 
 	settingEngine.SetDTLSEllipticCurves(elliptic.X25519, elliptic.P384, elliptic.P256)
@@ -39,7 +43,7 @@ func getSettingEngine(isWHIP bool, tcpMuxCache map[string]ice.TCPMux, udpMuxCach
 	settingEngine.SetIncludeLoopbackCandidate(os.Getenv(environment.IncludeLoopbackCandidate) != "")
 	settingEngine.SetSCTPMaxMessageSize(maxDataChannelMessageBytes)
 
-	return
+	return settingEngine, nil
 }
 
 func setupNetworkTypes() []webrtc.NetworkType {
@@ -91,23 +95,10 @@ func setupTCPMux(settingEngine *webrtc.SettingEngine, tcpMuxCache map[string]ice
 	}
 }
 
-func setupUDPMux(settingEngine *webrtc.SettingEngine, isWHIP bool, udpMuxCache map[int]*ice.MultiUDPMuxDefault, udpMuxOpts []ice.UDPMuxFromPortOption) {
-	// Use UDP Mux port if set
-	if udpMuxPort := getUDPMuxPort(isWHIP); udpMuxPort != 0 {
-		setUDPMuxPort(isWHIP, udpMuxPort, udpMuxCache, udpMuxOpts, settingEngine)
-	}
-}
-
-func setupInterfaceFilter(settingEngine *webrtc.SettingEngine, muxOpts *[]ice.UDPMuxFromPortOption) {
-	filter := os.Getenv(environment.InterfaceFilter)
-
-	if filter != "" {
-		interfaceFilter := func(i string) bool {
-			return i == filter
-		}
-
-		settingEngine.SetInterfaceFilter(interfaceFilter)
-		*muxOpts = append(*muxOpts, ice.UDPMuxFromPortWithInterfaceFilter(interfaceFilter))
+func setupUDPMux(settingEngine *webrtc.SettingEngine, isWHIP bool, shard int, udpMuxCache map[int]*udpMuxShard, udpMuxOpts []ice.UDPMuxFromPortOption) {
+	// Use UDP Mux port if set, shards use the ports following it
+	if udpMuxPort := GetUDPMuxPort(isWHIP); udpMuxPort != 0 {
+		setUDPMuxPort(isWHIP, udpMuxPort+shard, udpMuxCache, udpMuxOpts, settingEngine)
 	}
 }
 
@@ -128,7 +119,8 @@ func getTCPMuxAddress() *net.TCPAddr {
 	return nil
 }
 
-func getUDPMuxPort(isWHIP bool) int {
+// Get the UDP mux port WHIP or WHEP PeerConnections use, 0 if UDP traffic is not multiplexed
+func GetUDPMuxPort(isWHIP bool) int {
 	sharedPort := os.Getenv(environment.UDPMuxPort)
 	whipPort := os.Getenv(environment.UDPMuxPortWHIP)
 	whepPort := os.Getenv(environment.UDPMuxPortWHEP)
@@ -170,7 +162,7 @@ func getUDPMuxPort(isWHIP bool) int {
 	return 0
 }
 
-func setUDPMuxPort(isWHIP bool, udpMuxPort int, udpMuxCache map[int]*ice.MultiUDPMuxDefault, udpMuxOpts []ice.UDPMuxFromPortOption, settingEngine *webrtc.SettingEngine) {
+func setUDPMuxPort(isWHIP bool, udpMuxPort int, udpMuxCache map[int]*udpMuxShard, udpMuxOpts []ice.UDPMuxFromPortOption, settingEngine *webrtc.SettingEngine) {
 	if isWHIP {
 		slog.Info("Setting up WHIP UDP Mux", "port", udpMuxPort)
 	} else {
@@ -181,7 +173,7 @@ func setUDPMuxPort(isWHIP bool, udpMuxPort int, udpMuxCache map[int]*ice.MultiUD
 
 	if !ok {
 		// No Mux for current port, create new
-		newUDPMux, err := ice.NewMultiUDPMuxFromPort(udpMuxPort, udpMuxOpts...)
+		newUDPMux, err := newUDPMuxShard(udpMuxPort, udpMuxOpts)
 
 		if err != nil {
 			slog.Error("Configuration error", "err", err)
@@ -193,37 +185,20 @@ func setUDPMuxPort(isWHIP bool, udpMuxPort int, udpMuxCache map[int]*ice.MultiUD
 	}
 
 	// Set to Mux on existing port
-	settingEngine.SetICEUDPMux(udpMux)
+	settingEngine.SetICEUDPMux(udpMux.mux)
 }
 
-func setupNAT(settingEngine *webrtc.SettingEngine) {
-	var (
-		natIps []string
-	)
-
-	natICECandidateType := webrtc.ICECandidateTypeHost
-
-	if os.Getenv(environment.IncludePublicIPInNAT1To1IP) != "" {
-		natIps = append(natIps, ip.GetPublicIP())
-	}
-
-	if os.Getenv(environment.NAT1To1IP) != "" {
-		natIps = append(natIps, strings.Split(os.Getenv(environment.NAT1To1IP), "|")...)
-	}
-
-	if os.Getenv(environment.NATICECandidateType) == "srflx" {
-		natICECandidateType = webrtc.ICECandidateTypeSrflx
+func setupNAT(settingEngine *webrtc.SettingEngine) error {
+	rules, err := getNATRewriteRules()
+	if err != nil {
+		return fmt.Errorf("NAT_1_TO_1_IP: %w", err)
 	}
 
-	if len(natIps) != 0 {
-		if err := settingEngine.SetICEAddressRewriteRules(webrtc.ICEAddressRewriteRule{
-			External:        natIps,
-			AsCandidateType: natICECandidateType,
-			Mode:            webrtc.ICEAddressRewriteAppend,
-		}); err != nil {
-			slog.Error("Configuration error: INCLUDE_PUBLIC_IP_IN_NAT_1_TO_1_IP", "err", err)
-			os.Exit(1)
+	if len(rules) != 0 {
+		if err := settingEngine.SetICEAddressRewriteRules(rules...); err != nil {
+			return fmt.Errorf("INCLUDE_PUBLIC_IP_IN_NAT_1_TO_1_IP: %w", err)
 		}
-
 	}
+
+	return nil
 }
@@ -0,0 +1,48 @@
+package webrtc
+
+import (
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/pion/webrtc/v4"
+)
+
+// Add a viewer whose tracks write to sink instead of a PeerConnection.
+// The video layer is selected automatically when layer is empty, the viewer is removed by closing the session.
+func addSinkViewer(whepSessionID string, streamKey string, layer string, transport string, sink codecs.PacketSink) (*whep.WHEPSession, error) {
+	profile := authorization.PublicProfile{
+		StreamKey: streamKey,
+	}
+
+	streamSession, err := manager.SessionsManager.GetOrAddSession(profile, false)
+	if err != nil {
+		return nil, err
+	}
+
+	whepSession := streamSession.AddSinkViewer(
+		whepSessionID,
+		transport,
+		codecs.CreateTrackMultiCodecSink("audio", "pion", streamKey, webrtc.RTPCodecTypeAudio, sink),
+		codecs.CreateTrackMultiCodecSink("video", "pion", streamKey, webrtc.RTPCodecTypeVideo, sink),
+		func(layer string) {
+			manager.SessionsManager.SendPLIByWHEPSessionID(whepSessionID, layer)
+		},
+	)
+
+	if layer != "" {
+		whepSession.SetVideoLayer(layer)
+	}
+
+	return whepSession, nil
+}
+
+// Get a callback requesting a keyframe for the viewer, for sinks that lost video and can only continue with one
+func getSinkKeyframeRequester(whepSessionID string) func() {
+	return func() {
+		if whepSession, ok := manager.SessionsManager.GetWHEPSessionByID(whepSessionID); ok {
+			whepSession.IsWaitingForKeyframe.Store(true)
+			whepSession.SendPLI()
+		}
+	}
+}
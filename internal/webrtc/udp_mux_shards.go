@@ -0,0 +1,200 @@
+package webrtc
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/pion/ice/v4"
+	"github.com/pion/transport/v4"
+	"github.com/pion/transport/v4/stdnet"
+)
+
+// Packet rates of the shards are averaged over this interval
+const udpMuxShardRateInterval = 5 * time.Second
+
+var (
+	// Every UDP mux shard created, for reporting their packet rates
+	udpMuxShardsLock sync.Mutex
+	udpMuxShards     []*udpMuxShard
+)
+
+type UDPMuxShardStats struct {
+	Port                     int     `json:"port"`
+	PacketsReceived          uint64  `json:"packetsReceived"`
+	PacketsSent              uint64  `json:"packetsSent"`
+	PacketsReceivedPerSecond float64 `json:"packetsReceivedPerSecond"`
+	PacketsSentPerSecond     float64 `json:"packetsSentPerSecond"`
+}
+
+// A UDP mux on one port of the shard range. Each shard reads its sockets on its own goroutines,
+// PeerConnections are distributed across the shards by creating them with the API of a shard.
+// Shards do not share a port with SO_REUSEPORT, the kernel would deliver a client's packets to the socket picked
+// by hashing the client's address, which is not the shard the PeerConnection's ICE credentials are registered with.
+type udpMuxShard struct {
+	port int
+	mux  *ice.MultiUDPMuxDefault
+
+	packetsReceived atomic.Uint64
+	packetsSent     atomic.Uint64
+
+	ratesLock                sync.Mutex
+	packetsReceivedPerSecond float64
+	packetsSentPerSecond     float64
+}
+
+// Get the number of consecutive ports, starting at the UDP mux port, UDP traffic is sharded across
+func GetUDPMuxShardCount() int {
+	shards := os.Getenv(environment.UDPMuxShards)
+	if shards == "" {
+		return 1
+	}
+
+	shardCount, err := strconv.Atoi(shards)
+	if err != nil || shardCount < 1 {
+		slog.Error("Configuration error: UDP_MUX_SHARDS must be a positive number", "value", shards)
+		os.Exit(1)
+	}
+
+	return shardCount
+}
+
+// Get the packet counters and rates of every UDP mux shard, ordered by port
+func GetUDPMuxShardStats() []UDPMuxShardStats {
+	udpMuxShardsLock.Lock()
+	shards := slices.Clone(udpMuxShards)
+	udpMuxShardsLock.Unlock()
+
+	stats := make([]UDPMuxShardStats, 0, len(shards))
+	for _, shard := range shards {
+		stats = append(stats, shard.getStats())
+	}
+
+	slices.SortFunc(stats, func(a, b UDPMuxShardStats) int { return a.Port - b.Port })
+	return stats
+}
+
+// Listen on port of every local address allowed by udpMuxOpts and count the packets of the sockets
+func newUDPMuxShard(port int, udpMuxOpts []ice.UDPMuxFromPortOption) (*udpMuxShard, error) {
+	stdNet, err := stdnet.NewNet()
+	if err != nil {
+		return nil, err
+	}
+
+	shard := &udpMuxShard{port: port}
+	udpMuxOpts = append(slices.Clone(udpMuxOpts), ice.UDPMuxFromPortWithNet(&udpMuxShardNet{Net: stdNet, shard: shard}))
+
+	if shard.mux, err = ice.NewMultiUDPMuxFromPort(port, udpMuxOpts...); err != nil {
+		return nil, err
+	}
+
+	udpMuxShardsLock.Lock()
+	udpMuxShards = append(udpMuxShards, shard)
+	udpMuxShardsLock.Unlock()
+
+	go shard.updateRates()
+	return shard, nil
+}
+
+func (s *udpMuxShard) getStats() UDPMuxShardStats {
+	s.ratesLock.Lock()
+	defer s.ratesLock.Unlock()
+
+	return UDPMuxShardStats{
+		Port:                     s.port,
+		PacketsReceived:          s.packetsReceived.Load(),
+		PacketsSent:              s.packetsSent.Load(),
+		PacketsReceivedPerSecond: s.packetsReceivedPerSecond,
+		PacketsSentPerSecond:     s.packetsSentPerSecond,
+	}
+}
+
+// Sample the packet counters every udpMuxShardRateInterval, shards live as long as the process
+func (s *udpMuxShard) updateRates() {
+	ticker := time.NewTicker(udpMuxShardRateInterval)
+	defer ticker.Stop()
+
+	lastReceived, lastSent, lastSample := uint64(0), uint64(0), time.Now()
+	for now := range ticker.C {
+		received, sent := s.packetsReceived.Load(), s.packetsSent.Load()
+		elapsed := now.Sub(lastSample).Seconds()
+
+		s.ratesLock.Lock()
+		s.packetsReceivedPerSecond = float64(received-lastReceived) / elapsed
+		s.packetsSentPerSecond = float64(sent-lastSent) / elapsed
+		s.ratesLock.Unlock()
+
+		lastReceived, lastSent, lastSample = received, sent, now
+	}
+}
+
+// Creates the sockets of a shard, counting their packets
+type udpMuxShardNet struct {
+	transport.Net
+	shard *udpMuxShard
+}
+
+func (n *udpMuxShardNet) ListenUDP(network string, localAddress *net.UDPAddr) (transport.UDPConn, error) {
+	conn, err := n.Net.ListenUDP(network, localAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		slog.Warn("UDP mux shard socket is not a UDP connection, packets are not counted", "type", fmt.Sprintf("%T", conn))
+		return conn, nil
+	}
+
+	return &udpMuxShardConn{UDPConn: udpConn, shard: n.shard}, nil
+}
+
+// A socket of a shard. Implements ice.AddrPortReaderWriter, which the mux prefers over ReadFrom and WriteTo.
+type udpMuxShardConn struct {
+	*net.UDPConn
+	shard *udpMuxShard
+}
+
+func (c *udpMuxShardConn) ReadFrom(buffer []byte) (int, net.Addr, error) {
+	n, address, err := c.UDPConn.ReadFrom(buffer)
+	if err == nil {
+		c.shard.packetsReceived.Add(1)
+	}
+
+	return n, address, err
+}
+
+func (c *udpMuxShardConn) WriteTo(buffer []byte, address net.Addr) (int, error) {
+	n, err := c.UDPConn.WriteTo(buffer, address)
+	if err == nil {
+		c.shard.packetsSent.Add(1)
+	}
+
+	return n, err
+}
+
+func (c *udpMuxShardConn) ReadFromAddrPort(buffer []byte) (int, netip.AddrPort, error) {
+	n, address, err := c.ReadFromUDPAddrPort(buffer)
+	if err == nil {
+		c.shard.packetsReceived.Add(1)
+	}
+
+	return n, address, err
+}
+
+func (c *udpMuxShardConn) WriteToAddrPort(buffer []byte, address netip.AddrPort) (int, error) {
+	n, err := c.WriteToUDPAddrPort(buffer, address)
+	if err == nil {
+		c.shard.packetsSent.Add(1)
+	}
+
+	return n, err
+}
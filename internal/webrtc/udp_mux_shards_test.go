@@ -0,0 +1,195 @@
+package webrtc
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var loopbackUDPMuxOpts = []ice.UDPMuxFromPortOption{
+	ice.UDPMuxFromPortWithLoopback(),
+	ice.UDPMuxFromPortWithNetworks(ice.NetworkTypeUDP4),
+	ice.UDPMuxFromPortWithIPFilter(func(ip net.IP) bool { return ip.IsLoopback() }),
+}
+
+// Register a connection for ufrag on the shard and a client whose packets the shard delivers to it
+func dialUDPMuxShard(t testing.TB, shard *udpMuxShard, ufrag string) (net.PacketConn, *net.UDPConn) {
+	listenAddresses := shard.mux.GetListenAddresses()
+	require.NotEmpty(t, listenAddresses)
+
+	muxedConn, err := shard.mux.GetConn(ufrag, listenAddresses[0])
+	require.NoError(t, err)
+
+	client, err := net.DialUDP("udp4", nil, listenAddresses[0].(*net.UDPAddr))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = muxedConn.Close()
+	})
+
+	// The mux delivers the client's first STUN message by its ufrag and maps the client's address once answered
+	message, err := stun.Build(stun.TransactionID, stun.BindingRequest, stun.NewUsername(ufrag+":client"))
+	require.NoError(t, err)
+	_, err = client.Write(message.Raw)
+	require.NoError(t, err)
+
+	buffer := make([]byte, 1500)
+	_, address, err := muxedConn.ReadFrom(buffer)
+	require.NoError(t, err)
+
+	response, err := stun.Build(message, stun.BindingSuccess)
+	require.NoError(t, err)
+	_, err = muxedConn.WriteTo(response.Raw, address)
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = client.Read(buffer)
+	require.NoError(t, err)
+
+	return muxedConn, client
+}
+
+func TestUDPMuxShardCountsPackets(t *testing.T) {
+	shard, err := newUDPMuxShard(0, loopbackUDPMuxOpts)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = shard.mux.Close() })
+
+	muxedConn, client := dialUDPMuxShard(t, shard, "counted")
+
+	_, err = client.Write([]byte{0x80, 0x60, 0x00, 0x01})
+	require.NoError(t, err)
+
+	buffer := make([]byte, 1500)
+	n, address, err := muxedConn.ReadFrom(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x80, 0x60, 0x00, 0x01}, buffer[:n])
+
+	_, err = muxedConn.WriteTo([]byte{0x80, 0x60, 0x00, 0x02}, address)
+	require.NoError(t, err)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = client.Read(buffer)
+	require.NoError(t, err)
+
+	stats := shard.getStats()
+	assert.Equal(t, uint64(2), stats.PacketsReceived)
+	assert.Equal(t, uint64(2), stats.PacketsSent)
+	assert.Contains(t, GetUDPMuxShardStats(), stats)
+}
+
+// Receive packets of clients spread across the shards, sent by parallel senders and read by a goroutine per client.
+// Each shard reads its socket on its own goroutine, so throughput scales with the shards until the cores are busy.
+// Senders send a window of packets and wait for it to be received, so throughput is not limited by socket buffers.
+func BenchmarkUDPMuxShards(b *testing.B) {
+	const (
+		sendersPerCore = 4
+		packetSize     = 1200
+		window         = 4
+		windowTimeout  = 10 * time.Millisecond
+	)
+
+	// Every sender of b.RunParallel writes to a client of its own
+	clientCount := sendersPerCore * runtime.GOMAXPROCS(0)
+
+	for _, shardCount := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("shards=%d", shardCount), func(b *testing.B) {
+			shards := make([]*udpMuxShard, 0, shardCount)
+			for range shardCount {
+				shard, err := newUDPMuxShard(0, loopbackUDPMuxOpts)
+				require.NoError(b, err)
+				b.Cleanup(func() { _ = shard.mux.Close() })
+				shards = append(shards, shard)
+			}
+
+			muxedConns := make([]net.PacketConn, clientCount)
+			clients := make([]*net.UDPConn, clientCount)
+			for i := range clientCount {
+				muxedConns[i], clients[i] = dialUDPMuxShard(b, shards[i%shardCount], fmt.Sprintf("client%d", i))
+			}
+
+			var (
+				received   = make([]atomic.Uint64, clientCount)
+				progress   = make([]chan struct{}, clientCount)
+				sent       atomic.Uint64
+				nextClient atomic.Int64
+				readers    sync.WaitGroup
+			)
+
+			for i, muxedConn := range muxedConns {
+				progress[i] = make(chan struct{}, 1)
+				readers.Go(func() {
+					buffer := make([]byte, 1500)
+					for {
+						if _, _, err := muxedConn.ReadFrom(buffer); err != nil {
+							return
+						}
+
+						received[i].Add(1)
+						select {
+						case progress[i] <- struct{}{}:
+						default:
+						}
+					}
+				})
+			}
+
+			b.SetBytes(packetSize)
+			b.SetParallelism(sendersPerCore)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(nextClient.Add(1)-1) % clientCount
+				packet := make([]byte, packetSize)
+				packet[0] = 0x80
+
+				clientSent := uint64(0)
+				for isSending := true; isSending; {
+					for range window {
+						if isSending = pb.Next(); !isSending {
+							break
+						}
+
+						if _, err := clients[i].Write(packet); err != nil {
+							b.Error(err)
+							return
+						}
+						clientSent++
+					}
+
+					// Packets dropped by the kernel are not resent, the next window starts after the timeout
+					timeout := time.NewTimer(windowTimeout)
+					for isWaiting := true; isWaiting && received[i].Load() < clientSent; {
+						select {
+						case <-progress[i]:
+						case <-timeout.C:
+							isWaiting = false
+						}
+					}
+					timeout.Stop()
+				}
+				sent.Add(clientSent)
+			})
+			b.StopTimer()
+
+			for _, muxedConn := range muxedConns {
+				_ = muxedConn.Close()
+			}
+			readers.Wait()
+
+			totalReceived := uint64(0)
+			for i := range received {
+				totalReceived += received[i].Load()
+			}
+			b.ReportMetric(float64(totalReceived)/b.Elapsed().Seconds(), "packets/s")
+			b.ReportMetric(100*(1-float64(totalReceived)/float64(sent.Load())), "%lost")
+		})
+	}
+}
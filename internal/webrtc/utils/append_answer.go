@@ -10,7 +10,12 @@ import (
 // Appends a candidate to the list of candidates that are sent back to the client in the answer
 func AppendCandidateToAnswer(localDescriptionSFP string) string {
 	if appendCandidate := os.Getenv(environment.AppendCandidate); appendCandidate != "" {
+		// Trickled answers carry the candidate with the remaining server candidates instead
 		index := strings.Index(localDescriptionSFP, "a=end-of-candidates")
+		if index == -1 {
+			return localDescriptionSFP
+		}
+
 		localDescriptionSFP = localDescriptionSFP[:index] + appendCandidate + localDescriptionSFP[index:]
 	}
 
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/pion/webrtc/v4"
+)
+
+// Collects the server candidates of a PeerConnection, so clients that received an answer before
+// gathering completed can fetch the remaining candidates over SSE or a GET on the session resource.
+type CandidateCollector struct {
+	peerConnection *webrtc.PeerConnection
+
+	// Protects candidates, isComplete, changed
+	lock       sync.Mutex
+	candidates []string
+	isComplete bool
+	changed    chan struct{}
+}
+
+// Returns true if answers should be sent before gathering completes. Requires SERVER_TRICKLE_ICE
+// to be enabled and the offer to signal trickle support, other clients keep receiving all candidates in the answer.
+func IsTrickleAnswer(offer string) bool {
+	if !strings.EqualFold(os.Getenv(environment.ServerTrickleICE), "true") {
+		return false
+	}
+
+	for line := range strings.SplitSeq(offer, "\n") {
+		if options, ok := strings.CutPrefix(strings.TrimSpace(line), "a=ice-options:"); ok && slices.Contains(strings.Fields(options), "trickle") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Start collecting candidates, must be called before the local description is set
+func NewCandidateCollector(peerConnection *webrtc.PeerConnection) *CandidateCollector {
+	c := &CandidateCollector{
+		peerConnection: peerConnection,
+		changed:        make(chan struct{}),
+	}
+
+	peerConnection.OnICEGatheringStateChange(func(state webrtc.ICEGatheringState) {
+		// An ICE restart gathers a new generation of candidates
+		if state == webrtc.ICEGatheringStateGathering {
+			c.lock.Lock()
+			c.candidates = nil
+			c.isComplete = false
+			c.notifyLocked()
+			c.lock.Unlock()
+		}
+	})
+
+	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		if candidate == nil {
+			if appendCandidate := os.Getenv(environment.AppendCandidate); appendCandidate != "" {
+				c.candidates = append(c.candidates, strings.TrimPrefix(strings.TrimSpace(appendCandidate), "a="))
+			}
+
+			c.isComplete = true
+		} else {
+			c.candidates = append(c.candidates, candidate.ToJSON().Candidate)
+		}
+
+		c.notifyLocked()
+	})
+
+	return c
+}
+
+func (c *CandidateCollector) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Returns a channel that is closed when a candidate is gathered or gathering completes
+func (c *CandidateCollector) Changed() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.changed
+}
+
+// Returns all gathered candidates, and whether gathering completed
+func (c *CandidateCollector) GetCandidates() (candidates []string, isComplete bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return slices.Clone(c.candidates), c.isComplete
+}
+
+// Get a trickle-ice-sdpfrag (RFC 8840) with the current server credentials and all gathered candidates
+func (c *CandidateCollector) GetSDPFragment() string {
+	if c == nil || c.peerConnection.LocalDescription() == nil {
+		return ""
+	}
+
+	localDescription := c.peerConnection.LocalDescription().SDP
+	candidates, isComplete := c.GetCandidates()
+
+	var fragment strings.Builder
+	for _, key := range []string{"ice-ufrag", "ice-pwd"} {
+		fragment.WriteString("a=" + key + ":" + getSDPValue(localDescription, key) + "\r\n")
+	}
+
+	// Candidates are shared through BUNDLE, so they are listed for the first media section only
+	if mediaLine := getSDPLine(localDescription, "m="); mediaLine != "" {
+		fragment.WriteString(mediaLine + "\r\n")
+		fragment.WriteString("a=mid:" + getSDPValue(localDescription, "mid") + "\r\n")
+	}
+
+	for _, candidate := range candidates {
+		fragment.WriteString("a=" + candidate + "\r\n")
+	}
+
+	if isComplete {
+		fragment.WriteString("a=end-of-candidates\r\n")
+	}
+
+	return fragment.String()
+}
+
+func getSDPLine(sessionDescription string, prefix string) string {
+	for line := range strings.SplitSeq(sessionDescription, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+
+	return ""
+}
+
+func getSDPValue(sessionDescription string, key string) string {
+	return strings.TrimPrefix(getSDPLine(sessionDescription, "a="+key+":"), "a="+key+":")
+}
+
+type candidatesEvent struct {
+	Candidates      []string `json:"candidates"`
+	EndOfCandidates bool     `json:"endOfCandidates"`
+}
+
+// Get SSE String with the candidates gathered after offset, and the offset for the next event.
+// Returns an empty event when there is nothing new to send.
+func (c *CandidateCollector) GetCandidatesEvent(offset int) (event string, nextOffset int) {
+	if c == nil {
+		return "", offset
+	}
+
+	c.lock.Lock()
+	// Candidates were reset by an ICE restart
+	if offset > len(c.candidates) {
+		offset = 0
+	}
+	candidates := slices.Clone(c.candidates[offset:])
+	isComplete := c.isComplete
+	c.lock.Unlock()
+
+	if len(candidates) == 0 && !isComplete {
+		return "", offset
+	}
+
+	data, err := ToJSONString(candidatesEvent{
+		Candidates:      candidates,
+		EndOfCandidates: isComplete,
+	})
+	if err != nil {
+		return "", offset
+	}
+
+	return "event: candidates\ndata: " + data + "\n\n", offset + len(candidates)
+}
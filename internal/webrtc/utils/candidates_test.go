@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTrickleAnswer(t *testing.T) {
+	offer := "v=0\r\na=ice-options:trickle renomination\r\n"
+
+	assert.False(t, IsTrickleAnswer(offer))
+
+	t.Setenv(environment.ServerTrickleICE, "true")
+	assert.True(t, IsTrickleAnswer(offer))
+	assert.False(t, IsTrickleAnswer("v=0\r\na=ice-options:renomination\r\n"))
+}
+
+func TestCandidateCollector(t *testing.T) {
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	server, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer func() { _ = server.Close() }()
+
+	_, err = client.CreateDataChannel("data", nil)
+	require.NoError(t, err)
+
+	offer, err := client.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, server.SetRemoteDescription(offer))
+
+	candidates := NewCandidateCollector(server)
+	gatherComplete := webrtc.GatheringCompletePromise(server)
+
+	answer, err := server.CreateAnswer(nil)
+	require.NoError(t, err)
+	require.NoError(t, server.SetLocalDescription(answer))
+	<-gatherComplete
+
+	// Candidate callbacks may still be running after the gathering promise resolved
+	for {
+		changed := candidates.Changed()
+		if _, isComplete := candidates.GetCandidates(); isComplete {
+			break
+		}
+		<-changed
+	}
+
+	gathered, _ := candidates.GetCandidates()
+	fragment := candidates.GetSDPFragment()
+	assert.Contains(t, fragment, "a=ice-ufrag:"+getSDPValue(server.LocalDescription().SDP, "ice-ufrag"))
+	assert.Contains(t, fragment, "a=mid:0")
+	assert.True(t, strings.HasSuffix(fragment, "a=end-of-candidates\r\n"))
+	assert.Equal(t, len(gathered), strings.Count(fragment, "a=candidate:"))
+
+	event, offset := candidates.GetCandidatesEvent(0)
+	assert.Contains(t, event, "event: candidates")
+	assert.Contains(t, event, `"endOfCandidates":true`)
+	assert.Equal(t, len(gathered), offset)
+}
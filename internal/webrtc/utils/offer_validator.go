@@ -1,8 +1,95 @@
 package utils
 
-import "github.com/pion/sdp/v3"
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+)
+
+// Largest trickle ICE or ICE restart sdpfrag accepted in a PATCH
+const maxSDPFragmentSize = 16 * 1024
+
+var (
+	ErrSDPFragmentTooLarge = errors.New("sdpfrag is too large")
+	ErrInvalidSDPFragment  = errors.New("invalid sdpfrag line")
+)
 
 func ValidateOffer(offer string) error {
 	var parsed sdp.SessionDescription
 	return parsed.Unmarshal([]byte(offer))
 }
+
+// Check the size of an sdpfrag and that every line is a <type>=<value> SDP line.
+// An sdpfrag is not a full session description, so it cannot be checked with ValidateOffer.
+func ValidateSDPFragment(fragment string) error {
+	if len(fragment) > maxSDPFragmentSize {
+		return ErrSDPFragmentTooLarge
+	}
+
+	for line := range strings.SplitSeq(fragment, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+
+		if len(line) < 2 || line[0] < 'a' || line[0] > 'z' || line[1] != '=' {
+			return fmt.Errorf("%w: %q", ErrInvalidSDPFragment, line)
+		}
+	}
+
+	return nil
+}
+
+// Returns the number of audio and video pairs offered beyond the first, up to maxSlots.
+// Viewers offer an additional pair per stage guest they want to receive.
+func GetStageSlotCount(offer string, maxSlots int) int {
+	var parsed sdp.SessionDescription
+	if err := parsed.Unmarshal([]byte(offer)); err != nil {
+		return 0
+	}
+
+	audio, video := 0, 0
+	for _, media := range parsed.MediaDescriptions {
+		switch media.MediaName.Media {
+		case "audio":
+			audio++
+		case "video":
+			video++
+		}
+	}
+
+	return max(min(audio, video, maxSlots+1)-1, 0)
+}
+
+// Returns which kinds of media the offer wants to receive, media sections that are
+// inactive, sendonly or rejected with port 0 are ignored
+func GetOfferedMediaKinds(offer string) (hasAudio bool, hasVideo bool) {
+	var parsed sdp.SessionDescription
+	if err := parsed.Unmarshal([]byte(offer)); err != nil {
+		return false, false
+	}
+
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Port.Value == 0 {
+			continue
+		}
+
+		if _, inactive := media.Attribute("inactive"); inactive {
+			continue
+		}
+		if _, sendOnly := media.Attribute("sendonly"); sendOnly {
+			continue
+		}
+
+		switch media.MediaName.Media {
+		case "audio":
+			hasAudio = true
+		case "video":
+			hasVideo = true
+		}
+	}
+
+	return hasAudio, hasVideo
+}
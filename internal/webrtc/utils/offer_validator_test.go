@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestOffer(audioDirection string, videoDirection string) string {
+	return "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\nc=IN IP4 0.0.0.0\r\na=mid:0\r\na=" + audioDirection + "\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\nc=IN IP4 0.0.0.0\r\na=mid:1\r\na=" + videoDirection + "\r\n"
+}
+
+func TestGetOfferedMediaKinds(t *testing.T) {
+	hasAudio, hasVideo := GetOfferedMediaKinds(createTestOffer("recvonly", "recvonly"))
+	assert.True(t, hasAudio)
+	assert.True(t, hasVideo)
+
+	hasAudio, hasVideo = GetOfferedMediaKinds(createTestOffer("recvonly", "inactive"))
+	assert.True(t, hasAudio)
+	assert.False(t, hasVideo)
+
+	hasAudio, hasVideo = GetOfferedMediaKinds(createTestOffer("sendonly", "sendrecv"))
+	assert.False(t, hasAudio)
+	assert.True(t, hasVideo)
+}
+
+func TestGetStageSlotCount(t *testing.T) {
+	offer := createTestOffer("recvonly", "recvonly")
+	assert.Equal(t, 0, GetStageSlotCount(offer, 3))
+
+	offer += "m=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:2\r\na=recvonly\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\na=mid:3\r\na=recvonly\r\n"
+	assert.Equal(t, 1, GetStageSlotCount(offer, 3))
+	assert.Equal(t, 0, GetStageSlotCount(offer, 0))
+}
+
+func TestValidateSDPFragment(t *testing.T) {
+	assert.NoError(t, ValidateSDPFragment("a=ice-ufrag:abcd\r\na=ice-pwd:efgh\r\nm=audio 9 UDP/TLS/RTP/SAVPF 0\r\na=mid:0\r\na=candidate:1 1 udp 1 127.0.0.1 5000 typ host\r\n"))
+	assert.ErrorIs(t, ValidateSDPFragment("a=ice-ufrag:abcd\r\nnot sdp\r\n"), ErrInvalidSDPFragment)
+	assert.ErrorIs(t, ValidateSDPFragment(strings.Repeat("a=x\r\n", maxSDPFragmentSize)), ErrSDPFragmentTooLarge)
+}
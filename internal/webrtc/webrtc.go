@@ -2,9 +2,14 @@ package webrtc
 
 import (
 	"errors"
+	"log/slog"
+	"os"
 	"strings"
+	"sync"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/ip"
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 	"github.com/glimesh/broadcast-box/internal/webrtc/interceptors"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
@@ -13,6 +18,14 @@ import (
 	"github.com/pion/webrtc/v4"
 )
 
+var (
+	ErrSessionNotFound = errors.New("no session found")
+	ErrETagMismatch    = errors.New("entity tag does not match the current ice session")
+)
+
+// Protects the UDP and TCP mux caches, the APIs are rebuilt with them when the public IP changes
+var muxCacheLock sync.Mutex
+
 func Setup(chatManager *chat.Manager) {
 	manager.SessionsManager = &manager.SessionManager{
 		ChatManager: chatManager,
@@ -24,65 +37,172 @@ func Setup(chatManager *chat.Manager) {
 	codecs.RegisterCodecs(mediaEngine)
 
 	interceptorRegistry := interceptors.GetRegistry(mediaEngine)
-	udpMuxCache := map[int]*ice.MultiUDPMuxDefault{}
+	udpMuxCache := map[int]*udpMuxShard{}
 	tcpMuxCache := map[string]ice.TCPMux{}
 
-	initializeAPIWHIP(mediaEngine, udpMuxCache, tcpMuxCache, &interceptorRegistry)
-	initializeAPIWHEP(mediaEngine, udpMuxCache, tcpMuxCache, &interceptorRegistry)
+	// The public IP is part of the NAT rewrite rules, new PeerConnections use the refreshed IP.
+	// Other settings were validated at boot and their sockets are cached, a failed refresh keeps the current APIs.
+	if os.Getenv(environment.IncludePublicIPInNAT1To1IP) != "" {
+		ip.StartRefresh(func(publicIP string) {
+			slog.Info("WebRTC.Setup: Public IP changed, updating NAT rewrite rules", "ip", publicIP)
+			if err := initializeAPIs(mediaEngine, udpMuxCache, tcpMuxCache, &interceptorRegistry); err != nil {
+				slog.Error("WebRTC.Setup: Failed to update NAT rewrite rules", "ip", publicIP, "err", err)
+			}
+		})
+	}
+
+	if err := initializeAPIs(mediaEngine, udpMuxCache, tcpMuxCache, &interceptorRegistry); err != nil {
+		slog.Error("Configuration error", "err", err)
+		os.Exit(1)
+	}
 }
 
-func initializeAPIWHIP(mediaEngine *webrtc.MediaEngine, udpMuxCache map[int]*ice.MultiUDPMuxDefault, tcpMuxCache map[string]ice.TCPMux, registry *interceptor.Registry) {
-	manager.APIWHIP = webrtc.NewAPI(
-		webrtc.WithMediaEngine(mediaEngine),
-		webrtc.WithInterceptorRegistry(registry),
-		webrtc.WithSettingEngine(getSettingEngine(true, tcpMuxCache, udpMuxCache)),
-	)
+// Create the WHIP and WHEP APIs, the current APIs are only replaced once both were created
+func initializeAPIs(mediaEngine *webrtc.MediaEngine, udpMuxCache map[int]*udpMuxShard, tcpMuxCache map[string]ice.TCPMux, registry *interceptor.Registry) error {
+	muxCacheLock.Lock()
+	defer muxCacheLock.Unlock()
+
+	whipAPIs, err := newAPIs(true, mediaEngine, udpMuxCache, tcpMuxCache, registry)
+	if err != nil {
+		return err
+	}
+
+	whepAPIs, err := newAPIs(false, mediaEngine, udpMuxCache, tcpMuxCache, registry)
+	if err != nil {
+		return err
+	}
+
+	manager.SetAPIWHIP(whipAPIs...)
+	manager.SetAPIWHEP(whepAPIs...)
+	return nil
 }
 
-func initializeAPIWHEP(mediaEngine *webrtc.MediaEngine, udpMuxCache map[int]*ice.MultiUDPMuxDefault, tcpMuxCache map[string]ice.TCPMux, registry *interceptor.Registry) {
-	manager.APIWHEP = webrtc.NewAPI(
-		webrtc.WithMediaEngine(mediaEngine),
-		webrtc.WithInterceptorRegistry(registry),
-		webrtc.WithSettingEngine(getSettingEngine(false, tcpMuxCache, udpMuxCache)),
-	)
+// Create an API per UDP mux shard, or a single API when UDP traffic is not multiplexed
+func newAPIs(isWHIP bool, mediaEngine *webrtc.MediaEngine, udpMuxCache map[int]*udpMuxShard, tcpMuxCache map[string]ice.TCPMux, registry *interceptor.Registry) ([]*webrtc.API, error) {
+	shardCount := 1
+	if GetUDPMuxPort(isWHIP) != 0 {
+		shardCount = GetUDPMuxShardCount()
+	}
+
+	apis := make([]*webrtc.API, 0, shardCount)
+	for shard := range shardCount {
+		settingEngine, err := getSettingEngine(isWHIP, shard, tcpMuxCache, udpMuxCache)
+		if err != nil {
+			return nil, err
+		}
+
+		apis = append(apis, webrtc.NewAPI(
+			webrtc.WithMediaEngine(mediaEngine),
+			webrtc.WithInterceptorRegistry(registry),
+			webrtc.WithSettingEngine(settingEngine),
+		))
+	}
+
+	return apis, nil
 }
 
-func HandleWHEPPatch(sessionID, body string) error {
+// Apply a trickle ICE or ICE restart PATCH to a WHEP session, if ifMatch matches its current ICE session.
+// Returns the sdpfrag answer when the PATCH restarted ICE.
+func HandleWHEPPatch(sessionID, body, ifMatch string) (string, error) {
 	session, isFound := manager.SessionsManager.GetWHEPSessionByID(sessionID)
 
 	if !isFound {
-		return errors.New("no session found")
+		return "", ErrSessionNotFound
 	}
 
 	session.PeerConnectionLock.Lock()
-	if err := patchPeerConnection(session.PeerConnection, body); err != nil {
-		session.PeerConnectionLock.Unlock()
-		return err
+	defer session.PeerConnectionLock.Unlock()
+
+	// Viewers over a WebSocket or WebTransport have no PeerConnection to patch
+	if session.PeerConnection == nil {
+		return "", ErrSessionNotFound
 	}
-	session.PeerConnectionLock.Unlock()
 
-	return nil
+	if !matchesETag(session.PeerConnection, ifMatch) {
+		return "", ErrETagMismatch
+	}
+
+	return patchPeerConnection(session.PeerConnection, body)
 }
 
-func HandleWHIPPatch(sessionID, body string) error {
-	session, isFound := manager.SessionsManager.GetSessionByID(sessionID)
+// Apply a trickle ICE or ICE restart PATCH to a WHIP session, if ifMatch matches its current ICE session.
+// Returns the sdpfrag answer when the PATCH restarted ICE.
+func HandleWHIPPatch(sessionID, body, ifMatch string) (string, error) {
+	session, isFound := manager.SessionsManager.GetSessionByHostSessionID(sessionID)
 
 	if !isFound {
-		return errors.New("no session found")
+		return "", ErrSessionNotFound
 	}
 
-	host := session.Host.Load()
+	host := session.GetPublisher(sessionID)
 	if host == nil {
-		return errors.New("no host found")
+		return "", ErrSessionNotFound
 	}
 
 	host.PeerConnectionLock.Lock()
-	if err := patchPeerConnection(host.PeerConnection, body); err != nil {
-		host.PeerConnectionLock.Unlock()
-		return err
+	defer host.PeerConnectionLock.Unlock()
+
+	if !matchesETag(host.PeerConnection, ifMatch) {
+		return "", ErrETagMismatch
+	}
+
+	return patchPeerConnection(host.PeerConnection, body)
+}
+
+// Get the server candidates of a WHEP session as sdpfrag
+func GetWHEPCandidates(sessionID string) (string, error) {
+	session, isFound := manager.SessionsManager.GetWHEPSessionByID(sessionID)
+	if !isFound || session.Candidates == nil {
+		return "", ErrSessionNotFound
+	}
+
+	return session.Candidates.GetSDPFragment(), nil
+}
+
+// Get the server candidates of a WHIP session as sdpfrag
+func GetWHIPCandidates(sessionID string) (string, error) {
+	session, isFound := manager.SessionsManager.GetSessionByHostSessionID(sessionID)
+	if !isFound {
+		return "", ErrSessionNotFound
+	}
+
+	host := session.GetPublisher(sessionID)
+	if host == nil || host.Candidates == nil {
+		return "", ErrSessionNotFound
+	}
+
+	return host.Candidates.GetSDPFragment(), nil
+}
+
+// Pause or resume forwarding a kind of media to a WHEP session, both kinds when kind is empty.
+// The session is only changed if ifMatch matches its current ICE session.
+func HandleWHEPMediaPaused(sessionID, kind string, paused bool, ifMatch string) error {
+	session, isFound := manager.SessionsManager.GetWHEPSessionByID(sessionID)
+
+	if !isFound {
+		return ErrSessionNotFound
+	}
+
+	session.PeerConnectionLock.RLock()
+	isMatch := matchesETag(session.PeerConnection, ifMatch)
+	session.PeerConnectionLock.RUnlock()
+
+	if !isMatch {
+		return ErrETagMismatch
+	}
+
+	return session.SetMediaPaused(kind, paused)
+}
+
+// Close a WHEP session right away instead of waiting for ICE to fail
+func HandleWHEPDelete(sessionID string) error {
+	session, isFound := manager.SessionsManager.GetWHEPSessionByID(sessionID)
+
+	if !isFound {
+		return ErrSessionNotFound
 	}
-	host.PeerConnectionLock.Unlock()
 
+	session.Close()
 	return nil
 }
 
@@ -90,37 +210,96 @@ func HandleWHIPDelete(sessionID string) error {
 	session, isFound := manager.SessionsManager.GetSessionByHostSessionID(sessionID)
 
 	if !isFound {
-		return errors.New("no session found")
+		return ErrSessionNotFound
 	}
 
-	session.RemoveHost()
-	if session.GetStreamStatus().ViewerCount == 0 {
-		session.Close()
+	session.RemovePublisher(sessionID)
+	return nil
+}
+
+// Get the entity tag identifying the ICE session of a session description or sdpfrag
+func GetETag(sessionDescription string) string {
+	return `"` + getSdpKeyValue(sessionDescription, "ice-ufrag") + `"`
+}
+
+// Returns true if the If-Match header is absent, a wildcard, or matches the current ICE session
+func matchesETag(peerConnection *webrtc.PeerConnection, ifMatch string) bool {
+	if ifMatch == "" || strings.TrimSpace(ifMatch) == "*" {
+		return true
 	}
 
-	return nil
+	if peerConnection == nil || peerConnection.LocalDescription() == nil {
+		return false
+	}
+
+	etag := GetETag(peerConnection.LocalDescription().SDP)
+	for value := range strings.SplitSeq(ifMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(value), "W/") == etag {
+			return true
+		}
+	}
+
+	return false
 }
 
-func patchPeerConnection(peerConnection *webrtc.PeerConnection, body string) error {
+func patchPeerConnection(peerConnection *webrtc.PeerConnection, body string) (string, error) {
+	if peerConnection == nil || peerConnection.CurrentRemoteDescription() == nil {
+		return "", errors.New("no peerconnection found")
+	}
+
+	// Candidates are checked before restarting ICE, so a rejected PATCH leaves the credentials unchanged
+	candidates, err := getICECandidates(body)
+	if err != nil {
+		return "", err
+	}
+
 	oldUfrag := getSdpKeyValue(peerConnection.CurrentRemoteDescription().SDP, "ice-ufrag")
 	oldPwd := getSdpKeyValue(peerConnection.CurrentRemoteDescription().SDP, "ice-pwd")
 	newUfrag, newPwd := getSdpKeyValue(body, "ice-ufrag"), getSdpKeyValue(body, "ice-pwd")
 
-	isICERestart := oldUfrag != newUfrag || oldPwd != newPwd
+	// Credentials are optional when only trickling candidates
+	isICERestart := (newUfrag != "" && newUfrag != oldUfrag) || (newPwd != "" && newPwd != oldPwd)
+
+	if !isICERestart {
+		return "", addICECandidates(peerConnection, candidates)
+	}
+
+	answer, err := restartICE(peerConnection, newUfrag, newPwd)
+	if err != nil {
+		return "", err
+	}
 
-	if isICERestart {
-		return errors.New("ice restart not supported")
+	// The client needs the answer with the new credentials, candidates that could not be added are only logged
+	if err = addICECandidates(peerConnection, candidates); err != nil {
+		slog.Warn("WebRTC.PatchPeerConnection: Failed to add candidates after ICE restart", "err", err)
 	}
 
+	return answer, nil
+}
+
+// Get the candidates of an sdpfrag, returns an error if a candidate cannot be parsed
+func getICECandidates(body string) ([]webrtc.ICECandidateInit, error) {
+	candidates := []webrtc.ICECandidateInit{}
 	for line := range strings.SplitSeq(body, "\n") {
-		expectedPrefix := "a=candidate:"
+		candidate, ok := strings.CutPrefix(strings.TrimSpace(line), "a=")
+		if !ok || !strings.HasPrefix(candidate, "candidate:") {
+			continue
+		}
 
-		if strings.HasPrefix(line, expectedPrefix) {
-			if err := peerConnection.AddICECandidate(webrtc.ICECandidateInit{
-				Candidate: strings.TrimSpace(strings.TrimPrefix(line, "a=")),
-			}); err != nil {
-				return err
-			}
+		if _, err := ice.UnmarshalCandidate(candidate); err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, webrtc.ICECandidateInit{Candidate: candidate})
+	}
+
+	return candidates, nil
+}
+
+func addICECandidates(peerConnection *webrtc.PeerConnection, candidates []webrtc.ICECandidateInit) error {
+	for _, candidate := range candidates {
+		if err := peerConnection.AddICECandidate(candidate); err != nil {
+			return err
 		}
 	}
 
@@ -132,7 +311,7 @@ func getSdpKeyValue(sdp string, key string) string {
 	for l := range strings.SplitSeq(sdp, "\n") {
 		expectedPrefix := "a=" + key + ":"
 		if after, ok := strings.CutPrefix(l, expectedPrefix); ok {
-			return after
+			return strings.TrimSpace(after)
 		}
 	}
 
@@ -0,0 +1,40 @@
+package webrtc
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/fmp4"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/google/uuid"
+)
+
+// Add a viewer receiving the stream as fragmented MP4 written to output, for networks where no ICE path works
+func WebSocket(streamKey string, layer string, output fmp4.Output) (*whep.WHEPSession, *fmp4.Muxer, error) {
+	whepSessionID := uuid.New().String()
+	muxer := fmp4.NewMuxer(output, getWebSocketFragmentDuration(), getSinkKeyframeRequester(whepSessionID))
+
+	whepSession, err := addSinkViewer(whepSessionID, streamKey, layer, whep.TransportWebSocket, muxer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return whepSession, muxer, nil
+}
+
+func getWebSocketFragmentDuration() time.Duration {
+	value := os.Getenv(environment.WebSocketFragmentDuration)
+	if value == "" {
+		return fmp4.DefaultFragmentDuration
+	}
+
+	fragmentDuration, err := time.ParseDuration(value)
+	if err != nil || fragmentDuration <= 0 {
+		slog.Error("WebSocket: Invalid fragment duration", "value", value, "err", err)
+		return fmp4.DefaultFragmentDuration
+	}
+
+	return fragmentDuration
+}
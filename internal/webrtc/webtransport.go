@@ -0,0 +1,20 @@
+package webrtc
+
+import (
+	"github.com/glimesh/broadcast-box/internal/webrtc/moq"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/google/uuid"
+)
+
+// Add a viewer receiving the stream as MoQ tracks, with each group written to a stream opened by output
+func WebTransport(streamKey string, layer string, output moq.Output) (*whep.WHEPSession, *moq.Publisher, error) {
+	whepSessionID := uuid.New().String()
+	publisher := moq.NewPublisher(output, getSinkKeyframeRequester(whepSessionID))
+
+	whepSession, err := addSinkViewer(whepSessionID, streamKey, layer, whep.TransportWebTransport, publisher)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return whepSession, publisher, nil
+}
@@ -1,12 +1,15 @@
 package webrtc
 
 import (
+	"errors"
 	"log/slog"
 
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 	"github.com/glimesh/broadcast-box/internal/webrtc/peerconnection"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v4"
@@ -15,32 +18,70 @@ import (
 func WHEP(offer string, streamKey string) (string, string, error) {
 	utils.DebugOutputOffer(offer)
 
+	// Only the kinds of media the viewer asked for are sent
+	receivesAudio, receivesVideo := utils.GetOfferedMediaKinds(offer)
+	if !receivesAudio && !receivesVideo {
+		return "", "", errors.New("offer does not receive audio or video")
+	}
+
 	profile := authorization.PublicProfile{
 		StreamKey: streamKey,
 	}
 
-	session, err := manager.SessionsManager.GetOrAddSession(profile, false)
+	streamSession, err := manager.SessionsManager.GetOrAddSession(profile, false)
 	if err != nil {
 		return "", "", err
 	}
 
 	whepSessionID := uuid.New().String()
 
-	peerConnection, err := peerconnection.CreateWHEPPeerConnection()
+	peerConnection, err := peerconnection.CreateWHEPPeerConnection(whepSessionID)
 	if err != nil {
 		return "", "", err
 	}
 
 	audioTrack, videoTrack := codecs.GetDefaultTracks(streamKey)
 
-	_, err = peerConnection.AddTrack(audioTrack)
-	if err != nil {
-		return "", "", err
+	if receivesAudio {
+		if _, err = peerConnection.AddTrack(audioTrack); err != nil {
+			return "", "", err
+		}
+	} else {
+		audioTrack = nil
 	}
 
-	videoRTCPSender, err := peerConnection.AddTrack(videoTrack)
-	if err != nil {
-		return "", "", err
+	var videoRTCPSender *webrtc.RTPSender
+	if receivesVideo {
+		if videoRTCPSender, err = peerConnection.AddTrack(videoTrack); err != nil {
+			return "", "", err
+		}
+	} else {
+		videoTrack = nil
+	}
+
+	// Additional audio and video pairs in the offer receive the stage guests
+	stageSlots := 0
+	if receivesAudio && receivesVideo {
+		stageSlots = utils.GetStageSlotCount(offer, session.MaxStageGuests)
+	}
+	stageTracks := make([]*whep.StageTrack, 0, stageSlots)
+	for slot := 1; slot <= stageSlots; slot++ {
+		stageAudioTrack, stageVideoTrack := codecs.GetStageTracks(streamKey, slot)
+
+		if _, err = peerConnection.AddTrack(stageAudioTrack); err != nil {
+			return "", "", err
+		}
+
+		stageVideoRTCPSender, err := peerConnection.AddTrack(stageVideoTrack)
+		if err != nil {
+			return "", "", err
+		}
+
+		stageTracks = append(stageTracks, &whep.StageTrack{
+			AudioTrack:      stageAudioTrack,
+			VideoTrack:      stageVideoTrack,
+			VideoRTCPSender: stageVideoRTCPSender,
+		})
 	}
 
 	if err := peerConnection.SetRemoteDescription(webrtc.SessionDescription{
@@ -50,6 +91,7 @@ func WHEP(offer string, streamKey string) (string, string, error) {
 		return "", "", err
 	}
 
+	candidates := utils.NewCandidateCollector(peerConnection)
 	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
 	answer, err := peerConnection.CreateAnswer(nil)
 
@@ -60,21 +102,27 @@ func WHEP(offer string, streamKey string) (string, string, error) {
 	}
 
 	// TODO: Should this be before gatherComplete to assure registered events are triggered at correct time?
-	if err := session.AddWHEP(
+	if err := streamSession.AddWHEP(
 		whepSessionID,
 		peerConnection,
+		candidates,
 		audioTrack,
 		videoTrack,
 		videoRTCPSender,
-		func() {
-			manager.SessionsManager.SendPLIByWHEPSessionID(whepSessionID)
+		stageTracks,
+		func(layer string) {
+			manager.SessionsManager.SendPLIByWHEPSessionID(whepSessionID, layer)
 		},
 	); err != nil {
 		return "", "", err
 	}
 
-	<-gatherComplete
-	slog.Info("WHEPSession.GatheringCompletePromise: Completed Gathering", "streamKey", streamKey)
+	if utils.IsTrickleAnswer(offer) {
+		slog.Info("WHEPSession: Answering before gathering completed", "streamKey", streamKey)
+	} else {
+		<-gatherComplete
+		slog.Info("WHEPSession.GatheringCompletePromise: Completed Gathering", "streamKey", streamKey)
+	}
 
 	return utils.DebugOutputAnswer(utils.AppendCandidateToAnswer(peerConnection.LocalDescription().SDP)),
 		whepSessionID,
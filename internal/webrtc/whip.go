@@ -8,6 +8,7 @@ import (
 	"github.com/glimesh/broadcast-box/internal/webrtc/peerconnection"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
 	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
+	"github.com/google/uuid"
 )
 
 // Initialize WHIP session for incoming stream
@@ -18,12 +19,16 @@ func WHIP(offer string, profile authorization.PublicProfile) (sdp string, sessio
 		return "", "", errors.New("invalid offer: " + err.Error())
 	}
 
+	if manager.SessionsManager.IsVirtualChannel(profile.StreamKey) {
+		return "", "", errors.New("stream key is used by a virtual channel")
+	}
+
 	session, err := manager.SessionsManager.GetOrAddSession(profile, true)
 	if err != nil {
 		return "", "", err
 	}
 
-	peerConnection, err := peerconnection.CreateWHIPPeerConnection(offer)
+	peerConnection, candidates, err := peerconnection.CreateWHIPPeerConnection(offer, uuid.New().String())
 	if err != nil || peerConnection == nil {
 		slog.Error("WHIP.CreateWHIPPeerConnection.Failed", "err", err)
 		if peerConnection != nil {
@@ -34,7 +39,7 @@ func WHIP(offer string, profile authorization.PublicProfile) (sdp string, sessio
 		return "", "", err
 	}
 
-	if err := session.AddHost(peerConnection); err != nil {
+	if err := session.AddHost(peerConnection, candidates); err != nil {
 		return "", "", err
 	}
 
@@ -49,3 +54,44 @@ func WHIP(offer string, profile authorization.PublicProfile) (sdp string, sessio
 	slog.Info("WHIP.Offer.Accepted", "streamKey", profile.StreamKey, "motd", profile.MOTD)
 	return
 }
+
+// Returns true if the token is an open stage invite of a live stream
+func IsStageInvite(token string) bool {
+	_, isFound := manager.SessionsManager.GetSessionByStageInvite(token)
+	return isFound
+}
+
+// Initialize WHIP session for a guest publishing to the stage of a stream
+func WHIPStageGuest(offer string, token string) (sdp string, sessionID string, err error) {
+	if err := utils.ValidateOffer(offer); err != nil {
+		return "", "", errors.New("invalid offer: " + err.Error())
+	}
+
+	session, isFound := manager.SessionsManager.GetSessionByStageInvite(token)
+	if !isFound {
+		return "", "", ErrSessionNotFound
+	}
+	slog.Info("WHIP.StageGuest.Offer.Requested", "streamKey", session.StreamKey)
+
+	peerConnection, candidates, err := peerconnection.CreateWHIPPeerConnection(offer, uuid.New().String())
+	if err != nil || peerConnection == nil {
+		slog.Error("WHIP.StageGuest.CreateWHIPPeerConnection.Failed", "err", err)
+		if peerConnection != nil {
+			if closeErr := peerConnection.Close(); closeErr != nil {
+				slog.Error("WHIP.StageGuest.CreateWHIPPeerConnection.Close.Failed", "err", closeErr)
+			}
+		}
+		return "", "", err
+	}
+
+	guest, err := session.AddStageGuest(token, peerConnection, candidates)
+	if err != nil {
+		if closeErr := peerConnection.Close(); closeErr != nil {
+			slog.Error("WHIP.StageGuest.Close.Failed", "err", closeErr)
+		}
+		return "", "", err
+	}
+
+	slog.Info("WHIP.StageGuest.Offer.Accepted", "streamKey", session.StreamKey, "slot", guest.StageSlot)
+	return utils.DebugOutputAnswer(utils.AppendCandidateToAnswer(peerConnection.LocalDescription().SDP)), guest.ID, nil
+}